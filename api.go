@@ -0,0 +1,131 @@
+package hdhomerunexporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// An api is a wrapper for the HTTP API of an HDHomeRun device.
+type api interface {
+	// Get performs an HTTP GET request for the specified path, decoding the
+	// JSON response body into v.
+	Get(path string, v interface{}) error
+}
+
+// errNotFound is returned by an api when the requested path does not exist,
+// such as when a device does not support an endpoint.
+var errNotFound = errors.New("HTTP API path not found")
+
+var _ api = &hdhrAPI{}
+
+// A hdhrAPI is an api which uses an *http.Client to communicate with an
+// HDHomeRun device.
+type hdhrAPI struct {
+	ctx  context.Context
+	c    *http.Client
+	base *url.URL
+	auth Secret
+}
+
+// newAPI creates an api for the device with the specified host, bound to
+// the lifetime of ctx. If auth is set, it is sent as the device auth token
+// with each request.
+func newAPI(ctx context.Context, c *http.Client, host string, auth Secret) api {
+	return &hdhrAPI{
+		ctx: ctx,
+		c:   c,
+		base: &url.URL{
+			Scheme: "http",
+			Host:   host,
+		},
+		auth: auth,
+	}
+}
+
+func (a *hdhrAPI) Get(path string, v interface{}) error {
+	// u is safe to use in errors; the auth token is only added to the URL
+	// used for the request itself.
+	u := a.base.ResolveReference(&url.URL{Path: path})
+	ru := *u
+	if a.auth != "" {
+		ru.RawQuery = url.Values{"DeviceAuth": {string(a.auth)}}.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, ru.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := a.c.Do(req.WithContext(a.ctx))
+	if err != nil {
+		if uerr, ok := err.(*url.Error); ok {
+			// Don't leak the auth token in error messages.
+			uerr.URL = u.String()
+		}
+
+		return err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return errNotFound
+	default:
+		return fmt.Errorf("unexpected HTTP status for %q: %s", u, res.Status)
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// A discoverJSON is the device metadata served by an HDHomeRun device's
+// discover.json endpoint.
+type discoverJSON struct {
+	FriendlyName    string
+	ModelNumber     string
+	FirmwareVersion string
+	DeviceID        string
+	DeviceAuth      Secret
+	TunerCount      int
+
+	StorageID  string
+	StorageURL string
+
+	// The DVR RECORD engine reports its software version in place of a
+	// firmware version.
+	Version string
+
+	// Storage devices also report their disk capacity in bytes.
+	TotalSpace int64
+	FreeSpace  int64
+
+	// Storage devices which buffer live TV may also report the space in
+	// bytes used by their live pause buffers.
+	LiveBufferSpace *int64 `json:",omitempty"`
+
+	// DVRActive reports whether the device's HDHomeRun DVR service
+	// subscription is active, for devices linked to a DVR account.
+	DVRActive *int `json:"DvrActive,omitempty"`
+}
+
+// A Secret is a sensitive string, such as a device auth token, which is
+// redacted when formatted or marshaled so that it is not accidentally logged.
+type Secret string
+
+// String implements fmt.Stringer.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+
+	return "<secret>"
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
@@ -0,0 +1,67 @@
+package hdhomerunexporter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAPIGetAuth(t *testing.T) {
+	const auth = "abcdef0123456789"
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("DeviceAuth"); got != auth {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		_, _ = fmt.Fprint(w, `{"DeviceID":"1040A1B2"}`)
+	}))
+	defer s.Close()
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatalf("failed to parse URL: %v", err)
+	}
+
+	a := newAPI(context.Background(), http.DefaultClient, u.Host, auth)
+
+	var discover discoverJSON
+	if err := a.Get("/discover.json", &discover); err != nil {
+		t.Fatalf("failed to get discover.json: %v", err)
+	}
+
+	if diff := cmp.Diff("1040A1B2", discover.DeviceID); diff != "" {
+		t.Fatalf("unexpected device ID (-want +got):\n%s", diff)
+	}
+}
+
+func TestAPIGetRedactsAuth(t *testing.T) {
+	const auth = "abcdef0123456789"
+
+	// Nothing is listening at this address, so the request will fail.
+	s := httptest.NewServer(http.NotFoundHandler())
+	host := s.Listener.Addr().String()
+	s.Close()
+
+	a := newAPI(context.Background(), http.DefaultClient, host, auth)
+
+	err := a.Get("/discover.json", &discoverJSON{})
+	if err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+
+	if strings.Contains(err.Error(), auth) {
+		t.Fatalf("auth token leaked in error: %v", err)
+	}
+
+	if diff := cmp.Diff("<secret>", fmt.Sprint(Secret(auth))); diff != "" {
+		t.Fatalf("unexpected formatted secret (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,114 @@
+package hdhomerunexporter
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// A plp is an ATSC 3.0 physical layer pipe reported by a tuner.
+type plp struct {
+	ID         string
+	Modulation string
+	CodeRate   string
+	Locked     bool
+
+	// ATSC 3.0 signal quality is reported per PLP rather than per tuner, as
+	// percentages in the same form as a tuner's snq and seq. Quality values
+	// which the tuner does not report are nil.
+	SignalToNoiseQuality *int
+	SymbolErrorQuality   *int
+}
+
+// parsePLPInfo parses the value of /tunerN/plpinfo, which consists of a line
+// per physical layer pipe of the form
+// "0: mod=qam256 cod=10/15 lock=1 snq=85 seq=100". Lines which do not contain
+// a PLP ID are ignored.
+func parsePLPInfo(s string) []plp {
+	var plps []plp
+	for _, l := range strings.Split(s, "\n") {
+		kv := strings.SplitN(l, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		id := strings.TrimSpace(kv[0])
+		if id == "" {
+			continue
+		}
+
+		kvs := parseKV(kv[1])
+		plps = append(plps, plp{
+			ID:                   id,
+			Modulation:           kvs["mod"],
+			CodeRate:             kvs["cod"],
+			Locked:               kvs["lock"] == "1",
+			SignalToNoiseQuality: percent(kvs["snq"]),
+			SymbolErrorQuality:   percent(kvs["seq"]),
+		})
+	}
+
+	return plps
+}
+
+// percent parses an optional percentage value, returning nil if s is not a
+// valid percentage.
+func percent(s string) *int {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return nil
+	}
+
+	return &v
+}
+
+// collectPLPs collects ATSC 3.0 physical layer pipe metrics for a tuner, if
+// the device reports them.
+func (c *collector) collectPLPs(ch chan<- prometheus.Metric, tuner string, i int) error {
+	v, err := c.query(tunerKey(i, "plpinfo"))
+	switch {
+	case notExist(err):
+		return nil
+	case err != nil:
+		return err
+	}
+
+	for _, p := range parsePLPInfo(v) {
+		ch <- prometheus.MustNewConstMetric(
+			c.TunerPLPInfo,
+			prometheus.GaugeValue,
+			1,
+			tuner, p.ID, p.Modulation, p.CodeRate,
+		)
+
+		ds := []descValue{{
+			desc:  c.TunerPLPLocked,
+			value: boolValue(p.Locked),
+		}}
+
+		if p.SignalToNoiseQuality != nil {
+			ds = append(ds, descValue{
+				desc:  c.TunerPLPSignalToNoiseRatio,
+				value: ratio(*p.SignalToNoiseQuality),
+			})
+		}
+		if p.SymbolErrorQuality != nil {
+			ds = append(ds, descValue{
+				desc:  c.TunerPLPSymbolErrorRatio,
+				value: ratio(*p.SymbolErrorQuality),
+			})
+		}
+
+		for _, d := range ds {
+			ch <- prometheus.MustNewConstMetric(
+				d.desc,
+				prometheus.GaugeValue,
+				d.value,
+				tuner, p.ID,
+			)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package hdhomerunexporter
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParsePLPInfo(t *testing.T) {
+	intp := func(v int) *int { return &v }
+
+	tests := []struct {
+		name string
+		s    string
+		plps []plp
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "malformed",
+			s:    "foo\n: mod=qam256\n",
+		},
+		{
+			name: "OK",
+			s:    "0: mod=qam256 cod=10/15 lock=1 snq=85 seq=100\n1: mod=qpsk cod=4/15 lock=0\n",
+			plps: []plp{
+				{
+					ID:                   "0",
+					Modulation:           "qam256",
+					CodeRate:             "10/15",
+					Locked:               true,
+					SignalToNoiseQuality: intp(85),
+					SymbolErrorQuality:   intp(100),
+				},
+				{
+					ID:         "1",
+					Modulation: "qpsk",
+					CodeRate:   "4/15",
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.plps, parsePLPInfo(tt.s)); diff != "" {
+				t.Fatalf("unexpected PLPs (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package hdhomerunexporter
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collectCardStatus collects CableCARD status metrics, including the status
+// of the out-of-band (OOB) signal used by the CableCARD.
+func (c *collector) collectCardStatus(ch chan<- prometheus.Metric) error {
+	v, err := c.query("/card/status")
+	switch {
+	case notExist(err):
+		return nil
+	case err != nil:
+		return err
+	}
+
+	kvs := parseKV(v)
+
+	ch <- prometheus.MustNewConstMetric(
+		c.CableCARDInfo,
+		prometheus.GaugeValue,
+		1,
+		kvs["card"], kvs["auth"], kvs["oob"], kvs["act"],
+	)
+
+	ds := []descValue{
+		{
+			desc:  c.CableCARDAuthorized,
+			value: boolValue(kvs["auth"] == "success" && kvs["act"] == "success"),
+		},
+		{
+			desc:  c.CableCARDOOBLocked,
+			value: boolValue(kvs["oob"] == "success"),
+		},
+	}
+
+	// Not all devices report detailed OOB signal status.
+	v, err = c.query("/oob/status")
+	switch {
+	case notExist(err):
+	case err != nil:
+		return err
+	default:
+		oob := parseKV(v)
+		for _, d := range []struct {
+			desc *prometheus.Desc
+			key  string
+		}{
+			{desc: c.CableCARDOOBSignalStrengthRatio, key: "ss"},
+			{desc: c.CableCARDOOBSignalToNoiseRatio, key: "snq"},
+		} {
+			percent, err := strconv.Atoi(oob[d.key])
+			if err != nil {
+				continue
+			}
+
+			ds = append(ds, descValue{
+				desc:  d.desc,
+				value: ratio(percent),
+			})
+		}
+	}
+
+	for _, d := range ds {
+		ch <- prometheus.MustNewConstMetric(
+			d.desc,
+			prometheus.GaugeValue,
+			d.value,
+		)
+	}
+
+	return nil
+}
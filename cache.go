@@ -0,0 +1,313 @@
+package hdhomerunexporter
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// WithCacheTTL configures the handler to cache the metrics collected from
+// each target for the specified amount of time. Scrapes of the same target
+// with the same query parameters within the TTL, such as those from a pair of
+// highly available Prometheus servers, are served from the cache rather than
+// from the device. By default, metrics are not cached.
+func WithCacheTTL(d time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.cacheTTL = d
+	}
+}
+
+// errAbandoned is shared with scrapes waiting on a flight whose metrics were
+// never collected.
+var errAbandoned = errors.New("identical scrape in progress was abandoned")
+
+// A cachedScrape is the set of metrics collected by a scrape of a device.
+type cachedScrape struct {
+	time    time.Time
+	metrics []prometheus.Metric
+
+	// good and fresh are the metrics collected by the most recent successful
+	// scrape and the time of that scrape. If the most recent scrape failed,
+	// stale is set and metrics includes any metrics from good which the
+	// failed scrape did not collect.
+	good  []prometheus.Metric
+	fresh time.Time
+	stale bool
+}
+
+// cached returns the scrape cached under key, if it was collected no earlier
+// than ttl before now.
+func (s *deviceState) cached(key string, ttl time.Duration, now time.Time) (cachedScrape, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cs, ok := s.cache[key]
+	if !ok || now.Sub(cs.time) >= ttl {
+		return cachedScrape{}, false
+	}
+
+	return cs, true
+}
+
+// setCached caches metrics collected at time t under key by a scrape which
+// returned err, replacing any scrape previously cached under key. If the
+// scrape failed, the last known metrics are preserved. The cached scrape is
+// returned.
+func (s *deviceState) setCached(key string, t time.Time, metrics []prometheus.Metric, err error) cachedScrape {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cs := cachedScrape{
+		time:    t,
+		metrics: metrics,
+	}
+
+	switch prev, ok := s.cache[key]; {
+	case err == nil:
+		cs.good = metrics
+		cs.fresh = t
+	case ok && prev.good != nil:
+		cs.metrics = staleMetrics(metrics, prev.good)
+		cs.good = prev.good
+		cs.fresh = prev.fresh
+		cs.stale = true
+	}
+
+	s.cache[key] = cs
+
+	// Entries for parameters which are no longer scraped would otherwise
+	// accumulate for as long as the device is scraped at all.
+	for k, c := range s.cache {
+		if t.Sub(c.time) >= deviceIdleTimeout {
+			delete(s.cache, k)
+		}
+	}
+
+	return cs
+}
+
+// resetCache discards all of the scrapes cached for the device.
+func (s *deviceState) resetCache() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cache = make(map[string]cachedScrape)
+}
+
+// staleMetrics returns the metrics collected by a failed scrape, along with
+// any metrics from the last successful scrape, good, which the failed scrape
+// did not collect. Metrics are identified by their descriptor and label
+// values, so that a tuner which the failed scrape did reach does not hide
+// the last known metrics of one which it did not.
+func staleMetrics(failed, good []prometheus.Metric) []prometheus.Metric {
+	seen := make(map[string]bool, len(failed))
+	for _, m := range failed {
+		seen[metricKey(m)] = true
+	}
+
+	metrics := append([]prometheus.Metric(nil), failed...)
+	for _, m := range good {
+		if !seen[metricKey(m)] {
+			metrics = append(metrics, m)
+		}
+	}
+
+	return metrics
+}
+
+// metricKey returns a key which uniquely identifies the series of metric m.
+func metricKey(m prometheus.Metric) string {
+	var pb dto.Metric
+	if err := m.Write(&pb); err != nil {
+		// Invalid metrics are never served from the cache, so the
+		// descriptor alone suffices.
+		return m.Desc().String()
+	}
+
+	var b strings.Builder
+	b.WriteString(m.Desc().String())
+	for _, lp := range pb.GetLabel() {
+		b.WriteByte(0)
+		b.WriteString(lp.GetName())
+		b.WriteByte('=')
+		b.WriteString(lp.GetValue())
+	}
+
+	return b.String()
+}
+
+// withFreshness returns the metrics of cs along with metrics which describe
+// the freshness of its data as of now.
+func (c *collector) withFreshness(cs cachedScrape, now time.Time) []prometheus.Metric {
+	metrics := append([]prometheus.Metric(nil), cs.metrics...)
+
+	metrics = append(metrics, prometheus.MustNewConstMetric(
+		c.DataStale,
+		prometheus.GaugeValue,
+		boolValue(cs.stale),
+	))
+
+	if !cs.fresh.IsZero() {
+		metrics = append(metrics, prometheus.MustNewConstMetric(
+			c.DataAgeSeconds,
+			prometheus.GaugeValue,
+			now.Sub(cs.fresh).Seconds(),
+		))
+	}
+
+	return metrics
+}
+
+// A flight is a scrape of a device which is in progress. Its result is shared
+// with any identical scrapes which begin before it completes, so that only
+// one connection is made to the device.
+type flight struct {
+	once    sync.Once
+	done    chan struct{}
+	metrics []prometheus.Metric
+	err     error
+}
+
+// join returns the flight in progress for key, or begins a new flight if
+// none is in progress. If leader is true, the caller began the flight and
+// must complete it using land.
+func (s *deviceState) join(key string) (f *flight, leader bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f, ok := s.flights[key]; ok {
+		return f, false
+	}
+
+	f = &flight{done: make(chan struct{})}
+	s.flights[key] = f
+
+	return f, true
+}
+
+// land completes flight f for key with the result of its scrape. Only the
+// first call to land for a flight has any effect.
+func (s *deviceState) land(key string, f *flight, metrics []prometheus.Metric, err error) {
+	f.once.Do(func() {
+		s.mu.Lock()
+		if s.flights[key] == f {
+			delete(s.flights, key)
+		}
+		s.mu.Unlock()
+
+		f.metrics = metrics
+		f.err = err
+		close(f.done)
+	})
+}
+
+// wait waits for flight f to complete, or for ctx to be canceled.
+func (f *flight) wait(ctx context.Context) ([]prometheus.Metric, error) {
+	select {
+	case <-f.done:
+		return f.metrics, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// A sharedCollector is a prometheus.Collector which shares the metrics
+// collected by c with any identical scrapes waiting on flight f, and caches
+// them in a deviceState under key if cache is true.
+type sharedCollector struct {
+	c     prometheus.Collector
+	s     *deviceState
+	key   string
+	f     *flight
+	cache bool
+}
+
+// Describe implements prometheus.Collector.
+func (sc *sharedCollector) Describe(ch chan<- *prometheus.Desc) { sc.c.Describe(ch) }
+
+// Collect implements prometheus.Collector.
+func (sc *sharedCollector) Collect(ch chan<- prometheus.Metric) {
+	if !sc.cache {
+		mch := make(chan prometheus.Metric)
+		go func() {
+			defer close(mch)
+			sc.c.Collect(mch)
+		}()
+
+		var metrics []prometheus.Metric
+		for m := range mch {
+			metrics = append(metrics, m)
+			ch <- m
+		}
+
+		sc.s.land(sc.key, sc.f, metrics, nil)
+		return
+	}
+
+	// The scrape must complete to determine whether the last known metrics
+	// should be served in its place.
+	now := time.Now()
+	metrics := collectMetrics(sc.c)
+	cs := sc.s.setCached(sc.key, now, metrics, scrapeErr(sc.c))
+	metrics = newCollector(nil, nil, nil, collectorConfig{}).(*collector).withFreshness(cs, now)
+
+	for _, m := range metrics {
+		ch <- m
+	}
+
+	// The metrics are cached before completing the flight, so that scrapes
+	// which begin afterward are served from the cache.
+	sc.s.land(sc.key, sc.f, metrics, nil)
+}
+
+// collectMetrics collects all of the metrics from c.
+func collectMetrics(c prometheus.Collector) []prometheus.Metric {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		defer close(ch)
+		c.Collect(ch)
+	}()
+
+	var metrics []prometheus.Metric
+	for m := range ch {
+		metrics = append(metrics, m)
+	}
+
+	return metrics
+}
+
+// scrapeErr returns the error which occurred when c, as returned by
+// deviceCollector, collected metrics from a device, if any. Unlike the
+// device's last scrape, it is unaffected by any concurrent scrapes.
+func scrapeErr(c prometheus.Collector) error {
+	switch c := c.(type) {
+	case *collector:
+		return c.err
+	case *failedCollector:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// A cachedCollector is a prometheus.Collector which serves metrics from a
+// previous or identical concurrent scrape.
+type cachedCollector struct {
+	c       *collector
+	metrics []prometheus.Metric
+}
+
+// Describe implements prometheus.Collector.
+func (cc *cachedCollector) Describe(ch chan<- *prometheus.Desc) { cc.c.Describe(ch) }
+
+// Collect implements prometheus.Collector.
+func (cc *cachedCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range cc.metrics {
+		ch <- m
+	}
+}
@@ -0,0 +1,117 @@
+package hdhomerunexporter
+
+import "github.com/mdlayher/hdhomerun"
+
+// capabilities describe the identity of a device and the optional features
+// it supports. They are probed on the first scrape of a device and cached
+// thereafter, so that unsupported queries can be skipped.
+type capabilities struct {
+	// HWModel is the device's hardware model, if reported.
+	HWModel string
+
+	// DeviceID is the device's unique ID, if reported.
+	DeviceID string
+
+	// CableCARD indicates the device accepts a CableCARD.
+	CableCARD bool
+
+	// HTTPAPI indicates the device's HTTP API is reachable.
+	HTTPAPI bool
+
+	// ATSC3 indicates the device supports ATSC 3.0 (NextGen TV) tuning.
+	ATSC3 bool
+
+	// Transcode indicates the device has a hardware transcoder, such as the
+	// HDHomeRun EXTEND.
+	Transcode bool
+
+	// Features maps each of the features reported by /sys/features, such
+	// as "channelmap" or "modulation", to its supported values.
+	Features map[string][]string
+
+	// Storage indicates the device provides DVR storage.
+	Storage bool
+
+	// Partial indicates that an optional probe failed, such as due to a
+	// transient network error, so that the capabilities should be probed
+	// again later.
+	Partial bool
+}
+
+// probe probes a device to determine its capabilities.
+func (c *collector) probe() (capabilities, error) {
+	var caps capabilities
+
+	hwmodel, err := c.d.Query("/sys/hwmodel")
+	switch {
+	case hdhomerun.IsNotExist(err):
+		// Older devices may not report a hardware model.
+	case err != nil:
+		return capabilities{}, err
+	default:
+		caps.HWModel = hwmodel
+	}
+
+	quirks := c.resolveQuirks(caps.HWModel)
+
+	if !quirks.missing("/sys/device_id") {
+		id, err := c.d.Query("/sys/device_id")
+		switch {
+		case hdhomerun.IsNotExist(err):
+		case err != nil:
+			return capabilities{}, err
+		default:
+			caps.DeviceID = id
+		}
+	}
+
+	if !quirks.NoCableCARD && !quirks.missing("/card/status") {
+		_, err := c.d.Query("/card/status")
+		switch {
+		case hdhomerun.IsNotExist(err):
+		case err != nil:
+			return capabilities{}, err
+		default:
+			caps.CableCARD = true
+		}
+	}
+
+	if !quirks.missing("/sys/features") {
+		features, err := c.d.Query("/sys/features")
+		switch {
+		case hdhomerun.IsNotExist(err):
+		case err != nil:
+			return capabilities{}, err
+		default:
+			caps.Features = parseFeatures(features)
+			_, caps.Transcode = caps.Features["transcode"]
+			for _, vs := range caps.Features {
+				for _, v := range vs {
+					if v == "atsc3" {
+						caps.ATSC3 = true
+					}
+				}
+			}
+		}
+	}
+
+	// The HTTP API is optional, so any error indicates that the API is not
+	// available for now. The error may be transient, so the API is probed
+	// again later.
+	if c.a != nil {
+		discover, err := c.discoverJSON()
+		if err != nil {
+			caps.Partial = true
+		} else {
+			caps.HTTPAPI = true
+			caps.Storage = discover.StorageID != "" || discover.StorageURL != ""
+
+			// Fall back to the HTTP API for the device ID.
+			if caps.DeviceID == "" {
+				caps.DeviceID = discover.DeviceID
+			}
+		}
+	}
+
+	return caps, nil
+}
@@ -0,0 +1,102 @@
+package hdhomerunexporter
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCollectorProbe(t *testing.T) {
+	tests := []struct {
+		name string
+		d    device
+		a    api
+		cfg  collectorConfig
+		caps capabilities
+	}{
+		{
+			name: "no capabilities",
+			d:    &testDevice{},
+		},
+		{
+			name: "CableCARD",
+			d:    &testDevice{queries: primeQueries},
+			caps: capabilities{
+				HWModel:   "HDHR3-CC",
+				DeviceID:  "1040A1B2",
+				CableCARD: true,
+			},
+		},
+		{
+			name: "CableCARD quirk",
+			d:    &testDevice{queries: primeQueries},
+			cfg: collectorConfig{
+				Quirks: map[string]Quirks{
+					"HDHR3-CC": {NoCableCARD: true},
+				},
+			},
+			caps: capabilities{
+				HWModel:  "HDHR3-CC",
+				DeviceID: "1040A1B2",
+			},
+		},
+		{
+			name: "ATSC3",
+			d: &testDevice{
+				queries: map[string]string{
+					"/sys/hwmodel":  "HDHR5-4K",
+					"/sys/features": "channelmap: us-bcast\nmodulation: 8vsb atsc3\n",
+					"/card/status":  "",
+				},
+			},
+			cfg: collectorConfig{Quirks: defaultQuirks()},
+			caps: capabilities{
+				HWModel: "HDHR5-4K",
+				ATSC3:   true,
+				Features: map[string][]string{
+					"channelmap": {"us-bcast"},
+					"modulation": {"8vsb", "atsc3"},
+				},
+			},
+		},
+		{
+			name: "HTTP API storage",
+			d:    &testDevice{},
+			a: &testAPI{
+				paths: map[string]interface{}{
+					"/discover.json": discoverJSON{
+						DeviceID:   "1040A1B2",
+						StorageID:  "1040A1B2-ABCD",
+						StorageURL: "http://192.168.1.10/recorded_files.json",
+					},
+				},
+			},
+			caps: capabilities{
+				DeviceID: "1040A1B2",
+				HTTPAPI:  true,
+				Storage:  true,
+			},
+		},
+		{
+			name: "HTTP API unavailable",
+			d:    &testDevice{},
+			a:    &testAPI{},
+			caps: capabilities{Partial: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCollector(tt.d, tt.a, newDeviceState(), tt.cfg).(*collector)
+
+			caps, err := c.probe()
+			if err != nil {
+				t.Fatalf("failed to probe: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.caps, caps); diff != "" {
+				t.Fatalf("unexpected capabilities (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
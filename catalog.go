@@ -0,0 +1,118 @@
+package hdhomerunexporter
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Possible backends which provide metrics.
+const (
+	backendControl = "control"
+	backendHTTP    = "http"
+)
+
+// A metricInfo describes a metric family which may be emitted by the exporter.
+type metricInfo struct {
+	Name    string   `json:"name"`
+	Help    string   `json:"help"`
+	Type    string   `json:"type"`
+	Unit    string   `json:"unit,omitempty"`
+	Labels  []string `json:"labels"`
+	Backend string   `json:"backend"`
+}
+
+// A descBuilder creates Prometheus metric descriptions and records a
+// metricInfo for each one.
+type descBuilder struct {
+	infos []metricInfo
+}
+
+// desc creates a metric description for a metric provided by the device
+// control protocol.
+func (b *descBuilder) desc(name, help string, labels []string) *prometheus.Desc {
+	return b.backendDesc(backendControl, name, help, labels)
+}
+
+// backendDesc creates a metric description for a metric provided by the
+// specified backend.
+func (b *descBuilder) backendDesc(backend, name, help string, labels []string) *prometheus.Desc {
+	if labels == nil {
+		labels = []string{}
+	}
+
+	b.infos = append(b.infos, metricInfo{
+		Name:    name,
+		Help:    help,
+		Type:    metricType(name),
+		Unit:    metricUnit(name),
+		Labels:  labels,
+		Backend: backend,
+	})
+
+	return prometheus.NewDesc(name, help, labels, nil)
+}
+
+// metricType infers the type of a metric from the suffix of its name.
+func metricType(name string) string {
+	switch {
+	case strings.HasSuffix(name, "_total"):
+		return "counter"
+	case strings.HasSuffix(name, "_info"):
+		return "info"
+	default:
+		return "gauge"
+	}
+}
+
+// metricUnit infers the unit of a metric from the suffix of its name.
+func metricUnit(name string) string {
+	name = strings.TrimSuffix(name, "_total")
+
+	// Longer suffixes must be checked before their shorter counterparts.
+	for _, u := range []string{
+		"bytes_per_second",
+		"packets_per_second",
+		"seconds",
+		"bytes",
+		"ratio",
+		"celsius",
+		"hz",
+		"dbm",
+		"db",
+	} {
+		if strings.HasSuffix(name, "_"+u) {
+			return u
+		}
+	}
+
+	return ""
+}
+
+// NewCatalogHandler returns an http.Handler which serves a JSON description
+// of every metric family which may be emitted by the handler returned by
+// NewHandler.
+func NewCatalogHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(catalog())
+	})
+}
+
+// catalog returns the metricInfo for every metric family emitted by the
+// exporter, sorted by name.
+func catalog() []metricInfo {
+	c := newCollector(nil, nil, nil, collectorConfig{}).(*collector)
+
+	infos := make([]metricInfo, len(c.catalog))
+	copy(infos, c.catalog)
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+
+	return infos
+}
@@ -0,0 +1,79 @@
+package hdhomerunexporter_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/hdhomerun_exporter"
+)
+
+func TestNewCatalogHandler(t *testing.T) {
+	s := httptest.NewServer(hdhomerunexporter.NewCatalogHandler())
+	defer s.Close()
+
+	res, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatalf("failed to perform HTTP request: %v", err)
+	}
+	defer res.Body.Close()
+
+	type metricInfo struct {
+		Name    string   `json:"name"`
+		Help    string   `json:"help"`
+		Type    string   `json:"type"`
+		Unit    string   `json:"unit"`
+		Labels  []string `json:"labels"`
+		Backend string   `json:"backend"`
+	}
+
+	var infos []metricInfo
+	if err := json.NewDecoder(res.Body).Decode(&infos); err != nil {
+		t.Fatalf("failed to decode catalog: %v", err)
+	}
+
+	byName := make(map[string]metricInfo, len(infos))
+	for _, mi := range infos {
+		if _, ok := byName[mi.Name]; ok {
+			t.Fatalf("duplicate metric in catalog: %q", mi.Name)
+		}
+		if mi.Help == "" {
+			t.Fatalf("metric %q has no help text", mi.Name)
+		}
+
+		byName[mi.Name] = mi
+	}
+
+	want := map[string]metricInfo{
+		"hdhomerun_device_info": {
+			Name:    "hdhomerun_device_info",
+			Help:    "Metadata about the device.",
+			Type:    "info",
+			Labels:  []string{"model", "hwmodel", "firmware", "device_id"},
+			Backend: "control",
+		},
+		"hdhomerun_network_errors_total": {
+			Name:    "hdhomerun_network_errors_total",
+			Help:    "Total number of device network errors for this tuner, accumulated across device counter resets.",
+			Type:    "counter",
+			Labels:  []string{"tuner"},
+			Backend: "control",
+		},
+		"hdhomerun_tuner_signal_strength_ratio": {
+			Name:    "hdhomerun_tuner_signal_strength_ratio",
+			Help:    "Television signal strength ratio for this tuner.",
+			Type:    "gauge",
+			Unit:    "ratio",
+			Labels:  []string{"tuner"},
+			Backend: "control",
+		},
+	}
+
+	for name, mi := range want {
+		if diff := cmp.Diff(mi, byName[name]); diff != "" {
+			t.Fatalf("unexpected catalog entry for %q (-want +got):\n%s", name, diff)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/mdlayher/hdhomerun_exporter"
+	"gopkg.in/yaml.v2"
+)
+
+// A config is the contents of the configuration file specified by the
+// -config.file flag. Flags which are set explicitly on the command line take
+// precedence over the configuration file.
+type config struct {
+	ListenAddress   string                  `yaml:"listen_address"`
+	ListenAddresses []string                `yaml:"listen_addresses"`
+	Timeout         *time.Duration          `yaml:"timeout"`
+	TimeoutOffset   *time.Duration          `yaml:"timeout_offset"`
+	AllowedTargets  []string                `yaml:"allowed_targets"`
+	StaticTargets   []string                `yaml:"static_targets"`
+	Targets         map[string]targetConfig `yaml:"targets"`
+	Modules         map[string]moduleConfig `yaml:"modules"`
+	Quirks          map[string]quirksConfig `yaml:"quirks"`
+	Collectors      map[string]bool         `yaml:"collectors"`
+}
+
+// A targetConfig is the configuration file equivalent of the per-target
+// flags.
+type targetConfig struct {
+	Address    string        `yaml:"address"`
+	Tuners     int           `yaml:"tuners"`
+	SkipTuners []int         `yaml:"skip_tuners"`
+	AuthFile   string        `yaml:"auth_file"`
+	Protocol   string        `yaml:"protocol"`
+	Quirks     *quirksConfig `yaml:"quirks"`
+}
+
+// A quirksConfig is the configuration file equivalent of the quirks flag.
+type quirksConfig struct {
+	MissingKeys           []string `yaml:"missing_keys"`
+	NoCableCARD           bool     `yaml:"no_cablecard"`
+	TemperatureFahrenheit bool     `yaml:"temperature_fahrenheit"`
+	NoDebugSignalStrength bool     `yaml:"no_debug_signal_strength"`
+}
+
+// quirks converts the configuration to hdhomerunexporter.Quirks.
+func (q quirksConfig) quirks() hdhomerunexporter.Quirks {
+	return hdhomerunexporter.Quirks{
+		MissingKeys:           q.MissingKeys,
+		NoCableCARD:           q.NoCableCARD,
+		TemperatureFahrenheit: q.TemperatureFahrenheit,
+		NoDebugSignalStrength: q.NoDebugSignalStrength,
+	}
+}
+
+// A moduleConfig is the configuration file equivalent of the module flag.
+type moduleConfig struct {
+	Protocol    string        `yaml:"protocol"`
+	Timeout     time.Duration `yaml:"timeout"`
+	Lightweight bool          `yaml:"lightweight"`
+	TunerKeys   []string      `yaml:"tuner_keys"`
+	Collectors  []string      `yaml:"collectors"`
+	HTTP        struct {
+		Timeout            time.Duration `yaml:"timeout"`
+		IdleTimeout        time.Duration `yaml:"idle_timeout"`
+		InsecureSkipVerify bool          `yaml:"insecure_skip_verify"`
+		DisableKeepAlives  bool          `yaml:"disable_keep_alives"`
+	} `yaml:"http"`
+}
+
+// loadConfig reads and parses the configuration file at path. Unknown fields
+// are rejected, so that typos do not go unnoticed. If path is empty, an empty
+// configuration is returned.
+func loadConfig(path string) (*config, error) {
+	if path == "" {
+		return &config{}, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var c config
+	if err := yaml.UnmarshalStrict(b, &c); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// A reloadConfig is the configuration which may be reloaded while the
+// exporter is running.
+type reloadConfig struct {
+	targets map[string]hdhomerunexporter.TargetConfig
+	modules map[string]hdhomerunexporter.Module
+	allowed []string
+}
+
+// targetConfigs converts the targets in the configuration file to
+// per-target configuration.
+func (c *config) targetConfigs() (map[string]hdhomerunexporter.TargetConfig, error) {
+	targets := make(map[string]hdhomerunexporter.TargetConfig, len(c.Targets))
+	for target, t := range c.Targets {
+		if t.Tuners < 0 {
+			return nil, fmt.Errorf("invalid tuner count for target %q: %d", target, t.Tuners)
+		}
+
+		tc := hdhomerunexporter.TargetConfig{
+			Address:    t.Address,
+			Tuners:     t.Tuners,
+			SkipTuners: t.SkipTuners,
+		}
+
+		if t.AuthFile != "" {
+			b, err := ioutil.ReadFile(t.AuthFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read auth file for target %q: %v", target, err)
+			}
+
+			tc.Auth = hdhomerunexporter.Secret(strings.TrimSpace(string(b)))
+		}
+
+		if t.Protocol != "" {
+			p, err := parseProtocol(t.Protocol)
+			if err != nil {
+				return nil, fmt.Errorf("invalid protocol for target %q: %v", target, err)
+			}
+
+			tc.Protocol = p
+		}
+
+		if t.Quirks != nil {
+			q := t.Quirks.quirks()
+			tc.Quirks = &q
+		}
+
+		targets[target] = tc
+	}
+
+	return targets, nil
+}
+
+// moduleConfigs converts the modules in the configuration file to module
+// configuration.
+func (c *config) moduleConfigs() (map[string]hdhomerunexporter.Module, error) {
+	mods := make(map[string]hdhomerunexporter.Module, len(c.Modules))
+	for name, m := range c.Modules {
+		if m.Timeout < 0 || m.HTTP.Timeout < 0 || m.HTTP.IdleTimeout < 0 {
+			return nil, fmt.Errorf("invalid negative timeout for module %q", name)
+		}
+
+		keys, err := tunerKeys(m.TunerKeys)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tuner_keys for module %q: %v", name, err)
+		}
+
+		collectors, err := collectorNames(m.Collectors)
+		if err != nil {
+			return nil, fmt.Errorf("invalid collectors for module %q: %v", name, err)
+		}
+
+		mod := hdhomerunexporter.Module{
+			Timeout:     m.Timeout,
+			Lightweight: m.Lightweight,
+			TunerKeys:   keys,
+			Collectors:  collectors,
+			HTTP: hdhomerunexporter.HTTPClientConfig{
+				Timeout:            m.HTTP.Timeout,
+				IdleConnTimeout:    m.HTTP.IdleTimeout,
+				InsecureSkipVerify: m.HTTP.InsecureSkipVerify,
+				DisableKeepAlives:  m.HTTP.DisableKeepAlives,
+			},
+		}
+
+		if m.Protocol != "" {
+			p, err := parseProtocol(m.Protocol)
+			if err != nil {
+				return nil, fmt.Errorf("invalid protocol for module %q: %v", name, err)
+			}
+
+			mod.Protocol = p
+		}
+
+		mods[name] = mod
+	}
+
+	return mods, nil
+}
+
+// quirksConfigs converts the quirks in the configuration file to Quirks,
+// keyed by hardware model.
+func (c *config) quirksConfigs() map[string]hdhomerunexporter.Quirks {
+	quirks := make(map[string]hdhomerunexporter.Quirks, len(c.Quirks))
+	for hwmodel, q := range c.Quirks {
+		quirks[hwmodel] = q.quirks()
+	}
+
+	return quirks
+}
+
+// disabledCollectors returns the names of the collectors disabled by the
+// -collector.<name> flags in enabled and the configuration file. A flag which
+// was set explicitly, as indicated by set, takes precedence over the file.
+func (c *config) disabledCollectors(enabled map[string]*bool, set map[string]bool) ([]string, error) {
+	for n := range c.Collectors {
+		if _, ok := enabled[n]; !ok {
+			return nil, fmt.Errorf("unknown collector %q: must be one of %s", n, strings.Join(hdhomerunexporter.Collectors(), ", "))
+		}
+	}
+
+	var disabled []string
+	for _, n := range hdhomerunexporter.Collectors() {
+		on := *enabled[n]
+		if v, ok := c.Collectors[n]; ok && !set["collector."+n] {
+			on = v
+		}
+
+		if !on {
+			disabled = append(disabled, n)
+		}
+	}
+
+	return disabled, nil
+}
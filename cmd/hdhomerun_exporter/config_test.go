@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestModuleConfigsTunerKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+		ok   bool
+	}{
+		{
+			name: "all",
+			ok:   true,
+		},
+		{
+			name: "valid",
+			keys: []string{"status", "vstatus"},
+			ok:   true,
+		},
+		{
+			name: "typo",
+			keys: []string{"status", "vstauts"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config{
+				Modules: map[string]moduleConfig{
+					"light": {TunerKeys: tt.keys},
+				},
+			}
+
+			_, err := cfg.moduleConfigs()
+			if tt.ok && err != nil {
+				t.Fatalf("failed to parse configuration modules: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error parsing configuration modules, but none occurred")
+			}
+
+			opts := "protocol=both"
+			if len(tt.keys) > 0 {
+				opts = "tuner_keys=" + strings.Join(tt.keys, ":")
+			}
+
+			_, err = moduleConfigs(mapFlag{"light": opts})
+			if tt.ok && err != nil {
+				t.Fatalf("failed to parse module flags: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error parsing module flags, but none occurred")
+			}
+		})
+	}
+}
+
+func TestModuleConfigsCollectors(t *testing.T) {
+	cfg := &config{
+		Modules: map[string]moduleConfig{
+			"storage": {Collectors: []string{"storage", "lineup"}},
+		},
+	}
+
+	mods, err := cfg.moduleConfigs()
+	if err != nil {
+		t.Fatalf("failed to parse configuration modules: %v", err)
+	}
+
+	if got := strings.Join(mods["storage"].Collectors, ","); got != "storage,lineup" {
+		t.Fatalf("unexpected module collectors: %q", got)
+	}
+
+	if _, err := moduleConfigs(mapFlag{"storage": "collectors=storage:linuep"}); err == nil {
+		t.Fatal("expected an error parsing an unknown collector, but none occurred")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mdlayher/hdhomerun"
+	"github.com/mdlayher/hdhomerun_exporter"
+)
+
+// A discoveredDevice is the JSON representation of a device found by the
+// discover subcommand.
+type discoveredDevice struct {
+	DeviceID string `json:"device_id"`
+	Address  string `json:"address"`
+	Tuners   int    `json:"tuners"`
+	URL      string `json:"url,omitempty"`
+}
+
+// discover implements the discover subcommand, which finds HDHomeRun devices
+// on the local network using the UDP discovery protocol and prints them, to
+// ease first-time setup and the debugging of broadcast issues. It returns the
+// process's exit code.
+func discover(args []string) int {
+	fs := flag.NewFlagSet("discover", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s discover [flags]\n\nFind HDHomeRun devices on the local network.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	var (
+		timeout = fs.Duration("timeout", 2*time.Second, "amount of time to wait for devices to reply")
+		id      = fs.String("id", "", "only find the device with this device ID, such as 1040A1B2")
+		format  = fs.String("format", "table", "output format: table or json")
+	)
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+
+		return 2
+	}
+
+	if *format != "table" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "unknown output format %q: must be table or json\n", *format)
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	devices, err := hdhomerunexporter.Discover(ctx, *id)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to discover devices: %v\n", err)
+		return 1
+	}
+
+	if *format == "json" {
+		err = printDevicesJSON(os.Stdout, devices)
+	} else {
+		err = printDevicesTable(os.Stdout, devices)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to print devices: %v\n", err)
+		return 1
+	}
+
+	if len(devices) == 0 {
+		// Discovery relies on UDP broadcasts to and replies from port 65001,
+		// which firewalls and VLANs commonly block.
+		fmt.Fprintln(os.Stderr, "no devices found: check that UDP broadcasts on port 65001 reach the devices and that their replies are not blocked by a firewall")
+	}
+
+	return 0
+}
+
+// printDevicesTable prints devices to w as a table.
+func printDevicesTable(w io.Writer, devices []*hdhomerun.DiscoveredDevice) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DEVICE ID\tADDRESS\tTUNERS\tURL")
+	for _, d := range devices {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", d.ID, d.Addr, d.Tuners, deviceURL(d))
+	}
+
+	return tw.Flush()
+}
+
+// printDevicesJSON prints devices to w as a JSON array.
+func printDevicesJSON(w io.Writer, devices []*hdhomerun.DiscoveredDevice) error {
+	ds := make([]discoveredDevice, 0, len(devices))
+	for _, d := range devices {
+		ds = append(ds, discoveredDevice{
+			DeviceID: d.ID,
+			Address:  d.Addr,
+			Tuners:   d.Tuners,
+			URL:      deviceURL(d),
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(ds)
+}
+
+// deviceURL returns the URL of d's web UI, if available.
+func deviceURL(d *hdhomerun.DiscoveredDevice) string {
+	if d.URL == nil {
+		return ""
+	}
+
+	return d.URL.String()
+}
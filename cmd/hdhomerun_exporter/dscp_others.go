@@ -0,0 +1,18 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+)
+
+// setDSCP returns a net.Dialer Control function which always returns an
+// error, because DSCP marking is not supported on this platform.
+func setDSCP(_ int) func(network, address string, c syscall.RawConn) error {
+	return func(_, _ string, _ syscall.RawConn) error {
+		return fmt.Errorf("DSCP marking is not supported on %s", runtime.GOOS)
+	}
+}
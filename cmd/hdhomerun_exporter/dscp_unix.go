@@ -0,0 +1,31 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package main
+
+import "syscall"
+
+// setDSCP returns a net.Dialer Control function which marks all outgoing
+// packets on a socket with the specified DSCP value.
+func setDSCP(dscp int) func(network, address string, c syscall.RawConn) error {
+	// DSCP occupies the upper six bits of the IPv4 TOS and IPv6 traffic
+	// class fields.
+	tos := dscp << 2
+
+	return func(network, _ string, c syscall.RawConn) error {
+		var serr error
+		err := c.Control(func(fd uintptr) {
+			switch network {
+			case "tcp6", "udp6":
+				serr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, tos)
+			default:
+				serr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS, tos)
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		return serr
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envPrefix is the prefix of the environment variables which set flags.
+const envPrefix = "HDHOMERUN_EXPORTER_"
+
+// envName returns the name of the environment variable which sets the flag
+// with the specified name, such as HDHOMERUN_EXPORTER_METRICS_ADDR for
+// -metrics.addr.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(flagName))
+}
+
+// setFlagsFromEnv sets each flag in fs which was not set on the command line
+// using the value of its environment variable, if present, so that the
+// exporter can be configured without templating command lines.
+func setFlagsFromEnv(fs *flag.FlagSet) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		v, ok := os.LookupEnv(envName(f.Name))
+		if !ok || set[f.Name] || err != nil {
+			return
+		}
+
+		if serr := fs.Set(f.Name, v); serr != nil {
+			err = fmt.Errorf("invalid value %q for %s: %v", v, envName(f.Name), serr)
+		}
+	})
+
+	return err
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// newLogger creates a logger which writes to stderr in the specified format,
+// logfmt or json, and only logs messages at or above the specified level.
+func newLogger(lvl, format string) (*slog.Logger, error) {
+	var level slog.Level
+	switch lvl {
+	case "debug":
+		level = slog.LevelDebug
+	case "info":
+		level = slog.LevelInfo
+	case "warn":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	default:
+		return nil, fmt.Errorf("invalid log level %q: must be one of debug, info, warn, or error", lvl)
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+
+	var h slog.Handler
+	switch format {
+	case "logfmt":
+		h = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q: must be one of logfmt or json", format)
+	}
+
+	return slog.New(h), nil
+}
+
+// fatal logs msg and args at the error level using logger and exits.
+func fatal(logger *slog.Logger, msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
@@ -3,49 +3,757 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
-	"log"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/mdlayher/hdhomerun"
 	"github.com/mdlayher/hdhomerun_exporter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/exporter-toolkit/web"
 )
 
 func main() {
+	// Subcommands are dispatched before the exporter's own flags are parsed.
+	if len(os.Args) > 1 && os.Args[1] == "discover" {
+		os.Exit(discover(os.Args[2:]))
+	}
+
 	var (
-		metricsAddr = flag.String("metrics.addr", ":9137", "address for HDHomeRun exporter")
+		showVersion = flag.Bool("version", false, "print the exporter's version and build information, and exit")
+
+		logLevel  = flag.String("log.level", "info", "only log messages at or above this level: debug, info, warn, or error; debug logs the details of each scrape")
+		logFormat = flag.String("log.format", "logfmt", "output format of log messages: logfmt or json")
+
+		configFile = flag.String("config.file", "", "path to an optional YAML configuration file; flags set on the command line take precedence over its settings")
+
 		metricsPath = flag.String("metrics.path", "/metrics", "URL path for surfacing collected metrics")
 
-		hdhrTimeout = flag.Duration("hdhomerun.timeout", 1*time.Second, "timeout value for requests to an HDHomeRun device; use 0 for no timeout")
+		metricsLegacyGauges = flag.Bool("metrics.legacy-counter-gauges", true, "also export cumulative device counters under their deprecated original gauge names without the _total suffix, to ease migration; will default to false in a future release")
+
+		webLogRequests = flag.String("web.log-requests", "none", "log scrape requests, including their target, module, duration, outcome, and client address: none, errors for failed scrapes only, or all")
+
+		webConfigFile = flag.String("web.config.file", "", "path to an exporter-toolkit web configuration file which enables TLS, basic authentication, and HTTP server settings")
+
+		webShutdownTimeout = flag.Duration("web.shutdown-timeout", 30*time.Second, "maximum amount of time to wait for in-flight scrapes to finish on SIGINT or SIGTERM before exiting")
+
+		webReloadTokenFile = flag.String("web.reload.token-file", "", "file containing a bearer token which enables configuration reloads using HTTP POST requests to /-/reload; reloads are also triggered by SIGHUP")
+
+		webReadyRequiresDevice = flag.Bool("web.ready.require-device", false, "report the exporter as ready at /-/ready only once at least one HDHomeRun device has been scraped successfully")
+
+		webStatusPage     = flag.Bool("web.status-page", false, "serve a live HTML status page for HDHomeRun devices at /status")
+		webStatusAPI      = flag.Bool("web.status-api", false, "serve the live status of HDHomeRun devices and their tuners as JSON at /api/v1/status")
+		webStream         = flag.Bool("web.stream", false, "serve live HDHomeRun device status as Server-Sent Events at /stream")
+		webStreamInterval = flag.Duration("web.stream.interval", 1*time.Second, "default interval between device status updates sent at /stream")
+
+		hdhrTimeout        = flag.Duration("hdhomerun.timeout", 1*time.Second, "time allowed for each scrape of an HDHomeRun device, including the dial and every request; use 0 for no timeout")
+		hdhrTimeoutOffset  = flag.Duration("hdhomerun.timeout-offset", 500*time.Millisecond, "offset subtracted from Prometheus's scrape timeout to bound each scrape of an HDHomeRun device")
+		hdhrDefaultPort    = flag.Int("hdhomerun.default-port", 65001, "TCP port used to communicate with HDHomeRun devices whose targets do not specify a port, such as devices reached through NAT port forwarding")
+		hdhrCacheTTL       = flag.Duration("hdhomerun.cache-ttl", 0, "amount of time for which metrics collected from a device are reused by scrapes with identical parameters, such as from highly available Prometheus servers; use 0 to disable caching")
+		hdhrMaxScrapes     = flag.Int("hdhomerun.max-concurrent-scrapes", 0, "maximum number of HDHomeRun devices which may be scraped at once; use 0 for no limit")
+		hdhrPollTargets    = flag.String("hdhomerun.poll-targets", "", "comma-separated list of targets (device IDs or addresses, or auto for every discovered device) to scrape in the background, whose metrics are served from memory")
+		hdhrPollInterval   = flag.Duration("hdhomerun.poll-interval", 15*time.Second, "interval between background scrapes of the targets set by -hdhomerun.poll-targets")
+		hdhrStopPoll       = flag.Duration("hdhomerun.stop-poll-interval", 0, "interval at which the stream stop reasons of scraped devices' tuners are polled in the background, so that hdhomerun_tuner_stream_stops_total counts stops between scrapes; use 0 to disable stop polling")
+		hdhrFailOnError    = flag.Bool("hdhomerun.fail-on-error", false, "fail the entire scrape with an HTTP error when a device cannot be scraped, instead of reporting hdhomerun_up 0")
+		hdhrDiscovery      = flag.Bool("hdhomerun.discovery", false, "resolve targets which are HDHomeRun device IDs, such as 1040A1B2, to device addresses using the discovery protocol")
+		hdhrAllowedTargets = flag.String("hdhomerun.allowed-targets", "", "comma-separated list of targets (device IDs or addresses) which may be scraped; by default, any target may be scraped")
+		hdhrDSCP           = flag.Int("hdhomerun.dscp", 0, "DSCP value (0-63) used to mark control protocol traffic sent to HDHomeRun devices; HTTP API and discovery traffic is not marked; use 0 to leave traffic unmarked")
+	)
+
+	var (
+		addrMap    = make(mapFlag)
+		tuners     = make(mapFlag)
+		skipTuners = make(mapFlag)
+		authFiles  = make(mapFlag)
+		protocols  = make(mapFlag)
+		modules    = make(mapFlag)
+		quirks     = make(mapFlag)
+
+		metricsAddrs stringsFlag
+		hdhrTargets  stringsFlag
 	)
 
+	flag.Var(&metricsAddrs, "metrics.addr", "address for HDHomeRun exporter (default \":9137\"); may be repeated to listen on multiple addresses")
+
+	// Each group of metrics may be disabled entirely, skipping the device
+	// queries it requires, in the style of node_exporter's collectors.
+	collectors := make(map[string]*bool)
+	for _, n := range hdhomerunexporter.Collectors() {
+		collectors[n] = flag.Bool("collector."+n, true, fmt.Sprintf("enable the %s collector; a disabled collector cannot be enabled using the collect[] query parameter", n))
+	}
+
+	flag.Var(&hdhrTargets, "hdhomerun.targets", "target (device ID or address) scraped when the metrics path is requested without the target query parameter, so that a fixed set of devices can be scraped directly; may be repeated")
+	flag.Var(addrMap, "hdhomerun.address-map", "map a logical target (device ID or address) to the address which should be dialed, in target=address form; may be repeated")
+	flag.Var(tuners, "hdhomerun.tuners", "pin the number of tuners collected for a target instead of probing the device, in target=count form; may be repeated")
+	flag.Var(skipTuners, "hdhomerun.skip-tuners", "comma-separated tuner indices which should not be collected for a target, in target=0,1 form; may be repeated")
+	flag.Var(authFiles, "hdhomerun.auth-file", "file containing the device auth token used for a target's HTTP API requests, in target=path form; may be repeated")
+	flag.Var(protocols, "hdhomerun.protocol", "protocol used to scrape a target: both (the default), control, or http for devices which only expose their HTTP API, in target=protocol form; may be repeated")
+	flag.Var(modules, "hdhomerun.module", "module selectable using the module query parameter, in name=option=value,... form with options protocol, timeout, lightweight, tuner_keys (colon-separated), collectors (colon-separated), http_timeout, http_idle_timeout, http_insecure_skip_verify, and http_keep_alives; may be repeated")
+	flag.Var(quirks, "hdhomerun.quirks", "quirks applied to devices with a hardware model, such as HDHR5-4US, in hwmodel=option=value,... form with options missing_keys (colon-separated), no_cablecard, temperature_fahrenheit, and no_debug_signal_strength; may be repeated")
+
 	flag.Parse()
 
+	if *showVersion {
+		fmt.Println(versionString())
+		return
+	}
+
+	if err := setFlagsFromEnv(flag.CommandLine); err != nil {
+		fatal(slog.New(slog.NewTextHandler(os.Stderr, nil)), "invalid environment configuration", "err", err)
+	}
+
+	logger, err := newLogger(*logLevel, *logFormat)
+	if err != nil {
+		fatal(slog.New(slog.NewTextHandler(os.Stderr, nil)), "invalid logging configuration", "err", err)
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fatal(logger, "failed to load configuration file", "err", err)
+	}
+
+	// Flags which are set explicitly, on the command line or using
+	// environment variables, take precedence over the configuration file.
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	if !set["metrics.addr"] {
+		if cfg.ListenAddress != "" {
+			metricsAddrs = append(metricsAddrs, cfg.ListenAddress)
+		}
+		metricsAddrs = append(metricsAddrs, cfg.ListenAddresses...)
+	}
+	if len(metricsAddrs) == 0 {
+		metricsAddrs = stringsFlag{":9137"}
+	}
+	if !set["hdhomerun.targets"] {
+		hdhrTargets = append(hdhrTargets, cfg.StaticTargets...)
+	}
+	if cfg.Timeout != nil && !set["hdhomerun.timeout"] {
+		*hdhrTimeout = *cfg.Timeout
+	}
+	if cfg.TimeoutOffset != nil && !set["hdhomerun.timeout-offset"] {
+		*hdhrTimeoutOffset = *cfg.TimeoutOffset
+	}
+
+	disabled, err := cfg.disabledCollectors(collectors, set)
+	if err != nil {
+		fatal(logger, "invalid collector configuration", "err", err)
+	}
+	if len(disabled) > 0 {
+		logger.Info("disabled collectors", "collectors", strings.Join(disabled, ","))
+	}
+
+	if *hdhrDSCP < 0 || *hdhrDSCP > 63 {
+		fatal(logger, "invalid DSCP value: must be in range 0-63", "dscp", *hdhrDSCP)
+	}
+
+	if *hdhrDefaultPort < 1 || *hdhrDefaultPort > 65535 {
+		fatal(logger, "invalid default port: must be in range 1-65535", "port", *hdhrDefaultPort)
+	}
+
+	modelQuirks, err := quirksConfigs(cfg.quirksConfigs(), quirks)
+	if err != nil {
+		fatal(logger, "invalid quirks configuration", "err", err)
+	}
+
+	var dialer net.Dialer
+	if *hdhrDSCP != 0 {
+		dialer.Control = setDSCP(*hdhrDSCP)
+	}
+
+	// reloadable builds the configuration which may be reloaded at runtime
+	// from the configuration file and the flags which take precedence over
+	// it.
+	reloadable := func(cfg *config) (*reloadConfig, error) {
+		targets, err := cfg.targetConfigs()
+		if err != nil {
+			return nil, fmt.Errorf("invalid target configuration: %v", err)
+		}
+
+		targets, err = targetConfigs(targets, addrMap, tuners, skipTuners, authFiles, protocols)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target configuration: %v", err)
+		}
+
+		mods, err := cfg.moduleConfigs()
+		if err != nil {
+			return nil, fmt.Errorf("invalid module configuration: %v", err)
+		}
+
+		flagMods, err := moduleConfigs(modules)
+		if err != nil {
+			return nil, fmt.Errorf("invalid module configuration: %v", err)
+		}
+		for name, m := range flagMods {
+			mods[name] = m
+		}
+
+		allowed := cfg.AllowedTargets
+		if set["hdhomerun.allowed-targets"] {
+			allowed = nil
+			if *hdhrAllowedTargets != "" {
+				allowed = strings.Split(*hdhrAllowedTargets, ",")
+			}
+		}
+
+		return &reloadConfig{
+			targets: targets,
+			modules: mods,
+			allowed: allowed,
+		}, nil
+	}
+
+	rc, err := reloadable(cfg)
+	if err != nil {
+		fatal(logger, "invalid configuration", "err", err)
+	}
+
 	// dial is the function used to connect to an HDHomeRun device on each
 	// metrics scrape request.
 	dial := func(addr string) (*hdhomerun.Client, error) {
-		c, err := hdhomerun.Dial(addr)
+		conn, err := dialer.Dial("tcp", addr)
 		if err != nil {
 			return nil, err
 		}
 
-		c.SetTimeout(*hdhrTimeout)
+		c, err := hdhomerun.NewClient(conn)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
 
 		return c, nil
 	}
 
-	h := hdhomerunexporter.NewHandler(dial)
+	options := []hdhomerunexporter.HandlerOption{
+		hdhomerunexporter.WithTargets(rc.targets),
+		hdhomerunexporter.WithModules(rc.modules),
+		hdhomerunexporter.WithTimeout(*hdhrTimeout),
+		hdhomerunexporter.WithTimeoutOffset(*hdhrTimeoutOffset),
+		hdhomerunexporter.WithDefaultPort(*hdhrDefaultPort),
+		hdhomerunexporter.WithStreamInterval(*webStreamInterval),
+		hdhomerunexporter.WithCacheTTL(*hdhrCacheTTL),
+		hdhomerunexporter.WithMaxConcurrentScrapes(*hdhrMaxScrapes),
+		hdhomerunexporter.WithFailOnError(*hdhrFailOnError),
+		hdhomerunexporter.WithReadyRequiresDevice(*webReadyRequiresDevice),
+		hdhomerunexporter.WithLegacyCounterGauges(*metricsLegacyGauges),
+		hdhomerunexporter.WithDisabledCollectors(disabled),
+		hdhomerunexporter.WithLogger(logger),
+	}
+
+	if *hdhrDiscovery {
+		options = append(options, hdhomerunexporter.WithDiscovery(hdhomerunexporter.Discover))
+	}
+	if len(modelQuirks) > 0 {
+		options = append(options, hdhomerunexporter.WithQuirks(modelQuirks))
+	}
+	if len(rc.allowed) > 0 {
+		options = append(options, hdhomerunexporter.WithAllowedTargets(rc.allowed))
+	}
+
+	if len(hdhrTargets) > 0 {
+		options = append(options, hdhomerunexporter.WithStaticTargets(hdhrTargets))
+	}
+
+	if *hdhrPollTargets != "" {
+		options = append(options, hdhomerunexporter.WithPolling(strings.Split(*hdhrPollTargets, ","), *hdhrPollInterval))
+	}
+
+	if *hdhrStopPoll > 0 {
+		options = append(options, hdhomerunexporter.WithStopPolling(*hdhrStopPoll))
+	}
+
+	h := hdhomerunexporter.NewHandler(dial, options...)
+
+	pollCtx, stopPolling := context.WithCancel(context.Background())
+	go h.Poll(pollCtx)
+	go h.PollStops(pollCtx)
+
+	// reload reloads the targets, modules, and allowed targets from the
+	// configuration file and flags, without interrupting scrapes.
+	reload := func() error {
+		cfg, err := loadConfig(*configFile)
+		if err != nil {
+			return fmt.Errorf("failed to load configuration file: %v", err)
+		}
+
+		rc, err := reloadable(cfg)
+		if err != nil {
+			return err
+		}
+
+		h.Reload(rc.targets, rc.modules, rc.allowed)
+		return nil
+	}
+
+	go func() {
+		sigC := make(chan os.Signal, 1)
+		signal.Notify(sigC, syscall.SIGHUP)
+
+		for range sigC {
+			if err := reload(); err != nil {
+				logger.Error("failed to reload configuration", "err", err)
+				continue
+			}
+
+			logger.Info("reloaded configuration")
+		}
+	}()
+
+	catalogPath := path.Join(*metricsPath, "catalog")
+	exporterPath := path.Join(*metricsPath, "exporter")
+	links := []hdhomerunexporter.Link{
+		{Path: *metricsPath, Description: "device metrics, using the target query parameter"},
+		{Path: catalogPath, Description: "catalog of the metrics which may be exported"},
+		{Path: exporterPath, Description: "metrics describing the exporter itself"},
+	}
+
+	var metrics http.Handler = h
+	switch *webLogRequests {
+	case "none":
+	case "errors", "all":
+		metrics = hdhomerunexporter.LogRequests(logger, *webLogRequests == "errors", metrics)
+	default:
+		fatal(logger, "invalid request logging level: must be one of none, errors, or all", "level", *webLogRequests)
+	}
+
+	webCfg, err := loadWebConfig(*webConfigFile)
+	if err != nil {
+		fatal(logger, "invalid web configuration file", "err", err)
+	}
+
+	tlsCfg, err := webTLSConfig(webCfg)
+	if err != nil {
+		fatal(logger, "invalid web configuration file", "err", err)
+	}
 
 	mux := http.NewServeMux()
-	mux.Handle(*metricsPath, h)
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		http.Redirect(w, r, *metricsPath, http.StatusMovedPermanently)
-	})
+	mux.Handle(*metricsPath, hdhomerunexporter.InstrumentHandler(prometheus.DefaultRegisterer, metrics))
+	mux.Handle(catalogPath, hdhomerunexporter.NewCatalogHandler())
+	prometheus.MustRegister(newBuildInfo())
+	mux.Handle(exporterPath, promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}),
+	))
+	if *webStatusPage {
+		mux.Handle("/status", h.StatusPage())
+		links = append(links, hdhomerunexporter.Link{Path: "/status", Description: "live device status"})
+	}
+	if *webStatusAPI {
+		mux.Handle("/api/v1/status", h.StatusAPI())
+		links = append(links, hdhomerunexporter.Link{Path: "/api/v1/status", Description: "live device status as JSON"})
+	}
+	if *webStream {
+		mux.Handle("/stream", h.Stream())
+		links = append(links, hdhomerunexporter.Link{Path: "/stream", Description: "live device status as Server-Sent Events"})
+	}
+	mux.Handle("/targets", h.Targets())
+	links = append(links, hdhomerunexporter.Link{Path: "/targets", Description: "known targets and their scrape status"})
+	if *hdhrDiscovery {
+		mux.Handle("/sd", h.ServiceDiscovery())
+		links = append(links, hdhomerunexporter.Link{Path: "/sd", Description: "discovered devices for Prometheus HTTP service discovery"})
+	}
+	if *webReloadTokenFile != "" {
+		b, err := ioutil.ReadFile(*webReloadTokenFile)
+		if err != nil {
+			fatal(logger, "failed to read reload token file", "err", err)
+		}
 
-	log.Printf("starting HDHomeRun exporter on %q", *metricsAddr)
+		token := hdhomerunexporter.Secret(strings.TrimSpace(string(b)))
+		if token == "" {
+			fatal(logger, "reload token file is empty", "file", *webReloadTokenFile)
+		}
+
+		// Basic authentication applies to every endpoint, and would consume
+		// the Authorization header which carries the reload token.
+		if len(webCfg.Users) > 0 {
+			fatal(logger, "the reload token file cannot be used with basic authentication; send SIGHUP to reload instead")
+		}
+
+		mux.Handle("/-/reload", hdhomerunexporter.ReloadHandler(token, reload))
+	}
+	mux.Handle("/-/healthy", h.Healthy())
+	mux.Handle("/-/ready", h.Ready())
+	links = append(links,
+		hdhomerunexporter.Link{Path: "/-/healthy", Description: "health check"},
+		hdhomerunexporter.Link{Path: "/-/ready", Description: "readiness check"},
+	)
+	mux.Handle("/", h.LandingPage(*metricsPath, buildVersion(), links))
+
+	logger.Info("starting HDHomeRun exporter", "version", versionString(), "addrs", metricsAddrs.String(), "tls", tlsCfg != nil)
+
+	// TLS and basic authentication are applied by the exporter-toolkit web
+	// package according to the web configuration file.
+	srv := &http.Server{Handler: mux}
+
+	// Listen on every address before notifying systemd, so that the exporter
+	// is only reported as ready once it can accept connections.
+	lns := make([]net.Listener, 0, len(metricsAddrs))
+	for _, addr := range metricsAddrs {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			fatal(logger, "cannot start HDHomeRun exporter", "addr", addr, "err", err)
+		}
+
+		lns = append(lns, ln)
+	}
+
+	if _, err := sdNotify("READY=1"); err != nil {
+		logger.Warn("failed to notify systemd of readiness", "err", err)
+	}
+
+	interval, err := sdWatchdogInterval()
+	if err != nil {
+		logger.Warn("invalid systemd watchdog configuration", "err", err)
+	}
+	if interval > 0 {
+		// Ping at half the watchdog interval, as recommended by
+		// sd_watchdog_enabled(3), so a single late ping does not cause a restart.
+		// Each ping is sent only once the exporter has answered a request of its
+		// own, so that systemd restarts an exporter which stops serving.
+		check := sdWatchdogCheck(lns[0].Addr(), tlsCfg)
+		go func() {
+			for range time.Tick(interval / 2) {
+				ctx, cancel := context.WithTimeout(context.Background(), interval/2)
+				err := check(ctx)
+				cancel()
+				if err != nil {
+					logger.Warn("exporter failed health check, not pinging systemd watchdog", "err", err)
+					continue
+				}
+
+				if _, err := sdNotify("WATCHDOG=1"); err != nil {
+					logger.Warn("failed to ping systemd watchdog", "err", err)
+				}
+			}
+		}()
+	}
+
+	// On SIGINT or SIGTERM, stop accepting connections and let in-flight
+	// scrapes finish before closing device connections and exiting.
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		sigC := make(chan os.Signal, 1)
+		signal.Notify(sigC, os.Interrupt, syscall.SIGTERM)
+		sig := <-sigC
+
+		logger.Info("shutting down HDHomeRun exporter", "signal", sig, "timeout", *webShutdownTimeout)
+		if _, err := sdNotify("STOPPING=1"); err != nil {
+			logger.Warn("failed to notify systemd of shutdown", "err", err)
+		}
+
+		stopPolling()
+
+		ctx, cancel := context.WithTimeout(context.Background(), *webShutdownTimeout)
+		defer cancel()
+
+		if err := srv.Shutdown(ctx); err != nil {
+			logger.Warn("timed out waiting for in-flight requests", "err", err)
+			_ = srv.Close()
+		}
+
+		_ = h.Close()
+	}()
+
+	// Serve the same handlers on every listener. Shutdown closes all of them.
+	addrs := []string(metricsAddrs)
+	systemdSocket := false
+	flags := &web.FlagConfig{
+		WebListenAddresses: &addrs,
+		WebSystemdSocket:   &systemdSocket,
+		WebConfigFile:      webConfigFile,
+	}
+
+	if err := web.ServeMultiple(lns, srv, flags, logger); err != nil && err != http.ErrServerClosed {
+		fatal(logger, "cannot start HDHomeRun exporter", "err", err)
+	}
+
+	<-stopped
+	logger.Info("stopped HDHomeRun exporter")
+}
+
+// targetConfigs applies the values of the per-target flags to the per-target
+// configuration in targets.
+func targetConfigs(targets map[string]hdhomerunexporter.TargetConfig, addrMap, tuners, skipTuners, authFiles, protocols mapFlag) (map[string]hdhomerunexporter.TargetConfig, error) {
+	for target, addr := range addrMap {
+		tc := targets[target]
+		tc.Address = addr
+		targets[target] = tc
+	}
+
+	for target, s := range tuners {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid tuner count for target %q: %q", target, s)
+		}
+
+		tc := targets[target]
+		tc.Tuners = n
+		targets[target] = tc
+	}
+
+	for target, s := range skipTuners {
+		tc := targets[target]
+		for _, idx := range strings.Split(s, ",") {
+			i, err := strconv.Atoi(idx)
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("invalid tuner index for target %q: %q", target, idx)
+			}
+
+			tc.SkipTuners = append(tc.SkipTuners, i)
+		}
+		targets[target] = tc
+	}
+
+	for target, file := range authFiles {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read auth file for target %q: %v", target, err)
+		}
+
+		tc := targets[target]
+		tc.Auth = hdhomerunexporter.Secret(strings.TrimSpace(string(b)))
+		targets[target] = tc
+	}
+
+	for target, s := range protocols {
+		p, err := parseProtocol(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid protocol for target %q: %v", target, err)
+		}
+
+		tc := targets[target]
+		tc.Protocol = p
+		targets[target] = tc
+	}
+
+	return targets, nil
+}
+
+// tunerKeys validates that each of keys is a supported per-tuner query key,
+// so that a typo does not silently drop metrics.
+func tunerKeys(keys []string) ([]string, error) {
+	valid := make(map[string]bool)
+	for _, k := range hdhomerunexporter.TunerKeys() {
+		valid[k] = true
+	}
+
+	for _, k := range keys {
+		if !valid[k] {
+			return nil, fmt.Errorf("unknown tuner key %q: must be one of %s", k, strings.Join(hdhomerunexporter.TunerKeys(), ", "))
+		}
+	}
+
+	return keys, nil
+}
+
+// collectorNames validates that each of names is the name of a collector.
+func collectorNames(names []string) ([]string, error) {
+	valid := make(map[string]bool)
+	for _, n := range hdhomerunexporter.Collectors() {
+		valid[n] = true
+	}
+
+	for _, n := range names {
+		if !valid[n] {
+			return nil, fmt.Errorf("unknown collector %q: must be one of %s", n, strings.Join(hdhomerunexporter.Collectors(), ", "))
+		}
+	}
+
+	return names, nil
+}
+
+// moduleConfigs builds module configuration from the values of the module
+// flag, each of which is a comma-separated list of key=value options.
+func moduleConfigs(modules mapFlag) (map[string]hdhomerunexporter.Module, error) {
+	mods := make(map[string]hdhomerunexporter.Module)
+
+	for name, s := range modules {
+		var m hdhomerunexporter.Module
+		for _, opt := range strings.Split(s, ",") {
+			kv := strings.SplitN(opt, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("invalid option for module %q: %q", name, opt)
+			}
+
+			switch kv[0] {
+			case "protocol":
+				p, err := parseProtocol(kv[1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid protocol for module %q: %v", name, err)
+				}
+
+				m.Protocol = p
+			case "timeout":
+				d, err := time.ParseDuration(kv[1])
+				if err != nil || d < 0 {
+					return nil, fmt.Errorf("invalid timeout for module %q: %q", name, kv[1])
+				}
+
+				m.Timeout = d
+			case "http_timeout", "http_idle_timeout":
+				d, err := time.ParseDuration(kv[1])
+				if err != nil || d < 0 {
+					return nil, fmt.Errorf("invalid %s for module %q: %q", kv[0], name, kv[1])
+				}
+
+				if kv[0] == "http_timeout" {
+					m.HTTP.Timeout = d
+				} else {
+					m.HTTP.IdleConnTimeout = d
+				}
+			case "lightweight":
+				b, err := strconv.ParseBool(kv[1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid lightweight for module %q: %q", name, kv[1])
+				}
 
-	if err := http.ListenAndServe(*metricsAddr, mux); err != nil {
-		log.Fatalf("cannot start HDHomeRun exporter: %v", err)
+				m.Lightweight = b
+			case "tuner_keys":
+				keys, err := tunerKeys(strings.Split(kv[1], ":"))
+				if err != nil {
+					return nil, fmt.Errorf("invalid tuner_keys for module %q: %v", name, err)
+				}
+
+				m.TunerKeys = keys
+			case "collectors":
+				names, err := collectorNames(strings.Split(kv[1], ":"))
+				if err != nil {
+					return nil, fmt.Errorf("invalid collectors for module %q: %v", name, err)
+				}
+
+				m.Collectors = names
+			case "http_insecure_skip_verify", "http_keep_alives":
+				b, err := strconv.ParseBool(kv[1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s for module %q: %q", kv[0], name, kv[1])
+				}
+
+				if kv[0] == "http_insecure_skip_verify" {
+					m.HTTP.InsecureSkipVerify = b
+				} else {
+					m.HTTP.DisableKeepAlives = !b
+				}
+			default:
+				return nil, fmt.Errorf("unknown option for module %q: %q", name, kv[0])
+			}
+		}
+
+		mods[name] = m
 	}
+
+	return mods, nil
+}
+
+// quirksConfigs applies the values of the quirks flag, each of which is a
+// comma-separated list of key=value options, to the Quirks in quirks, keyed
+// by hardware model. A hardware model set by the flag replaces its Quirks.
+func quirksConfigs(quirks map[string]hdhomerunexporter.Quirks, flags mapFlag) (map[string]hdhomerunexporter.Quirks, error) {
+	for hwmodel, s := range flags {
+		var q hdhomerunexporter.Quirks
+		for _, opt := range strings.Split(s, ",") {
+			kv := strings.SplitN(opt, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("invalid option for quirks %q: %q", hwmodel, opt)
+			}
+
+			switch kv[0] {
+			case "missing_keys":
+				q.MissingKeys = strings.Split(kv[1], ":")
+			case "no_cablecard", "temperature_fahrenheit", "no_debug_signal_strength":
+				b, err := strconv.ParseBool(kv[1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s for quirks %q: %q", kv[0], hwmodel, kv[1])
+				}
+
+				switch kv[0] {
+				case "no_cablecard":
+					q.NoCableCARD = b
+				case "temperature_fahrenheit":
+					q.TemperatureFahrenheit = b
+				case "no_debug_signal_strength":
+					q.NoDebugSignalStrength = b
+				}
+			default:
+				return nil, fmt.Errorf("unknown option for quirks %q: %q", hwmodel, kv[0])
+			}
+		}
+
+		quirks[hwmodel] = q
+	}
+
+	return quirks, nil
+}
+
+// parseProtocol parses a hdhomerunexporter.Protocol from s.
+func parseProtocol(s string) (hdhomerunexporter.Protocol, error) {
+	p := hdhomerunexporter.Protocol(s)
+	switch p {
+	case hdhomerunexporter.ProtocolBoth, hdhomerunexporter.ProtocolControl, hdhomerunexporter.ProtocolHTTP:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown protocol %q", s)
+	}
+}
+
+// A stringsFlag is a flag.Value which accumulates repeated flags into a
+// slice.
+type stringsFlag []string
+
+var _ flag.Value = &stringsFlag{}
+
+func (f *stringsFlag) String() string { return strings.Join(*f, ",") }
+
+func (f *stringsFlag) Set(s string) error {
+	if s == "" {
+		return errors.New("empty value")
+	}
+
+	*f = append(*f, s)
+	return nil
+}
+
+// A mapFlag is a flag.Value which accumulates repeated key=value flags
+// into a map.
+type mapFlag map[string]string
+
+var _ flag.Value = mapFlag{}
+
+func (f mapFlag) String() string {
+	ss := make([]string, 0, len(f))
+	for k, v := range f {
+		ss = append(ss, k+"="+v)
+	}
+	sort.Strings(ss)
+
+	return strings.Join(ss, ",")
+}
+
+func (f mapFlag) Set(s string) error {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+		return fmt.Errorf("invalid key=value pair: %q", s)
+	}
+
+	f[kv[0]] = kv[1]
+	return nil
 }
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sdNotify sends state to the systemd service manager using the socket named
+// by the NOTIFY_SOCKET environment variable, as described in sd_notify(3). It
+// reports whether the notification was sent; if the exporter is not running
+// under a Type=notify unit, it does nothing and returns false.
+func sdNotify(state string) (bool, error) {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" {
+		return false, nil
+	}
+
+	// An abstract socket is named with a leading @, which is replaced by a
+	// NUL byte on the wire.
+	addr := &net.UnixAddr{Name: name, Net: "unixgram"}
+	if name[0] == '@' {
+		addr.Name = "\x00" + name[1:]
+	}
+
+	c, err := net.DialUnix(addr.Net, nil, addr)
+	if err != nil {
+		return false, err
+	}
+	defer c.Close()
+
+	if _, err := c.Write([]byte(state)); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// sdWatchdogInterval returns the interval at which systemd expects watchdog
+// pings, as configured by WatchdogSec= in the exporter's unit. It returns
+// zero if the watchdog is not enabled for this process.
+func sdWatchdogInterval() (time.Duration, error) {
+	s := os.Getenv("WATCHDOG_USEC")
+	if s == "" {
+		return 0, nil
+	}
+
+	// WATCHDOG_PID is set when the watchdog is meant for a specific process,
+	// such as when the exporter is started by a wrapper script.
+	if p := os.Getenv("WATCHDOG_PID"); p != "" {
+		pid, err := strconv.Atoi(p)
+		if err != nil {
+			return 0, err
+		}
+		if pid != os.Getpid() {
+			return 0, nil
+		}
+	}
+
+	usec, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, err
+	}
+
+	return time.Duration(usec) * time.Microsecond, nil
+}
+
+// sdWatchdogCheck returns a function which checks that the exporter is still
+// serving HTTP requests on addr, so that the systemd watchdog is only pinged
+// while the exporter is responsive. If tlsCfg is not nil, the check is made
+// over HTTPS.
+func sdWatchdogCheck(addr net.Addr, tlsCfg *tls.Config) func(ctx context.Context) error {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return func(_ context.Context) error { return err }
+	}
+
+	// A listener on the unspecified address is reached through loopback.
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "localhost"
+	}
+
+	scheme := "http"
+	transport := &http.Transport{DisableKeepAlives: true}
+	if tlsCfg != nil {
+		// The check only needs to know that the exporter responds, so the
+		// exporter's own certificate is neither verified nor required to
+		// match host. It is also presented as a client certificate, in case
+		// client_auth_type requires one.
+		scheme = "https"
+		transport.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: true,
+			GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				if tlsCfg.GetCertificate != nil {
+					return tlsCfg.GetCertificate(&tls.ClientHelloInfo{})
+				}
+				if len(tlsCfg.Certificates) > 0 {
+					return &tlsCfg.Certificates[0], nil
+				}
+
+				return &tls.Certificate{}, nil
+			},
+		}
+	}
+
+	c := &http.Client{Transport: transport}
+	u := scheme + "://" + net.JoinHostPort(host, port) + "/-/healthy"
+
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return err
+		}
+
+		res, err := c.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		_, _ = io.Copy(io.Discard, res.Body)
+
+		// Any response short of a server error means requests are being
+		// served, including 401 when basic authentication is enabled.
+		if res.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("health check returned HTTP %d", res.StatusCode)
+		}
+
+		return nil
+	}
+}
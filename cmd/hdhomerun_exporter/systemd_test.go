@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSDWatchdogCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		tls  bool
+		fn   http.HandlerFunc
+		ok   bool
+	}{
+		{
+			name: "OK",
+			fn:   func(_ http.ResponseWriter, _ *http.Request) {},
+			ok:   true,
+		},
+		{
+			name: "OK TLS",
+			tls:  true,
+			fn:   func(_ http.ResponseWriter, _ *http.Request) {},
+			ok:   true,
+		},
+		{
+			name: "unauthorized",
+			fn: func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+			},
+			ok: true,
+		},
+		{
+			name: "server error",
+			fn: func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+		},
+		{
+			name: "hung",
+			fn: func(_ http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.Handle("/-/healthy", tt.fn)
+
+			var srv *httptest.Server
+			if tt.tls {
+				srv = httptest.NewTLSServer(mux)
+			} else {
+				srv = httptest.NewServer(mux)
+			}
+			defer srv.Close()
+
+			check := sdWatchdogCheck(srv.Listener.Addr(), srv.TLS)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+			defer cancel()
+
+			err := check(ctx)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to check exporter health: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
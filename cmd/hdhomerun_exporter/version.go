@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Build information, set at build time using linker flags such as:
+//
+//	go build -ldflags "-X main.version=v1.0.0 -X main.commit=$(git rev-parse HEAD) -X main.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version = ""
+	commit  = "unknown"
+	date    = "unknown"
+)
+
+// buildVersion returns the exporter's version, falling back to its module
+// version when it is not set at build time, such as when installed using
+// go get.
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		return bi.Main.Version
+	}
+
+	return "unknown"
+}
+
+// versionString returns a description of the exporter's build.
+func versionString() string {
+	return fmt.Sprintf("hdhomerun_exporter %s (commit: %s, date: %s, go: %s)",
+		buildVersion(), commit, date, runtime.Version())
+}
+
+// newBuildInfo returns a prometheus.Collector which exports the exporter's
+// build information, so that dashboards can display which version of the
+// exporter is deployed.
+func newBuildInfo() prometheus.Collector {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "hdhomerun_exporter_build_info",
+		Help: "A metric with a constant '1' value labeled by the version, revision, and Go version from which the exporter was built.",
+		ConstLabels: prometheus.Labels{
+			"version":   buildVersion(),
+			"revision":  commit,
+			"goversion": runtime.Version(),
+		},
+	}, func() float64 { return 1 })
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestBuildInfo(t *testing.T) {
+	// Simulate a build which sets its version using linker flags.
+	defer func(v, c string) {
+		version, commit = v, c
+	}(version, commit)
+	version, commit = "v1.0.0", "abc123"
+
+	want := fmt.Sprintf(`
+# HELP hdhomerun_exporter_build_info A metric with a constant '1' value labeled by the version, revision, and Go version from which the exporter was built.
+# TYPE hdhomerun_exporter_build_info gauge
+hdhomerun_exporter_build_info{goversion=%q,revision="abc123",version="v1.0.0"} 1
+`, runtime.Version())
+
+	if err := testutil.CollectAndCompare(newBuildInfo(), strings.NewReader(want)); err != nil {
+		t.Fatalf("unexpected build info metric: %v", err)
+	}
+}
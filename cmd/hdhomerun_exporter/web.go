@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+
+	"github.com/prometheus/exporter-toolkit/web"
+	"gopkg.in/yaml.v2"
+)
+
+// loadWebConfig validates and parses the web configuration file at path,
+// which is served by the exporter-toolkit web package. If path is empty, an
+// empty configuration is returned, which serves plain HTTP without
+// authentication.
+func loadWebConfig(path string) (*web.Config, error) {
+	if path == "" {
+		return &web.Config{}, nil
+	}
+
+	if err := web.Validate(path); err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// The file was already validated strictly, and is parsed again only to
+	// inspect the settings the exporter itself depends upon.
+	var c web.Config
+	if err := yaml.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	c.TLSConfig.SetDirectory(filepath.Dir(path))
+
+	return &c, nil
+}
+
+// webTLSConfig returns the TLS configuration served according to c, or nil
+// if c serves plain HTTP.
+func webTLSConfig(c *web.Config) (*tls.Config, error) {
+	tc := c.TLSConfig
+	if tc.TLSCertPath == "" && tc.TLSCert == "" {
+		return nil, nil
+	}
+
+	return web.ConfigToTLSConfig(&tc)
+}
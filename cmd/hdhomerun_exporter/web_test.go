@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadWebConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeTestCertificate(t, dir)
+
+	tests := []struct {
+		name  string
+		yaml  string
+		ok    bool
+		tls   bool
+		users int
+	}{
+		{
+			name: "empty",
+			ok:   true,
+		},
+		{
+			// Relative paths are resolved against the file's directory.
+			name: "TLS",
+			yaml: `
+tls_server_config:
+  cert_file: tls.crt
+  key_file: tls.key
+  min_version: TLS13
+  cipher_suites: [TLS_AES_128_GCM_SHA256]
+http_server_config:
+  http2: false
+`,
+			ok:  true,
+			tls: true,
+		},
+		{
+			name: "basic auth",
+			yaml: `
+basic_auth_users:
+  prometheus: $2y$10$QOauhQNbBCuQDKes6eFzPeMqBSjb7Mr5DUmpZ/VcEd00UAV/LDeSi
+`,
+			ok:    true,
+			users: 1,
+		},
+		{
+			name: "missing key",
+			yaml: `
+tls_server_config:
+  cert_file: tls.crt
+`,
+		},
+		{
+			name: "unknown key",
+			yaml: `
+tls_server_config:
+  cert_fiel: tls.crt
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var path string
+			if tt.yaml != "" {
+				path = filepath.Join(dir, "web.yml")
+				if err := os.WriteFile(path, []byte(tt.yaml), 0o600); err != nil {
+					t.Fatalf("failed to write web configuration: %v", err)
+				}
+			}
+
+			c, err := loadWebConfig(path)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to load web configuration: %v", err)
+			}
+			if !tt.ok {
+				if err == nil {
+					t.Fatal("expected an error, but none occurred")
+				}
+
+				return
+			}
+
+			if len(c.Users) != tt.users {
+				t.Fatalf("unexpected number of basic auth users: %d", len(c.Users))
+			}
+
+			tc, err := webTLSConfig(c)
+			if err != nil {
+				t.Fatalf("failed to build TLS configuration: %v", err)
+			}
+			if (tc != nil) != tt.tls {
+				t.Fatalf("unexpected TLS configuration: %+v", tc)
+			}
+		})
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate and its private key
+// to dir as tls.crt and tls.key.
+func writeTestCertificate(t *testing.T, dir string) {
+	t.Helper()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "hdhomerun_exporter"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	kb, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "tls.crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tls.key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb}), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+}
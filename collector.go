@@ -1,8 +1,12 @@
 package hdhomerunexporter
 
 import (
+	"context"
+	"log/slog"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/mdlayher/hdhomerun"
 	"github.com/prometheus/client_golang/prometheus"
@@ -12,166 +16,1382 @@ var _ prometheus.Collector = &collector{}
 
 // A collector is a prometheus.Collector for a device.
 type collector struct {
-	DeviceInfo *prometheus.Desc
-	TunerInfo  *prometheus.Desc
+	Up                    *prometheus.Desc
+	ScrapeError           *prometheus.Desc
+	ScrapeDurationSeconds *prometheus.Desc
+	DataStale             *prometheus.Desc
+	DataAgeSeconds        *prometheus.Desc
+
+	DeviceInfo         *prometheus.Desc
+	DeviceRebootsTotal *prometheus.Desc
+	DeviceUptime       *prometheus.Desc
+	DeviceTuners       *prometheus.Desc
+	DeviceTunersInUse  *prometheus.Desc
+	DeviceFeaturesInfo *prometheus.Desc
+	DeviceTemperature  *prometheus.Desc
+	TunerInfo          *prometheus.Desc
+	TunerErrorsTotal   *prometheus.Desc
+
+	DeviceSignalStrengthRatioMin *prometheus.Desc
+	DeviceSignalStrengthRatioAvg *prometheus.Desc
+	DeviceSignalToNoiseRatioMin  *prometheus.Desc
+	DeviceSignalToNoiseRatioAvg  *prometheus.Desc
+
+	TunerLocked       *prometheus.Desc
+	TunerTargetInfo   *prometheus.Desc
+	TunerVChannelInfo *prometheus.Desc
+	TunerProgramInfo  *prometheus.Desc
+	TunerFilterPIDs   *prometheus.Desc
+	TunerLockedByInfo *prometheus.Desc
+
+	TunerCopyProtectionInfo *prometheus.Desc
+
+	TunerPLPInfo               *prometheus.Desc
+	TunerPLPLocked             *prometheus.Desc
+	TunerPLPSignalToNoiseRatio *prometheus.Desc
+	TunerPLPSymbolErrorRatio   *prometheus.Desc
+
+	TunerTranscodeInfo           *prometheus.Desc
+	TunerTranscodeBytesPerSecond *prometheus.Desc
 
 	TunerSignalStrengthRatio *prometheus.Desc
+	TunerSignalStrengthDBM   *prometheus.Desc
+	TunerFrequency           *prometheus.Desc
+	TunerDebugAGC            *prometheus.Desc
+	TunerDebugOffset         *prometheus.Desc
 	TunerSignalToNoiseRatio  *prometheus.Desc
 	TunerSymbolErrorRatio    *prometheus.Desc
+	TunerSymbolErrorScrapes  *prometheus.Desc
+
+	DeviceStreamBytesPerSecond *prometheus.Desc
+	DeviceStreamResyncs        *prometheus.Desc
+	DeviceStreamOverflows      *prometheus.Desc
+	DeviceStreamResyncsTotal   *prometheus.Desc
+	DeviceStreamOverflowsTotal *prometheus.Desc
 
 	CableCARDBytesPerSecond *prometheus.Desc
 	CableCARDOverflow       *prometheus.Desc
 	CableCARDResync         *prometheus.Desc
+	CableCARDOverflowsTotal *prometheus.Desc
+	CableCARDResyncsTotal   *prometheus.Desc
+
+	CableCARDInfo                   *prometheus.Desc
+	CableCARDAuthorized             *prometheus.Desc
+	CableCARDOOBLocked              *prometheus.Desc
+	CableCARDOOBSignalStrengthRatio *prometheus.Desc
+	CableCARDOOBSignalToNoiseRatio  *prometheus.Desc
+
+	DeviceAuthPresent *prometheus.Desc
+	DeviceDVRActive   *prometheus.Desc
+
+	LineupChannels    *prometheus.Desc
+	LineupDRMChannels *prometheus.Desc
+
+	LineupScanInProgress    *prometheus.Desc
+	LineupScanProgressRatio *prometheus.Desc
+	LineupScanFoundChannels *prometheus.Desc
+
+	TunerHTTPTargetInfo            *prometheus.Desc
+	TunerHTTPNetworkBytesPerSecond *prometheus.Desc
+	TunerHTTPSymbolQualityRatio    *prometheus.Desc
+
+	StorageInfo            *prometheus.Desc
+	StorageTotalBytes      *prometheus.Desc
+	StorageFreeBytes       *prometheus.Desc
+	StorageLiveBufferBytes *prometheus.Desc
+	StorageRecordings      *prometheus.Desc
+
+	DVRActiveRecordings   *prometheus.Desc
+	DVRUpcomingRecordings *prometheus.Desc
+	DVRLiveSessions       *prometheus.Desc
 
 	NetworkPacketsPerSecond *prometheus.Desc
 	NetworkErrors           *prometheus.Desc
+	NetworkErrorsTotal      *prometheus.Desc
+	TunerStreamStopReason   *prometheus.Desc
+	TunerStreamStopsTotal   *prometheus.Desc
+
+	TransportStreamBytesPerSecond       *prometheus.Desc
+	TransportStreamTransportErrors      *prometheus.Desc
+	TransportStreamCRCErrors            *prometheus.Desc
+	TransportStreamTransportErrorsTotal *prometheus.Desc
+	TransportStreamCRCErrorsTotal       *prometheus.Desc
 
-	d device
+	d   device
+	a   api
+	s   *deviceState
+	cfg collectorConfig
+
+	// start, if set, is the time at which the scrape began, such as before
+	// the device was dialed. Otherwise, the scrape begins on Collect.
+	start time.Time
+
+	// caps and quirks are resolved for the device at the start of each
+	// Collect.
+	caps   capabilities
+	quirks Quirks
+
+	// plan is the set of per-tuner query keys used during collection.
+	plan queryPlan
+
+	// discover, if set, is the device's discover.json as fetched earlier in
+	// the scrape.
+	discover *discoverJSON
+
+	// catalog describes each of the metrics the collector may emit.
+	catalog []metricInfo
+
+	// err is the error which occurred during Collect, if any.
+	err error
 }
 
-// newCollector constructs a collector using a device.
-func newCollector(d device) prometheus.Collector {
-	return &collector{
-		DeviceInfo: prometheus.NewDesc(
+// A collectorConfig configures a collector.
+type collectorConfig struct {
+	// Target is the configuration for the target being collected.
+	Target TargetConfig
+
+	// TargetName is the name of the target being collected, as specified by
+	// the scrape.
+	TargetName string
+
+	// Quirks maps device hardware models to their Quirks.
+	Quirks map[string]Quirks
+
+	// Protocol is the protocol used to scrape the device.
+	Protocol Protocol
+
+	// TunerKeys, if set, are the per-tuner query keys which are queried
+	// for each tuner. By default, all supported keys are queried.
+	TunerKeys []string
+
+	// Collectors is the set of enabled groups of metrics. By default, all
+	// collectors are enabled.
+	Collectors collectorSet
+
+	// LegacyCounterGauges also exports cumulative device counters using
+	// their original gauge metric names, which lack the _total suffix.
+	LegacyCounterGauges bool
+
+	// FailOnError reports scrape errors to Prometheus as a failed scrape,
+	// rather than by setting hdhomerun_up to 0.
+	FailOnError bool
+
+	// Logger, if set, logs details of each scrape.
+	Logger *slog.Logger
+
+	// Timeout, if non-zero, is the time allowed for each scrape of the
+	// device. It is used to renew the device's deadline for each update sent
+	// by a long-lived stream.
+	Timeout time.Duration
+}
+
+// newCollector constructs a collector using a device and, optionally, its
+// HTTP API. The deviceState s is used to track the device's counters and
+// capabilities across scrapes, and cfg configures collection for the device.
+func newCollector(d device, a api, s *deviceState, cfg collectorConfig) prometheus.Collector {
+	var b descBuilder
+
+	c := &collector{
+		Up: b.desc(
+			"hdhomerun_up",
+			"Whether the device was successfully scraped.",
+			nil,
+		),
+
+		ScrapeError: b.desc(
+			"hdhomerun_scrape_error",
+			"Information about the error which occurred while scraping the device, if any.",
+			[]string{"target", "class"},
+		),
+
+		ScrapeDurationSeconds: b.desc(
+			"hdhomerun_scrape_duration_seconds",
+			"Amount of time taken to scrape the device, including dialing the device.",
+			nil,
+		),
+
+		DataStale: b.desc(
+			"hdhomerun_data_stale",
+			"Whether the device could not be scraped and its last known metrics are being served from the cache instead.",
+			nil,
+		),
+
+		DataAgeSeconds: b.desc(
+			"hdhomerun_data_age_seconds",
+			"Amount of time since the cached metrics for the device were last scraped successfully.",
+			nil,
+		),
+
+		DeviceInfo: b.desc(
 			"hdhomerun_device_info",
 			"Metadata about the device.",
-			[]string{"model"},
+			[]string{"model", "hwmodel", "firmware", "device_id"},
+		),
+
+		DeviceRebootsTotal: b.desc(
+			"hdhomerun_device_reboots_total",
+			"Total number of device reboots observed by the exporter, detected by the device's uptime going backwards.",
+			nil,
+		),
+
+		DeviceUptime: b.desc(
+			"hdhomerun_device_uptime_seconds",
+			"Amount of time since the device was last booted.",
 			nil,
 		),
 
-		TunerInfo: prometheus.NewDesc(
+		DeviceTuners: b.desc(
+			"hdhomerun_device_tuners",
+			"Number of tuners available to the device.",
+			nil,
+		),
+
+		DeviceTunersInUse: b.desc(
+			"hdhomerun_device_tuners_in_use",
+			"Number of the device's tuners which are tuned to a channel.",
+			nil,
+		),
+
+		DeviceFeaturesInfo: b.desc(
+			"hdhomerun_device_features_info",
+			"Features supported by the device, such as channel maps and modulations, as reported by /sys/features.",
+			[]string{"feature", "value"},
+		),
+
+		DeviceTemperature: b.desc(
+			"hdhomerun_device_temperature_celsius",
+			"Internal temperature of the device in degrees Celsius.",
+			nil,
+		),
+
+		DeviceSignalStrengthRatioMin: b.desc(
+			"hdhomerun_device_signal_strength_ratio_min",
+			"Minimum television signal strength ratio across all of the device's locked tuners.",
+			nil,
+		),
+
+		DeviceSignalStrengthRatioAvg: b.desc(
+			"hdhomerun_device_signal_strength_ratio_avg",
+			"Average television signal strength ratio across all of the device's locked tuners.",
+			nil,
+		),
+
+		DeviceSignalToNoiseRatioMin: b.desc(
+			"hdhomerun_device_signal_to_noise_ratio_min",
+			"Minimum television signal-to-noise ratio across all of the device's locked tuners.",
+			nil,
+		),
+
+		DeviceSignalToNoiseRatioAvg: b.desc(
+			"hdhomerun_device_signal_to_noise_ratio_avg",
+			"Average television signal-to-noise ratio across all of the device's locked tuners.",
+			nil,
+		),
+
+		TunerInfo: b.desc(
 			"hdhomerun_tuner_info",
 			"Metadata about each of the tuners available to a device.",
-			[]string{"tuner", "channel", "lock"},
-			nil,
+			[]string{"tuner", "channel", "channelmap", "lock"},
+		),
+
+		TunerErrorsTotal: b.desc(
+			"hdhomerun_tuner_errors_total",
+			"Total number of scrapes in which metrics for this tuner could not be collected.",
+			[]string{"tuner"},
+		),
+
+		TunerLocked: b.desc(
+			"hdhomerun_tuner_locked",
+			"Whether this tuner is locked on to a channel.",
+			[]string{"tuner"},
+		),
+
+		TunerTargetInfo: b.desc(
+			"hdhomerun_tuner_target_info",
+			"The destination to which each tuner is streaming, or none if idle.",
+			[]string{"tuner", "target"},
+		),
+
+		TunerVChannelInfo: b.desc(
+			"hdhomerun_tuner_vchannel_info",
+			"The virtual channel number each tuner is tuned to, or none if idle.",
+			[]string{"tuner", "vchannel"},
+		),
+
+		TunerProgramInfo: b.desc(
+			"hdhomerun_tuner_program_info",
+			"The program within a multiplex each tuner is demuxing, and its PID filter.",
+			[]string{"tuner", "program", "filter"},
+		),
+
+		TunerFilterPIDs: b.desc(
+			"hdhomerun_tuner_filter_pids",
+			"Number of transport stream PIDs passed by the PID filter for this tuner.",
+			[]string{"tuner"},
+		),
+
+		TunerLockedByInfo: b.desc(
+			"hdhomerun_tuner_locked_by_info",
+			"The address of the client holding the lock on each tuner, or none if unlocked.",
+			[]string{"tuner", "holder"},
+		),
+
+		TunerCopyProtectionInfo: b.desc(
+			"hdhomerun_tuner_copy_protection_info",
+			"The copy protection (CCI and CGMS) flags of the channel each tuner is tuned to.",
+			[]string{"tuner", "cci", "cgms"},
+		),
+
+		TunerPLPInfo: b.desc(
+			"hdhomerun_tuner_plp_info",
+			"Metadata about each ATSC 3.0 physical layer pipe (PLP) received by this tuner.",
+			[]string{"tuner", "plp", "modulation", "code_rate"},
+		),
+
+		TunerPLPLocked: b.desc(
+			"hdhomerun_tuner_plp_locked",
+			"Whether this tuner is locked on to each ATSC 3.0 physical layer pipe (PLP).",
+			[]string{"tuner", "plp"},
 		),
 
-		TunerSignalStrengthRatio: prometheus.NewDesc(
+		TunerPLPSignalToNoiseRatio: b.desc(
+			"hdhomerun_tuner_plp_signal_to_noise_ratio",
+			"Signal-to-noise ratio of each ATSC 3.0 physical layer pipe (PLP) received by this tuner, if reported by the device.",
+			[]string{"tuner", "plp"},
+		),
+
+		TunerPLPSymbolErrorRatio: b.desc(
+			"hdhomerun_tuner_plp_symbol_error_ratio",
+			"Symbol error ratio of each ATSC 3.0 physical layer pipe (PLP) received by this tuner, if reported by the device.",
+			[]string{"tuner", "plp"},
+		),
+
+		TunerTranscodeInfo: b.desc(
+			"hdhomerun_tuner_transcode_info",
+			"The hardware transcode profile in use by this tuner, on devices which support transcoding.",
+			[]string{"tuner", "profile"},
+		),
+
+		TunerTranscodeBytesPerSecond: b.desc(
+			"hdhomerun_tuner_transcode_bytes_per_second",
+			"Number of bytes per second being produced by the hardware encoder for this tuner.",
+			[]string{"tuner"},
+		),
+
+		TunerSignalStrengthRatio: b.desc(
 			"hdhomerun_tuner_signal_strength_ratio",
 			"Television signal strength ratio for this tuner.",
 			[]string{"tuner"},
-			nil,
 		),
 
-		TunerSignalToNoiseRatio: prometheus.NewDesc(
+		TunerSignalStrengthDBM: b.desc(
+			"hdhomerun_tuner_signal_strength_dbm",
+			"Absolute television signal strength in dBm for this tuner, if reported by the device.",
+			[]string{"tuner"},
+		),
+
+		TunerFrequency: b.desc(
+			"hdhomerun_tuner_frequency_hz",
+			"Frequency in Hz of the channel this tuner is tuned to.",
+			[]string{"tuner"},
+		),
+
+		TunerDebugAGC: b.desc(
+			"hdhomerun_tuner_debug_agc",
+			"Raw automatic gain control level reported in the debug field for this tuner. The scale varies by model.",
+			[]string{"tuner"},
+		),
+
+		TunerDebugOffset: b.desc(
+			"hdhomerun_tuner_debug_offset",
+			"Raw carrier offset reported in the debug field for this tuner. The scale varies by model.",
+			[]string{"tuner"},
+		),
+
+		TunerSignalToNoiseRatio: b.desc(
 			"hdhomerun_tuner_signal_to_noise_ratio",
 			"Television signal-to-noise ratio for this tuner.",
 			[]string{"tuner"},
-			nil,
 		),
 
-		TunerSymbolErrorRatio: prometheus.NewDesc(
+		TunerSymbolErrorRatio: b.desc(
 			"hdhomerun_tuner_symbol_error_ratio",
 			"Television symbol error ratio for this tuner.",
 			[]string{"tuner"},
-			nil,
 		),
 
-		CableCARDBytesPerSecond: prometheus.NewDesc(
+		TunerSymbolErrorScrapes: b.desc(
+			"hdhomerun_tuner_symbol_error_scrapes_total",
+			"Total number of scrapes in which this tuner was locked and reported symbol errors, as indicated by a symbol error quality below 100%.",
+			[]string{"tuner"},
+		),
+
+		DeviceStreamBytesPerSecond: b.desc(
+			"hdhomerun_device_stream_bytes_per_second",
+			"Number of bytes per second being processed by the device for this tuner.",
+			[]string{"tuner"},
+		),
+
+		DeviceStreamResyncs: b.desc(
+			"hdhomerun_device_stream_resyncs",
+			"Number of re-sync operations due to missing sync byte in transport stream processed by the device for this tuner.",
+			[]string{"tuner"},
+		),
+
+		DeviceStreamOverflows: b.desc(
+			"hdhomerun_device_stream_overflows",
+			"Number of buffer overflows in the device for this tuner.",
+			[]string{"tuner"},
+		),
+
+		DeviceStreamResyncsTotal: b.desc(
+			"hdhomerun_device_stream_resyncs_total",
+			"Total number of re-sync operations due to missing sync byte in transport stream processed by the device for this tuner, accumulated across device counter resets.",
+			[]string{"tuner"},
+		),
+
+		DeviceStreamOverflowsTotal: b.desc(
+			"hdhomerun_device_stream_overflows_total",
+			"Total number of buffer overflows in the device for this tuner, accumulated across device counter resets.",
+			[]string{"tuner"},
+		),
+
+		CableCARDBytesPerSecond: b.desc(
 			"hdhomerun_cablecard_bytes_per_second",
 			"Number of bytes per second being received by the CableCARD.",
 			nil,
+		),
+
+		CableCARDOverflow: b.desc(
+			"hdhomerun_cablecard_overflow",
+			"Number of buffer overflows for the CableCARD.",
+			nil,
+		),
+
+		CableCARDResync: b.desc(
+			"hdhomerun_cablecard_resync",
+			"Number of re-sync operations due to missing sync byte in transport stream for the CableCARD.",
+			nil,
+		),
+
+		CableCARDOverflowsTotal: b.desc(
+			"hdhomerun_cablecard_overflows_total",
+			"Total number of buffer overflows for the CableCARD, accumulated across device counter resets.",
+			nil,
+		),
+
+		CableCARDResyncsTotal: b.desc(
+			"hdhomerun_cablecard_resyncs_total",
+			"Total number of re-sync operations for the CableCARD, accumulated across device counter resets.",
+			nil,
+		),
+
+		CableCARDInfo: b.desc(
+			"hdhomerun_cablecard_info",
+			"Metadata about the status of the CableCARD, as reported by /card/status.",
+			[]string{"card", "auth", "oob", "act"},
+		),
+
+		CableCARDAuthorized: b.desc(
+			"hdhomerun_cablecard_authorized",
+			"Whether the CableCARD is authorized and validated by the cable provider.",
+			nil,
+		),
+
+		CableCARDOOBLocked: b.desc(
+			"hdhomerun_cablecard_oob_locked",
+			"Whether the CableCARD has locked the out-of-band (OOB) signal from the cable provider.",
+			nil,
+		),
+
+		CableCARDOOBSignalStrengthRatio: b.desc(
+			"hdhomerun_cablecard_oob_signal_strength_ratio",
+			"Out-of-band (OOB) signal strength ratio for the CableCARD.",
+			nil,
+		),
+
+		CableCARDOOBSignalToNoiseRatio: b.desc(
+			"hdhomerun_cablecard_oob_signal_to_noise_ratio",
+			"Out-of-band (OOB) signal-to-noise ratio for the CableCARD.",
+			nil,
+		),
+
+		DeviceAuthPresent: b.backendDesc(
+			backendHTTP,
+			"hdhomerun_device_auth_present",
+			"Whether the device reports a DeviceAuth string, which is required for DVR service.",
+			nil,
+		),
+
+		DeviceDVRActive: b.backendDesc(
+			backendHTTP,
+			"hdhomerun_device_dvr_active",
+			"Whether the device's HDHomeRun DVR service subscription is active, if reported by the device.",
+			nil,
+		),
+
+		LineupChannels: b.backendDesc(
+			backendHTTP,
+			"hdhomerun_lineup_channels",
+			"Number of channels in the device's channel lineup.",
+			nil,
+		),
+
+		LineupDRMChannels: b.backendDesc(
+			backendHTTP,
+			"hdhomerun_lineup_drm_channels",
+			"Number of channels in the device's channel lineup which are protected by DRM.",
+			nil,
+		),
+
+		LineupScanInProgress: b.backendDesc(
+			backendHTTP,
+			"hdhomerun_lineup_scan_in_progress",
+			"Whether a channel scan is in progress on the device. Tuners are unavailable during a scan.",
+			nil,
+		),
+
+		LineupScanProgressRatio: b.backendDesc(
+			backendHTTP,
+			"hdhomerun_lineup_scan_progress_ratio",
+			"Progress ratio of the channel scan in progress on the device.",
+			nil,
+		),
+
+		LineupScanFoundChannels: b.backendDesc(
+			backendHTTP,
+			"hdhomerun_lineup_scan_found_channels",
+			"Number of channels found by the channel scan in progress on the device.",
+			nil,
+		),
+
+		TunerHTTPTargetInfo: b.backendDesc(
+			backendHTTP,
+			"hdhomerun_tuner_http_target_info",
+			"The IP address of the client receiving the stream from this tuner, as reported by the HTTP API.",
+			[]string{"tuner", "target_ip"},
+		),
+
+		TunerHTTPNetworkBytesPerSecond: b.backendDesc(
+			backendHTTP,
+			"hdhomerun_tuner_http_network_bytes_per_second",
+			"Number of bytes per second being streamed over the network by this tuner, as reported by the HTTP API.",
+			[]string{"tuner"},
+		),
+
+		TunerHTTPSymbolQualityRatio: b.backendDesc(
+			backendHTTP,
+			"hdhomerun_tuner_http_symbol_quality_ratio",
+			"Television symbol quality ratio for this tuner, as reported by the HTTP API.",
+			[]string{"tuner"},
+		),
+
+		StorageInfo: b.backendDesc(
+			backendHTTP,
+			"hdhomerun_storage_info",
+			"Metadata about the device's DVR storage.",
+			[]string{"storage_id"},
+		),
+
+		StorageTotalBytes: b.backendDesc(
+			backendHTTP,
+			"hdhomerun_storage_total_bytes",
+			"Total size of the device's DVR storage in bytes.",
+			nil,
+		),
+
+		StorageFreeBytes: b.backendDesc(
+			backendHTTP,
+			"hdhomerun_storage_free_bytes",
+			"Free space on the device's DVR storage in bytes.",
+			nil,
+		),
+
+		StorageLiveBufferBytes: b.backendDesc(
+			backendHTTP,
+			"hdhomerun_storage_live_buffer_bytes",
+			"Space on the device's DVR storage in bytes used by live TV pause buffers, if reported by the device.",
+			nil,
+		),
+
+		StorageRecordings: b.backendDesc(
+			backendHTTP,
+			"hdhomerun_storage_recordings",
+			"Number of recordings listed by the device's DVR storage.",
+			nil,
+		),
+
+		DVRActiveRecordings: b.backendDesc(
+			backendHTTP,
+			"hdhomerun_dvr_active_recordings",
+			"Number of recordings currently in progress on the device's DVR storage.",
+			nil,
+		),
+
+		DVRUpcomingRecordings: b.backendDesc(
+			backendHTTP,
+			"hdhomerun_dvr_upcoming_recordings",
+			"Number of recordings scheduled on the device's DVR storage which have not yet started.",
+			nil,
+		),
+
+		DVRLiveSessions: b.backendDesc(
+			backendHTTP,
+			"hdhomerun_dvr_live_sessions",
+			"Number of live TV sessions currently buffered by the device's DVR storage.",
 			nil,
 		),
 
-		CableCARDOverflow: prometheus.NewDesc(
-			"hdhomerun_cablecard_overflow",
-			"Number of buffer overflows for the CableCARD.",
-			nil,
-			nil,
-		),
+		NetworkPacketsPerSecond: b.desc(
+			"hdhomerun_network_packets_per_second",
+			"Number of packets per second being sent by the device for this tuner.",
+			[]string{"tuner"},
+		),
+
+		NetworkErrors: b.desc(
+			"hdhomerun_network_errors",
+			"Number of device network errors for this tuner.",
+			[]string{"tuner"},
+		),
+
+		NetworkErrorsTotal: b.desc(
+			"hdhomerun_network_errors_total",
+			"Total number of device network errors for this tuner, accumulated across device counter resets.",
+			[]string{"tuner"},
+		),
+
+		TunerStreamStopReason: b.desc(
+			"hdhomerun_tuner_stream_stop_reason",
+			"The reason why the network stream for this tuner stopped, with the current reason set to 1.",
+			[]string{"tuner", "reason"},
+		),
+
+		TunerStreamStopsTotal: b.desc(
+			"hdhomerun_tuner_stream_stops_total",
+			"Total number of times the network stream for this tuner was observed to stop, by reason.",
+			[]string{"tuner", "reason"},
+		),
+
+		TransportStreamBytesPerSecond: b.desc(
+			"hdhomerun_transport_stream_bytes_per_second",
+			"Number of bytes per second in the incoming transport stream for this tuner.",
+			[]string{"tuner"},
+		),
+
+		TransportStreamTransportErrors: b.desc(
+			"hdhomerun_transport_stream_transport_errors",
+			"Number of uncorrectable transport stream packets received by this tuner.",
+			[]string{"tuner"},
+		),
+
+		TransportStreamCRCErrors: b.desc(
+			"hdhomerun_transport_stream_crc_errors",
+			"Number of transport stream CRC errors for this tuner.",
+			[]string{"tuner"},
+		),
+
+		TransportStreamTransportErrorsTotal: b.desc(
+			"hdhomerun_transport_stream_transport_errors_total",
+			"Total number of uncorrectable transport stream packets received by this tuner, accumulated across device counter resets.",
+			[]string{"tuner"},
+		),
+
+		TransportStreamCRCErrorsTotal: b.desc(
+			"hdhomerun_transport_stream_crc_errors_total",
+			"Total number of transport stream CRC errors for this tuner, accumulated across device counter resets.",
+			[]string{"tuner"},
+		),
+
+		d:   d,
+		a:   a,
+		s:   s,
+		cfg: cfg,
+	}
+
+	c.catalog = b.infos
+
+	return c
+}
+
+// Describe implements prometheus.Collector.
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ds := []*prometheus.Desc{
+		c.Up,
+		c.ScrapeError,
+		c.ScrapeDurationSeconds,
+		c.DataStale,
+		c.DataAgeSeconds,
+		c.DeviceInfo,
+		c.DeviceRebootsTotal,
+		c.DeviceUptime,
+		c.DeviceTuners,
+		c.DeviceTunersInUse,
+		c.DeviceFeaturesInfo,
+		c.DeviceTemperature,
+		c.DeviceSignalStrengthRatioMin,
+		c.DeviceSignalStrengthRatioAvg,
+		c.DeviceSignalToNoiseRatioMin,
+		c.DeviceSignalToNoiseRatioAvg,
+		c.TunerInfo,
+		c.TunerErrorsTotal,
+		c.TunerLocked,
+		c.TunerTargetInfo,
+		c.TunerVChannelInfo,
+		c.TunerProgramInfo,
+		c.TunerFilterPIDs,
+		c.TunerLockedByInfo,
+		c.TunerCopyProtectionInfo,
+		c.TunerPLPInfo,
+		c.TunerPLPLocked,
+		c.TunerPLPSignalToNoiseRatio,
+		c.TunerPLPSymbolErrorRatio,
+		c.TunerTranscodeInfo,
+		c.TunerTranscodeBytesPerSecond,
+		c.TunerSignalStrengthRatio,
+		c.TunerSignalStrengthDBM,
+		c.TunerFrequency,
+		c.TunerDebugAGC,
+		c.TunerDebugOffset,
+		c.TunerSignalToNoiseRatio,
+		c.TunerSymbolErrorRatio,
+		c.TunerSymbolErrorScrapes,
+		c.DeviceStreamBytesPerSecond,
+		c.DeviceStreamResyncs,
+		c.DeviceStreamOverflows,
+		c.DeviceStreamResyncsTotal,
+		c.DeviceStreamOverflowsTotal,
+		c.CableCARDBytesPerSecond,
+		c.CableCARDOverflow,
+		c.CableCARDResync,
+		c.CableCARDOverflowsTotal,
+		c.CableCARDResyncsTotal,
+		c.CableCARDInfo,
+		c.CableCARDAuthorized,
+		c.CableCARDOOBLocked,
+		c.CableCARDOOBSignalStrengthRatio,
+		c.CableCARDOOBSignalToNoiseRatio,
+		c.DeviceAuthPresent,
+		c.DeviceDVRActive,
+		c.LineupChannels,
+		c.LineupDRMChannels,
+		c.LineupScanInProgress,
+		c.LineupScanProgressRatio,
+		c.LineupScanFoundChannels,
+		c.TunerHTTPTargetInfo,
+		c.TunerHTTPNetworkBytesPerSecond,
+		c.TunerHTTPSymbolQualityRatio,
+		c.StorageInfo,
+		c.StorageTotalBytes,
+		c.StorageFreeBytes,
+		c.StorageLiveBufferBytes,
+		c.StorageRecordings,
+		c.DVRActiveRecordings,
+		c.DVRUpcomingRecordings,
+		c.DVRLiveSessions,
+		c.NetworkPacketsPerSecond,
+		c.NetworkErrors,
+		c.NetworkErrorsTotal,
+		c.TunerStreamStopReason,
+		c.TunerStreamStopsTotal,
+		c.TransportStreamBytesPerSecond,
+		c.TransportStreamTransportErrors,
+		c.TransportStreamCRCErrors,
+		c.TransportStreamTransportErrorsTotal,
+		c.TransportStreamCRCErrorsTotal,
+	}
+
+	for _, d := range ds {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	start := c.start
+	if start.IsZero() {
+		start = time.Now()
+	}
+
+	var (
+		desc *prometheus.Desc
+		err  error
+	)
+
+	backend := backendControl
+	if c.cfg.Protocol == ProtocolHTTP {
+		backend = backendHTTP
+		desc, err = c.recoverCollect(ch, c.collectHTTP)
+	} else {
+		desc, err = c.recoverCollect(ch, c.collect)
+	}
+	c.s.recordScrape(time.Now(), backend, err)
+	c.err = err
+	c.collectDuration(ch, start)
+
+	c.logger().Debug(
+		"scraped device",
+		"target", c.cfg.TargetName,
+		"backend", backend,
+		"duration", time.Since(start),
+		"err", err,
+	)
+
+	if err != nil && c.cfg.FailOnError {
+		ch <- prometheus.NewInvalidMetric(desc, err)
+		return
+	}
+
+	c.collectUp(ch, err)
+}
+
+// logger returns the logger used to log details of the scrape.
+func (c *collector) logger() *slog.Logger {
+	if c.cfg.Logger == nil {
+		return nopLogger
+	}
+
+	return c.cfg.Logger
+}
+
+// recoverCollect invokes fn to collect metrics, converting any panic into an
+// error so that one malformed device reply cannot crash the exporter.
+func (c *collector) recoverCollect(ch chan<- prometheus.Metric, fn func(ch chan<- prometheus.Metric) (*prometheus.Desc, error)) (desc *prometheus.Desc, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			desc, err = c.Up, &panicError{v: v}
+			c.logger().Error("recovered from panic while scraping device", "target", c.cfg.TargetName, "err", err)
+		}
+	}()
+
+	return fn(ch)
+}
+
+// collectDuration collects the amount of time taken by a scrape which began
+// at start.
+func (c *collector) collectDuration(ch chan<- prometheus.Metric, start time.Time) {
+	ch <- prometheus.MustNewConstMetric(
+		c.ScrapeDurationSeconds,
+		prometheus.GaugeValue,
+		time.Since(start).Seconds(),
+	)
+}
+
+// collectUp collects metrics which indicate whether the device was scraped
+// successfully, using the error returned by the scrape.
+func (c *collector) collectUp(ch chan<- prometheus.Metric, err error) {
+	if err == nil {
+		ch <- prometheus.MustNewConstMetric(c.Up, prometheus.GaugeValue, 1)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.Up, prometheus.GaugeValue, 0)
+	ch <- prometheus.MustNewConstMetric(
+		c.ScrapeError,
+		prometheus.GaugeValue,
+		1,
+		c.cfg.TargetName, errorClass(err),
+	)
+}
+
+// collect collects metrics for the device. If an error occurs, it returns
+// the description of the metric which could not be collected along with the
+// error.
+func (c *collector) collect(ch chan<- prometheus.Metric) (*prometheus.Desc, error) {
+	model, err := c.d.Model()
+	if err != nil {
+		// Report what metadata is available from the HTTP API, so that a
+		// control protocol failure doesn't hide the device's identity.
+		c.collectDiscoverInfo(ch)
+		return c.DeviceInfo, err
+	}
+
+	caps, err := c.s.capabilities(c.probe)
+	if err != nil {
+		return c.DeviceInfo, err
+	}
+	c.caps = caps
+	c.quirks = c.resolveQuirks(caps.HWModel)
+
+	firmware, err := c.query("/sys/version")
+	if err != nil && !notExist(err) {
+		return c.DeviceInfo, err
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		c.DeviceInfo,
+		prometheus.GaugeValue,
+		1,
+		model, caps.HWModel, firmware, caps.DeviceID,
+	)
+
+	c.s.setIdentity(deviceIdentity{
+		DeviceID: caps.DeviceID,
+		Model:    model,
+		HWModel:  caps.HWModel,
+		Firmware: firmware,
+	})
+
+	if err := c.collectUptime(ch); err != nil {
+		return c.DeviceRebootsTotal, err
+	}
+
+	if err := c.collectTemperature(ch); err != nil {
+		return c.DeviceTemperature, err
+	}
+
+	c.collectFeatures(ch)
+
+	if c.caps.CableCARD && c.cfg.Collectors.enabled(collectorCableCARD) {
+		if err := c.collectCardStatus(ch); err != nil {
+			return c.CableCARDInfo, err
+		}
+	}
+
+	// The capabilities are cached per device rather than per protocol, so the
+	// device may have an HTTP API which is not used by this scrape.
+	if c.caps.HTTPAPI && c.a != nil {
+		// discover.json is only needed for some of the HTTP API metrics, so a
+		// failure to fetch it does not prevent collecting the others.
+		var discover *discoverJSON
+		if d, err := c.discoverJSON(); err != nil {
+			c.logger().Debug(
+				"failed to fetch discover.json",
+				"target", c.cfg.TargetName,
+				"err", err,
+			)
+		} else {
+			discover = &d
+		}
+
+		if desc, err := c.collectAPI(ch, discover); err != nil {
+			return desc, err
+		}
+
+		// Storage devices serve a different status.json.
+		if !c.caps.Storage && c.cfg.Collectors.enabled(collectorTuner) {
+			status, err := c.tunerStatusJSON()
+			if err != nil {
+				return c.TunerHTTPTargetInfo, err
+			}
+
+			c.collectTunerStatusJSON(ch, status)
+		}
+	}
+
+	c.plan = newQueryPlan(c.cfg.TunerKeys)
+	if !c.plan.has("debug") {
+		return c.collectWithoutDebug(ch)
+	}
+
+	// All tuners share the path into the CableCARD, and thus, these stats
+	// are identical.
+	//
+	// https://forum.silicondust.com/forum/viewtopic.php?f=125&t=65957
+	var ccOnce sync.Once
+
+	// Signal quality is also aggregated across all tuners.
+	var (
+		sig   signalAggregate
+		inUse int
+
+		// A tuner which fails is reported using its error counter so that
+		// the remaining tuners can be collected, unless every tuner fails.
+		collected int
+		tunerErr  error
+	)
+
+	n, err := c.forEachTuner(func(t tuner) error {
+		tuner := strconv.Itoa(t.Index())
+
+		var ts *hdhomerun.TunerStatus
+		err := bufferTuner(ch, func(ch chan<- prometheus.Metric) error {
+			var err error
+			ts, err = c.collectTunerStats(ch, t, tuner, &ccOnce)
+			return err
+		})
+		c.collectTunerErrors(ch, tuner, err != nil)
+		if err != nil {
+			c.logger().Debug("failed to collect tuner", "target", c.cfg.TargetName, "tuner", tuner, "err", err)
+
+			if tunerErr == nil {
+				tunerErr = err
+			}
+
+			return nil
+		}
+
+		collected++
+
+		if c.cfg.Collectors.enabled(collectorTuner) {
+			sig.add(ts)
+		}
+
+		if tuned(ts) {
+			inUse++
+		}
+
+		return nil
+	})
+	switch {
+	case err != nil && collected == 0:
+		return c.TunerInfo, err
+	case err != nil:
+		// The tuner being probed failed, so no further tuners are known.
+		c.collectTunerErrors(ch, strconv.Itoa(n), true)
+		n++
+	case tunerErr != nil && collected == 0:
+		return c.TunerInfo, tunerErr
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		c.DeviceTuners,
+		prometheus.GaugeValue,
+		float64(n),
+	)
+
+	ch <- prometheus.MustNewConstMetric(
+		c.DeviceTunersInUse,
+		prometheus.GaugeValue,
+		float64(inUse),
+	)
+
+	c.collectSignalAggregate(ch, sig)
+
+	return nil, nil
+}
+
+// collectTunerStats collects metrics for tuner t, labeled by tuner, and
+// returns its status.
+func (c *collector) collectTunerStats(ch chan<- prometheus.Metric, t tuner, tuner string, ccOnce *sync.Once) (*hdhomerun.TunerStatus, error) {
+	stats, err := t.Debug()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.cfg.Collectors.enabled(collectorTuner) {
+		if err := c.collectTunerDebug(ch, tuner, t.Index(), stats.Tuner); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.cfg.Collectors.enabled(collectorStream) {
+		c.collectDeviceStream(ch, tuner, stats.Device)
+	}
+	if c.cfg.Collectors.enabled(collectorNetwork) {
+		c.collectNetwork(ch, tuner, stats.Network)
+	}
+	if c.cfg.Collectors.enabled(collectorTransport) {
+		c.collectTransportStream(ch, tuner, stats.TransportStream)
+	}
+
+	if !c.quirks.NoCableCARD && c.cfg.Collectors.enabled(collectorCableCARD) {
+		ccOnce.Do(func() {
+			c.collectCableCARD(ch, stats.CableCARD)
+		})
+	}
+
+	return stats.Tuner, nil
+}
+
+// stateCounter returns a counter with value v which is maintained by the
+// exporter in its deviceState, including totals accumulated from the device's
+// own counters, and thus was created along with the deviceState.
+func (c *collector) stateCounter(desc *prometheus.Desc, v float64, labelValues ...string) prometheus.Metric {
+	return prometheus.MustNewConstMetricWithCreatedTimestamp(
+		desc,
+		prometheus.CounterValue,
+		v,
+		c.s.created,
+		labelValues...,
+	)
+}
+
+// bufferTuner invokes fn to collect the metrics of a single tuner, and sends
+// them to ch only if fn succeeds, so that a tuner which fails partway through
+// is reported only by its error counter rather than by a partial set of
+// metrics.
+func bufferTuner(ch chan<- prometheus.Metric, fn func(ch chan<- prometheus.Metric) error) error {
+	var (
+		bch = make(chan prometheus.Metric)
+		err error
+		p   interface{}
+	)
+
+	go func() {
+		defer close(bch)
+		defer func() {
+			// Propagate any panic to the caller, where it is recovered
+			// like any other which occurs during Collect.
+			p = recover()
+		}()
+
+		err = fn(bch)
+	}()
+
+	var metrics []prometheus.Metric
+	for m := range bch {
+		metrics = append(metrics, m)
+	}
+
+	if p != nil {
+		panic(p)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, m := range metrics {
+		ch <- m
+	}
+
+	return nil
+}
+
+// collectTunerErrors collects the number of scrapes in which tuner could not
+// be collected, where failed reports whether the current scrape failed.
+func (c *collector) collectTunerErrors(ch chan<- prometheus.Metric, tuner string, failed bool) {
+	ch <- c.stateCounter(
+		c.TunerErrorsTotal,
+		c.s.observeTunerError(tuner, failed),
+		tuner,
+	)
+}
+
+// collectAPI collects metrics which are common to all devices with an HTTP
+// API, using the device's discover.json if it is available. If an error
+// occurs, it returns the description of the metric which could not be
+// collected along with the error.
+func (c *collector) collectAPI(ch chan<- prometheus.Metric, discover *discoverJSON) (*prometheus.Desc, error) {
+	if discover != nil {
+		c.collectDeviceAuth(ch, *discover)
+	}
+
+	if c.cfg.Collectors.enabled(collectorLineup) {
+		if err := c.collectLineup(ch); err != nil {
+			return c.LineupChannels, err
+		}
+		if err := c.collectLineupStatus(ch); err != nil {
+			return c.LineupScanInProgress, err
+		}
+	}
+
+	if c.caps.Storage && c.cfg.Collectors.enabled(collectorStorage) {
+		if discover != nil {
+			if err := c.collectStorage(ch, *discover); err != nil {
+				return c.StorageTotalBytes, err
+			}
+		}
+		if err := c.collectDVR(ch); err != nil {
+			return c.DVRActiveRecordings, err
+		}
+	}
+
+	return nil, nil
+}
+
+// collectDeviceAuth collects the state of the device's DeviceAuth and DVR
+// service subscription from discover.
+func (c *collector) collectDeviceAuth(ch chan<- prometheus.Metric, discover discoverJSON) {
+	ch <- prometheus.MustNewConstMetric(
+		c.DeviceAuthPresent,
+		prometheus.GaugeValue,
+		boolValue(discover.DeviceAuth != ""),
+	)
+
+	// Only devices linked to an HDHomeRun DVR account report the state of
+	// their subscription.
+	if discover.DVRActive != nil {
+		ch <- prometheus.MustNewConstMetric(
+			c.DeviceDVRActive,
+			prometheus.GaugeValue,
+			boolValue(*discover.DVRActive != 0),
+		)
+	}
+}
+
+// resolveQuirks determines the Quirks which apply to the device, preferring
+// any Quirks set in the target's configuration over those looked up by the
+// device's hardware model, and falling back to the Quirks of the device's
+// model family for models which are not listed.
+func (c *collector) resolveQuirks(hwmodel string) Quirks {
+	if q := c.cfg.Target.Quirks; q != nil {
+		return *q
+	}
 
-		CableCARDResync: prometheus.NewDesc(
-			"hdhomerun_cablecard_resync",
-			"Number of re-sync operations due to missing sync byte in transport stream for the CableCARD.",
-			nil,
-			nil,
-		),
+	if q, ok := c.cfg.Quirks[hwmodel]; ok {
+		return q
+	}
 
-		NetworkPacketsPerSecond: prometheus.NewDesc(
-			"hdhomerun_network_packets_per_second",
-			"Number of packets per second being sent by the device for this tuner.",
-			[]string{"tuner"},
-			nil,
-		),
+	return familyQuirks(hwmodel)
+}
 
-		NetworkErrors: prometheus.NewDesc(
-			"hdhomerun_network_errors",
-			"Number of device network errors for this tuner.",
-			[]string{"tuner"},
-			nil,
-		),
+// query performs a device query for key, unless the device's Quirks indicate
+// that key does not exist or a previous query found that key does not exist.
+func (c *collector) query(key string) (string, error) {
+	if c.quirks.missing(key) || c.s.isMissing(key) {
+		return "", errMissingKey
+	}
 
-		d: d,
+	v, err := c.d.Query(key)
+	if hdhomerun.IsNotExist(err) {
+		// Don't query this key again.
+		c.s.setMissing(key)
 	}
+
+	return v, err
 }
 
-// Describe implements prometheus.Collector.
-func (c *collector) Describe(ch chan<- *prometheus.Desc) {
-	ds := []*prometheus.Desc{
-		c.DeviceInfo,
-		c.TunerInfo,
-		c.TunerSignalStrengthRatio,
-		c.TunerSignalToNoiseRatio,
-		c.TunerSymbolErrorRatio,
-		c.CableCARDBytesPerSecond,
-		c.CableCARDOverflow,
-		c.CableCARDResync,
-		c.NetworkPacketsPerSecond,
-		c.NetworkErrors,
+// forEachTuner invokes fn for each of the device's tuners which should be
+// collected, according to the collector's TargetConfig. It returns the number
+// of tuners available to the device, including any tuners which were skipped.
+func (c *collector) forEachTuner(fn func(t tuner) error) (int, error) {
+	return forEachTuner(c.d, c.cfg.Target, fn)
+}
+
+// forEachTuner invokes fn for each of d's tuners which is selected by tc,
+// honoring its pinned tuner count and skipped tuners. It returns the number
+// of tuners found, including those which were skipped.
+func forEachTuner(d device, tc TargetConfig, fn func(t tuner) error) (int, error) {
+	skip := make(map[int]bool, len(tc.SkipTuners))
+	for _, i := range tc.SkipTuners {
+		skip[i] = true
 	}
 
-	for _, d := range ds {
-		ch <- d
+	var n int
+	filter := func(t tuner) error {
+		n++
+		if skip[t.Index()] {
+			return nil
+		}
+
+		return fn(t)
+	}
+
+	if tc.Tuners == 0 {
+		// Tuner count is not known; the device must be probed.
+		err := d.ForEachTuner(filter)
+		return n, err
+	}
+
+	for i := 0; i < tc.Tuners; i++ {
+		if err := filter(d.Tuner(i)); err != nil {
+			return n, err
+		}
 	}
+
+	return n, nil
 }
 
-// Collect implements prometheus.Collector.
-func (c *collector) Collect(ch chan<- prometheus.Metric) {
-	model, err := c.d.Model()
+// collectUptime collects metrics derived from the device's uptime, if the
+// device reports it.
+func (c *collector) collectUptime(ch chan<- prometheus.Metric) error {
+	v, err := c.query("/sys/uptime")
+	switch {
+	case notExist(err):
+		// Uptime is not available on all devices.
+		return nil
+	case err != nil:
+		return err
+	}
+
+	secs, err := strconv.Atoi(strings.TrimSpace(v))
 	if err != nil {
-		ch <- prometheus.NewInvalidMetric(c.DeviceInfo, err)
-		return
+		// Uptime is optional, so a malformed value only omits its metrics.
+		c.logger().Debug("failed to parse device uptime", "target", c.cfg.TargetName, "uptime", v, "err", err)
+		return nil
+	}
+
+	uptime := time.Duration(secs) * time.Second
+
+	// Uptime also decreases when another device answers at the same address,
+	// such as after a DHCP lease changes hands, which is not a reboot.
+	var replaced bool
+	if c.s.uptimeDecreased(uptime) {
+		replaced = c.replaced()
 	}
 
 	ch <- prometheus.MustNewConstMetric(
-		c.DeviceInfo,
+		c.DeviceUptime,
 		prometheus.GaugeValue,
-		1,
-		model,
+		float64(secs),
 	)
 
-	// All tuners share the path into the CableCARD, and thus, these stats
-	// are identical.
-	//
-	// https://forum.silicondust.com/forum/viewtopic.php?f=125&t=65957
-	var ccOnce sync.Once
+	ch <- c.stateCounter(
+		c.DeviceRebootsTotal,
+		c.s.observeUptime(uptime, replaced),
+	)
 
-	err = c.d.ForEachTuner(func(t tuner) error {
-		stats, err := t.Debug()
-		if err != nil {
-			return err
-		}
+	return nil
+}
 
-		tuner := strconv.Itoa(t.Index())
+// replaced determines if the device's ID differs from the ID recorded when its
+// capabilities were probed, indicating that another device was connected.
+func (c *collector) replaced() bool {
+	if c.caps.DeviceID == "" {
+		return false
+	}
 
-		c.collectTuner(ch, tuner, stats.Tuner)
-		c.collectNetwork(ch, tuner, stats.Network)
+	id, err := c.d.Query("/sys/device_id")
+	if err != nil {
+		return false
+	}
 
-		ccOnce.Do(func() {
-			c.collectCableCARD(ch, stats.CableCARD)
-		})
+	return !strings.EqualFold(strings.TrimSpace(id), c.caps.DeviceID)
+}
 
+// collectTemperature collects the device's internal temperature, if the
+// device reports it.
+func (c *collector) collectTemperature(ch chan<- prometheus.Metric) error {
+	v, err := c.query("/sys/temperature")
+	switch {
+	case notExist(err):
+		// Temperature is only available on newer devices.
 		return nil
-	})
+	case err != nil:
+		return err
+	}
+
+	// The value may carry a unit suffix, such as "45C".
+	unit := "C"
+	if c.quirks.TemperatureFahrenheit {
+		unit = "F"
+	}
+
+	celsius, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(v), unit), 64)
 	if err != nil {
-		ch <- prometheus.NewInvalidMetric(c.TunerInfo, err)
-		return
+		return err
+	}
+
+	if c.quirks.TemperatureFahrenheit {
+		celsius = (celsius - 32) * 5 / 9
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		c.DeviceTemperature,
+		prometheus.GaugeValue,
+		celsius,
+	)
+
+	return nil
+}
+
+// collectFeatures collects metrics for the features the device reported
+// when its capabilities were probed.
+func (c *collector) collectFeatures(ch chan<- prometheus.Metric) {
+	for feature, values := range c.caps.Features {
+		for _, v := range values {
+			ch <- prometheus.MustNewConstMetric(
+				c.DeviceFeaturesInfo,
+				prometheus.GaugeValue,
+				1,
+				feature, v,
+			)
+		}
 	}
 }
 
 // collectTuner collects tuner status metrics.
-func (c *collector) collectTuner(ch chan<- prometheus.Metric, tuner string, ts *hdhomerun.TunerStatus) {
+func (c *collector) collectTuner(ch chan<- prometheus.Metric, tuner, channelmap string, ts *hdhomerun.TunerStatus) {
 	if ts == nil {
 		return
 	}
@@ -179,6 +1399,7 @@ func (c *collector) collectTuner(ch chan<- prometheus.Metric, tuner string, ts *
 	labels := []string{
 		tuner,
 		ts.Channel,
+		channelmap,
 		ts.Lock,
 	}
 
@@ -190,6 +1411,10 @@ func (c *collector) collectTuner(ch chan<- prometheus.Metric, tuner string, ts *
 	)
 
 	ds := []descValue{
+		{
+			desc:  c.TunerLocked,
+			value: boolValue(locked(ts)),
+		},
 		{
 			desc:  c.TunerSignalStrengthRatio,
 			value: ratio(ts.SignalStrength),
@@ -204,6 +1429,81 @@ func (c *collector) collectTuner(ch chan<- prometheus.Metric, tuner string, ts *
 		},
 	}
 
+	if v, ok := signalStrengthDBM(ts.Debug); ok && !c.quirks.NoDebugSignalStrength {
+		ds = append(ds, descValue{
+			desc:  c.TunerSignalStrengthDBM,
+			value: v,
+		})
+	}
+
+	if hz, ok := channelFrequency(ts.Channel); ok {
+		ds = append(ds, descValue{
+			desc:  c.TunerFrequency,
+			value: hz,
+		})
+	}
+
+	dbg := parseTunerDebug(ts.Debug)
+	if dbg.AGC != nil {
+		ds = append(ds, descValue{
+			desc:  c.TunerDebugAGC,
+			value: float64(*dbg.AGC),
+		})
+	}
+	if dbg.Offset != nil {
+		ds = append(ds, descValue{
+			desc:  c.TunerDebugOffset,
+			value: float64(*dbg.Offset),
+		})
+	}
+
+	for _, d := range ds {
+		ch <- prometheus.MustNewConstMetric(
+			d.desc,
+			prometheus.GaugeValue,
+			d.value,
+			tuner,
+		)
+	}
+
+	// Devices report symbol errors only as a quality percentage rather than
+	// as a count, so the number of scrapes which observed any symbol errors
+	// is counted to reveal intermittent degradation which the ratio hides.
+	if locked(ts) {
+		ch <- c.stateCounter(
+			c.TunerSymbolErrorScrapes,
+			c.s.observeSymbolErrors(tuner, ts.SymbolErrorQuality < 100),
+			tuner,
+		)
+	}
+}
+
+// collectDeviceStream collects device stream status metrics.
+func (c *collector) collectDeviceStream(ch chan<- prometheus.Metric, tuner string, dev *hdhomerun.DeviceStatus) {
+	if dev == nil {
+		return
+	}
+
+	ds := []descValue{
+		{
+			desc:  c.DeviceStreamBytesPerSecond,
+			value: bytesPerSecond(dev.BitsPerSecond),
+		},
+	}
+
+	if c.cfg.LegacyCounterGauges {
+		ds = append(ds, []descValue{
+			{
+				desc:  c.DeviceStreamResyncs,
+				value: float64(dev.Resync),
+			},
+			{
+				desc:  c.DeviceStreamOverflows,
+				value: float64(dev.Overflow),
+			},
+		}...)
+	}
+
 	for _, d := range ds {
 		ch <- prometheus.MustNewConstMetric(
 			d.desc,
@@ -212,6 +1512,21 @@ func (c *collector) collectTuner(ch chan<- prometheus.Metric, tuner string, ts *
 			tuner,
 		)
 	}
+
+	counters := []descValue{
+		{
+			desc:  c.DeviceStreamResyncsTotal,
+			value: c.s.accumulate("device_stream_resync", tuner, dev.Resync),
+		},
+		{
+			desc:  c.DeviceStreamOverflowsTotal,
+			value: c.s.accumulate("device_stream_overflow", tuner, dev.Overflow),
+		},
+	}
+
+	for _, d := range counters {
+		ch <- c.stateCounter(d.desc, d.value, tuner)
+	}
 }
 
 // collectCableCARD collects CableCARD status metrics.
@@ -225,14 +1540,19 @@ func (c *collector) collectCableCARD(ch chan<- prometheus.Metric, cc *hdhomerun.
 			desc:  c.CableCARDBytesPerSecond,
 			value: bytesPerSecond(cc.BitsPerSecond),
 		},
-		{
-			desc:  c.CableCARDOverflow,
-			value: float64(cc.Overflow),
-		},
-		{
-			desc:  c.CableCARDResync,
-			value: float64(cc.Resync),
-		},
+	}
+
+	if c.cfg.LegacyCounterGauges {
+		ds = append(ds, []descValue{
+			{
+				desc:  c.CableCARDOverflow,
+				value: float64(cc.Overflow),
+			},
+			{
+				desc:  c.CableCARDResync,
+				value: float64(cc.Resync),
+			},
+		}...)
 	}
 
 	for _, d := range ds {
@@ -242,6 +1562,21 @@ func (c *collector) collectCableCARD(ch chan<- prometheus.Metric, cc *hdhomerun.
 			d.value,
 		)
 	}
+
+	counters := []descValue{
+		{
+			desc:  c.CableCARDOverflowsTotal,
+			value: c.s.accumulate("cablecard_overflow", "", cc.Overflow),
+		},
+		{
+			desc:  c.CableCARDResyncsTotal,
+			value: c.s.accumulate("cablecard_resync", "", cc.Resync),
+		},
+	}
+
+	for _, d := range counters {
+		ch <- c.stateCounter(d.desc, d.value)
+	}
 }
 
 // collectNetwork collects network status metrics.
@@ -255,12 +1590,94 @@ func (c *collector) collectNetwork(ch chan<- prometheus.Metric, tuner string, ne
 			desc:  c.NetworkPacketsPerSecond,
 			value: float64(net.PacketsPerSecond),
 		},
-		{
+	}
+
+	if c.cfg.LegacyCounterGauges {
+		ds = append(ds, descValue{
 			desc:  c.NetworkErrors,
 			value: float64(net.Errors),
+		})
+	}
+
+	for _, d := range ds {
+		ch <- prometheus.MustNewConstMetric(
+			d.desc,
+			prometheus.GaugeValue,
+			d.value,
+			tuner,
+		)
+	}
+
+	ch <- c.stateCounter(
+		c.NetworkErrorsTotal,
+		c.s.accumulate("network_errors", tuner, net.Errors),
+		tuner,
+	)
+
+	// Export every known stop reason so the state can be graphed over time,
+	// and any unknown reason reported by the device as well.
+	reason := stopReason(net.Stop)
+	reasons := stopReasons
+	if reason == stopReasonUnknown {
+		reasons = append(reasons[:len(reasons):len(reasons)], stopReasonUnknown)
+	}
+
+	for _, r := range reasons {
+		var v float64
+		if r == reason {
+			v = 1
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			c.TunerStreamStopReason,
+			prometheus.GaugeValue,
+			v,
+			tuner, r,
+		)
+	}
+
+	// Count each time the stream stops, so that stops are quantifiable even
+	// after the stream has been restarted.
+	stops := c.s.observeStop(tuner, reason, reason != stopReasonNotStopped)
+	for _, r := range reasons {
+		if r == stopReasonNotStopped {
+			continue
+		}
+
+		ch <- c.stateCounter(
+			c.TunerStreamStopsTotal,
+			stops[r],
+			tuner, r,
+		)
+	}
+}
+
+// collectTransportStream collects transport stream status metrics.
+func (c *collector) collectTransportStream(ch chan<- prometheus.Metric, tuner string, ts *hdhomerun.TransportStreamStatus) {
+	if ts == nil {
+		return
+	}
+
+	ds := []descValue{
+		{
+			desc:  c.TransportStreamBytesPerSecond,
+			value: bytesPerSecond(ts.BitsPerSecond),
 		},
 	}
 
+	if c.cfg.LegacyCounterGauges {
+		ds = append(ds, []descValue{
+			{
+				desc:  c.TransportStreamTransportErrors,
+				value: float64(ts.TransportErrors),
+			},
+			{
+				desc:  c.TransportStreamCRCErrors,
+				value: float64(ts.CRCErrors),
+			},
+		}...)
+	}
+
 	for _, d := range ds {
 		ch <- prometheus.MustNewConstMetric(
 			d.desc,
@@ -269,11 +1686,64 @@ func (c *collector) collectNetwork(ch chan<- prometheus.Metric, tuner string, ne
 			tuner,
 		)
 	}
+
+	// The signal quality ratios saturate at their extremes, so the raw error
+	// counts are also exported as counters to reveal slow degradation of
+	// reception.
+	counters := []descValue{
+		{
+			desc:  c.TransportStreamTransportErrorsTotal,
+			value: c.s.accumulate("transport_stream_transport_errors", tuner, ts.TransportErrors),
+		},
+		{
+			desc:  c.TransportStreamCRCErrorsTotal,
+			value: c.s.accumulate("transport_stream_crc_errors", tuner, ts.CRCErrors),
+		},
+	}
+
+	for _, d := range counters {
+		ch <- c.stateCounter(d.desc, d.value, tuner)
+	}
+}
+
+// Label values for stop reasons which require special handling.
+const (
+	stopReasonNotStopped = "not_stopped"
+	stopReasonUnknown    = "unknown"
+)
+
+// stopReasons are the label values for each known hdhomerun.StopReason.
+var stopReasons = []string{
+	stopReasonNotStopped,
+	"intentional",
+	"icmp_reject",
+	"connection_loss",
+	"http_connection_close",
+}
+
+// stopReason converts a hdhomerun.StopReason into a label value.
+func stopReason(r hdhomerun.StopReason) string {
+	switch r {
+	case hdhomerun.StopReasonNotStopped:
+		return stopReasons[0]
+	case hdhomerun.StopReasonIntentional:
+		return stopReasons[1]
+	case hdhomerun.StopReasonICMPReject:
+		return stopReasons[2]
+	case hdhomerun.StopReasonConnectionLoss:
+		return stopReasons[3]
+	case hdhomerun.StopReasonHTTPConnectionClose:
+		return stopReasons[4]
+	default:
+		return stopReasonUnknown
+	}
 }
 
 // A device is a wrapper for an HDHomeRun device.
 type device interface {
 	Model() (string, error)
+	Query(query string) (string, error)
+	Tuner(n int) tuner
 	ForEachTuner(func(t tuner) error) error
 }
 
@@ -285,23 +1755,95 @@ type tuner interface {
 
 var _ device = &hdhrDevice{}
 
-// A hdhrDevice is a device which wraps a *hdhomerun.Client.
+// A hdhrDevice is a device which wraps a *hdhomerun.Client. If deadline is
+// set, every request to the device must complete before it.
 type hdhrDevice struct {
-	c *hdhomerun.Client
+	c        *hdhomerun.Client
+	deadline time.Time
+}
+
+func newDevice(c *hdhomerun.Client, deadline time.Time) device {
+	return &hdhrDevice{
+		c:        c,
+		deadline: deadline,
+	}
+}
+
+// renewDeadline allows requests to the device to run for up to the configured
+// timeout from now, so that a collector which is reused over a long period,
+// such as by Stream, is not bound by the deadline of its first request.
+func (c *collector) renewDeadline() {
+	d, ok := c.d.(*hdhrDevice)
+	if !ok || c.cfg.Timeout == 0 {
+		return
+	}
+
+	d.deadline = time.Now().Add(c.cfg.Timeout)
 }
 
-func newDevice(c *hdhomerun.Client) device {
-	return &hdhrDevice{c: c}
+// setTimeout bounds the next request to the device by the time remaining
+// before its deadline.
+func (d *hdhrDevice) setTimeout() error {
+	if d.deadline.IsZero() {
+		return nil
+	}
+
+	timeout := time.Until(d.deadline)
+	if timeout <= 0 {
+		return context.DeadlineExceeded
+	}
+
+	d.c.SetTimeout(timeout)
+	return nil
 }
 
 func (d *hdhrDevice) Model() (string, error) {
+	if err := d.setTimeout(); err != nil {
+		return "", err
+	}
+
 	return d.c.Model()
 }
 
+func (d *hdhrDevice) Query(query string) (string, error) {
+	if err := d.setTimeout(); err != nil {
+		return "", err
+	}
+
+	b, err := d.c.Query(query)
+	if err != nil {
+		return "", err
+	}
+
+	// Trim off any trailing null bytes.
+	return strings.TrimRight(string(b), "\x00"), nil
+}
+
+func (d *hdhrDevice) Tuner(n int) tuner {
+	return &hdhrTuner{
+		t: d.c.Tuner(n),
+		d: d,
+	}
+}
+
 func (d *hdhrDevice) ForEachTuner(fn func(t tuner) error) error {
-	return d.c.ForEachTuner(func(t *hdhomerun.Tuner) error {
-		return fn(&hdhrTuner{t: t})
-	})
+	// This mirrors (*hdhomerun.Client).ForEachTuner, but bounds each probe of
+	// a tuner by the device's deadline.
+	for i := 0; ; i++ {
+		t := d.Tuner(i)
+
+		if _, err := t.Debug(); err != nil {
+			if hdhomerun.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
 }
 
 var _ tuner = &hdhrTuner{}
@@ -309,6 +1851,7 @@ var _ tuner = &hdhrTuner{}
 // A hdhrTuner is a tuner which wraps a *hdhomerun.Tuner.
 type hdhrTuner struct {
 	t *hdhomerun.Tuner
+	d *hdhrDevice
 }
 
 func (t *hdhrTuner) Index() int {
@@ -316,6 +1859,10 @@ func (t *hdhrTuner) Index() int {
 }
 
 func (t *hdhrTuner) Debug() (*hdhomerun.TunerDebug, error) {
+	if err := t.d.setTimeout(); err != nil {
+		return nil, err
+	}
+
 	return t.t.Debug()
 }
 
@@ -324,6 +1871,15 @@ func ratio(percent int) float64 {
 	return float64(percent) / 100
 }
 
+// boolValue converts a boolean into a metric value of 1 or 0.
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
 // bytesPerSecond converts a bits per second measurement into bytes per second.
 func bytesPerSecond(bitsPerSecond int) float64 {
 	return float64(bitsPerSecond) / 8
@@ -3,10 +3,13 @@ package hdhomerunexporter
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -18,6 +21,8 @@ func TestCollector(t *testing.T) {
 	tests := []struct {
 		name    string
 		d       device
+		a       api
+		cfg     collectorConfig
 		metrics []string
 	}{
 		{
@@ -26,13 +31,103 @@ func TestCollector(t *testing.T) {
 				model: "hdhomerun_test",
 			},
 			metrics: []string{
-				`hdhomerun_device_info{model="hdhomerun_test"} 1`,
+				`hdhomerun_device_info{device_id="",firmware="",hwmodel="",model="hdhomerun_test"} 1`,
+				`hdhomerun_device_tuners 0`,
+				`hdhomerun_device_tuners_in_use 0`,
+				`hdhomerun_up 1`,
 			},
 		},
 		{
-			name: "not tuned",
+			name: "uptime",
+			d: &testDevice{
+				model: "hdhomerun_test",
+				queries: map[string]string{
+					"/sys/uptime": "3600",
+				},
+			},
+			metrics: []string{
+				`hdhomerun_device_info{device_id="",firmware="",hwmodel="",model="hdhomerun_test"} 1`,
+				`hdhomerun_device_reboots_total 0`,
+				`hdhomerun_device_tuners 0`,
+				`hdhomerun_device_tuners_in_use 0`,
+				`hdhomerun_device_uptime_seconds 3600`,
+				`hdhomerun_up 1`,
+			},
+		},
+		{
+			name: "malformed uptime",
+			d: &testDevice{
+				model: "hdhomerun_test",
+				queries: map[string]string{
+					"/sys/uptime": "unknown",
+				},
+			},
+			metrics: []string{
+				`hdhomerun_device_info{device_id="",firmware="",hwmodel="",model="hdhomerun_test"} 1`,
+				`hdhomerun_device_tuners 0`,
+				`hdhomerun_device_tuners_in_use 0`,
+				`hdhomerun_up 1`,
+			},
+		},
+		{
+			name: "temperature",
 			d: &testDevice{
 				model: "hdhomerun_test",
+				queries: map[string]string{
+					"/sys/temperature": "45C",
+				},
+			},
+			metrics: []string{
+				`hdhomerun_device_info{device_id="",firmware="",hwmodel="",model="hdhomerun_test"} 1`,
+				`hdhomerun_device_temperature_celsius 45`,
+				`hdhomerun_device_tuners 0`,
+				`hdhomerun_device_tuners_in_use 0`,
+				`hdhomerun_up 1`,
+			},
+		},
+		{
+			name: "temperature in Fahrenheit",
+			d: &testDevice{
+				model: "hdhomerun_test",
+				queries: map[string]string{
+					"/sys/temperature": "113F",
+				},
+			},
+			cfg: collectorConfig{
+				Target: TargetConfig{Quirks: &Quirks{TemperatureFahrenheit: true}},
+			},
+			metrics: []string{
+				`hdhomerun_device_info{device_id="",firmware="",hwmodel="",model="hdhomerun_test"} 1`,
+				`hdhomerun_device_temperature_celsius 45`,
+				`hdhomerun_device_tuners 0`,
+				`hdhomerun_device_tuners_in_use 0`,
+				`hdhomerun_up 1`,
+			},
+		},
+		{
+			name: "features",
+			d: &testDevice{
+				model: "hdhomerun_test",
+				queries: map[string]string{
+					"/sys/features": "channelmap: us-bcast us-cable\nmodulation: 8vsb qam256\n",
+				},
+			},
+			metrics: []string{
+				`hdhomerun_device_features_info{feature="channelmap",value="us-bcast"} 1`,
+				`hdhomerun_device_features_info{feature="channelmap",value="us-cable"} 1`,
+				`hdhomerun_device_features_info{feature="modulation",value="8vsb"} 1`,
+				`hdhomerun_device_features_info{feature="modulation",value="qam256"} 1`,
+				`hdhomerun_device_info{device_id="",firmware="",hwmodel="",model="hdhomerun_test"} 1`,
+				`hdhomerun_device_tuners 0`,
+				`hdhomerun_device_tuners_in_use 0`,
+				`hdhomerun_up 1`,
+			},
+		},
+		{
+			name: "not tuned",
+			d: &testDevice{
+				model:   "hdhomerun_test",
+				queries: primeQueries,
 				tuners: []testTuner{{
 					index: 0,
 					debug: &hdhomerun.TunerDebug{
@@ -48,22 +143,46 @@ func TestCollector(t *testing.T) {
 				}},
 			},
 			metrics: []string{
+				`hdhomerun_cablecard_authorized 1`,
+				`hdhomerun_cablecard_info{act="success",auth="success",card="ready",oob="success"} 1`,
+				`hdhomerun_cablecard_oob_locked 1`,
 				`hdhomerun_cablecard_bytes_per_second 0`,
-				`hdhomerun_cablecard_overflow 0`,
-				`hdhomerun_cablecard_resync 0`,
-				`hdhomerun_device_info{model="hdhomerun_test"} 1`,
-				`hdhomerun_network_errors{tuner="0"} 0`,
+				`hdhomerun_cablecard_overflows_total 0`,
+				`hdhomerun_cablecard_resyncs_total 0`,
+				`hdhomerun_device_info{device_id="1040A1B2",firmware="20190621",hwmodel="HDHR3-CC",model="hdhomerun_test"} 1`,
+				`hdhomerun_device_stream_bytes_per_second{tuner="0"} 0`,
+				`hdhomerun_device_stream_overflows_total{tuner="0"} 0`,
+				`hdhomerun_device_stream_resyncs_total{tuner="0"} 0`,
+				`hdhomerun_device_tuners 1`,
+				`hdhomerun_device_tuners_in_use 0`,
+				`hdhomerun_network_errors_total{tuner="0"} 0`,
 				`hdhomerun_network_packets_per_second{tuner="0"} 0`,
-				`hdhomerun_tuner_info{channel="none",lock="none",tuner="0"} 1`,
+				`hdhomerun_transport_stream_bytes_per_second{tuner="0"} 0`,
+				`hdhomerun_transport_stream_crc_errors_total{tuner="0"} 0`,
+				`hdhomerun_transport_stream_transport_errors_total{tuner="0"} 0`,
+				`hdhomerun_tuner_errors_total{tuner="0"} 0`,
+				`hdhomerun_tuner_info{channel="none",channelmap="",lock="none",tuner="0"} 1`,
+				`hdhomerun_tuner_locked{tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="connection_loss",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="http_connection_close",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="icmp_reject",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="intentional",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="not_stopped",tuner="0"} 1`,
+				`hdhomerun_tuner_stream_stops_total{reason="connection_loss",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stops_total{reason="http_connection_close",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stops_total{reason="icmp_reject",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stops_total{reason="intentional",tuner="0"} 0`,
 				`hdhomerun_tuner_signal_strength_ratio{tuner="0"} 0`,
 				`hdhomerun_tuner_signal_to_noise_ratio{tuner="0"} 0`,
 				`hdhomerun_tuner_symbol_error_ratio{tuner="0"} 0`,
+				`hdhomerun_up 1`,
 			},
 		},
 		{
 			name: "tuned",
 			d: &testDevice{
-				model: "hdhomerun_test",
+				model:   "hdhomerun_test",
+				queries: primeQueries,
 				tuners: []testTuner{
 					{
 						index: 0,
@@ -74,6 +193,7 @@ func TestCollector(t *testing.T) {
 								SignalStrength:       100,
 								SignalToNoiseQuality: 100,
 								SymbolErrorQuality:   100,
+								Debug:                "-383/-6666",
 							},
 							Device: &hdhomerun.DeviceStatus{
 								BitsPerSecond: 38809216,
@@ -113,29 +233,736 @@ func TestCollector(t *testing.T) {
 				},
 			},
 			metrics: []string{
+				`hdhomerun_cablecard_authorized 1`,
+				`hdhomerun_cablecard_info{act="success",auth="success",card="ready",oob="success"} 1`,
+				`hdhomerun_cablecard_oob_locked 1`,
 				`hdhomerun_cablecard_bytes_per_second 4.85134e+06`,
-				`hdhomerun_cablecard_overflow 1`,
-				`hdhomerun_cablecard_resync 1`,
-				`hdhomerun_device_info{model="hdhomerun_test"} 1`,
-				`hdhomerun_network_errors{tuner="0"} 1`,
-				`hdhomerun_network_errors{tuner="1"} 0`,
+				`hdhomerun_cablecard_overflows_total 1`,
+				`hdhomerun_cablecard_resyncs_total 1`,
+				`hdhomerun_device_info{device_id="1040A1B2",firmware="20190621",hwmodel="HDHR3-CC",model="hdhomerun_test"} 1`,
+				`hdhomerun_device_stream_bytes_per_second{tuner="0"} 4.851152e+06`,
+				`hdhomerun_device_stream_bytes_per_second{tuner="1"} 0`,
+				`hdhomerun_device_stream_overflows_total{tuner="0"} 1`,
+				`hdhomerun_device_stream_overflows_total{tuner="1"} 0`,
+				`hdhomerun_device_stream_resyncs_total{tuner="0"} 1`,
+				`hdhomerun_device_stream_resyncs_total{tuner="1"} 0`,
+				`hdhomerun_device_signal_strength_ratio_avg 1`,
+				`hdhomerun_device_signal_strength_ratio_min 1`,
+				`hdhomerun_device_signal_to_noise_ratio_avg 1`,
+				`hdhomerun_device_signal_to_noise_ratio_min 1`,
+				`hdhomerun_device_tuners 2`,
+				`hdhomerun_device_tuners_in_use 1`,
+				`hdhomerun_network_errors_total{tuner="0"} 1`,
+				`hdhomerun_network_errors_total{tuner="1"} 0`,
 				`hdhomerun_network_packets_per_second{tuner="0"} 241`,
 				`hdhomerun_network_packets_per_second{tuner="1"} 0`,
-				`hdhomerun_tuner_info{channel="qam:381000000",lock="qam256:381000000",tuner="0"} 1`,
-				`hdhomerun_tuner_info{channel="none",lock="none",tuner="1"} 1`,
+				`hdhomerun_transport_stream_bytes_per_second{tuner="0"} 316780`,
+				`hdhomerun_transport_stream_bytes_per_second{tuner="1"} 0`,
+				`hdhomerun_transport_stream_crc_errors_total{tuner="0"} 1`,
+				`hdhomerun_transport_stream_crc_errors_total{tuner="1"} 0`,
+				`hdhomerun_transport_stream_transport_errors_total{tuner="0"} 1`,
+				`hdhomerun_transport_stream_transport_errors_total{tuner="1"} 0`,
+				`hdhomerun_tuner_errors_total{tuner="0"} 0`,
+				`hdhomerun_tuner_errors_total{tuner="1"} 0`,
+				`hdhomerun_tuner_info{channel="qam:381000000",channelmap="",lock="qam256:381000000",tuner="0"} 1`,
+				`hdhomerun_tuner_locked{tuner="0"} 1`,
+				`hdhomerun_tuner_stream_stop_reason{reason="connection_loss",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="http_connection_close",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="icmp_reject",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="intentional",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="not_stopped",tuner="0"} 1`,
+				`hdhomerun_tuner_stream_stops_total{reason="connection_loss",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stops_total{reason="http_connection_close",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stops_total{reason="icmp_reject",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stops_total{reason="intentional",tuner="0"} 0`,
+				`hdhomerun_tuner_info{channel="none",channelmap="",lock="none",tuner="1"} 1`,
+				`hdhomerun_tuner_locked{tuner="1"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="connection_loss",tuner="1"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="http_connection_close",tuner="1"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="icmp_reject",tuner="1"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="intentional",tuner="1"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="not_stopped",tuner="1"} 1`,
+				`hdhomerun_tuner_stream_stops_total{reason="connection_loss",tuner="1"} 0`,
+				`hdhomerun_tuner_stream_stops_total{reason="http_connection_close",tuner="1"} 0`,
+				`hdhomerun_tuner_stream_stops_total{reason="icmp_reject",tuner="1"} 0`,
+				`hdhomerun_tuner_stream_stops_total{reason="intentional",tuner="1"} 0`,
+				`hdhomerun_tuner_debug_agc{tuner="0"} -6666`,
+				`hdhomerun_tuner_frequency_hz{tuner="0"} 3.81e+08`,
+				`hdhomerun_tuner_signal_strength_dbm{tuner="0"} -38.3`,
 				`hdhomerun_tuner_signal_strength_ratio{tuner="0"} 1`,
 				`hdhomerun_tuner_signal_strength_ratio{tuner="1"} 0`,
 				`hdhomerun_tuner_signal_to_noise_ratio{tuner="0"} 1`,
 				`hdhomerun_tuner_signal_to_noise_ratio{tuner="1"} 0`,
 				`hdhomerun_tuner_symbol_error_ratio{tuner="0"} 1`,
+				`hdhomerun_tuner_symbol_error_scrapes_total{tuner="0"} 0`,
 				`hdhomerun_tuner_symbol_error_ratio{tuner="1"} 0`,
+				`hdhomerun_up 1`,
+			},
+		},
+		{
+			name: "scrape error",
+			d: &testDevice{
+				model: "hdhomerun_test",
+				tuners: []testTuner{{
+					index: 0,
+					err:   &hdhomerun.Error{Message: "resource locked"},
+				}},
+			},
+			metrics: []string{
+				`hdhomerun_device_info{device_id="",firmware="",hwmodel="",model="hdhomerun_test"} 1`,
+				`hdhomerun_scrape_error{class="query",target=""} 1`,
+				`hdhomerun_tuner_errors_total{tuner="0"} 1`,
+				`hdhomerun_up 0`,
+			},
+		},
+		{
+			name: "panic",
+			d: &testDevice{
+				model: "hdhomerun_test",
+				// A tuner which reports no error and no debug output.
+				tuners: []testTuner{{index: 0}},
+			},
+			metrics: []string{
+				`hdhomerun_device_info{device_id="",firmware="",hwmodel="",model="hdhomerun_test"} 1`,
+				`hdhomerun_scrape_error{class="panic",target=""} 1`,
+				`hdhomerun_up 0`,
+			},
+		},
+		{
+			name: "discover fallback",
+			d: &testDevice{
+				modelErr: errors.New("connection reset"),
+			},
+			a: &testAPI{
+				paths: map[string]interface{}{
+					"/discover.json": discoverJSON{
+						ModelNumber:     "HDHR5-4US",
+						FirmwareVersion: "20200101",
+						DeviceID:        "1040A1B2",
+					},
+				},
+			},
+			metrics: []string{
+				`hdhomerun_device_info{device_id="1040A1B2",firmware="20200101",hwmodel="HDHR5-4US",model="HDHR5-4US"} 1`,
+				`hdhomerun_scrape_error{class="unknown",target=""} 1`,
+				`hdhomerun_up 0`,
+			},
+		},
+		{
+			name: "pinned tuners",
+			d: &testDevice{
+				model:   "hdhomerun_test",
+				queries: primeQueries,
+				tuners: []testTuner{
+					{index: 0, debug: idleDebug()},
+					{index: 1, debug: idleDebug()},
+				},
+			},
+			cfg: collectorConfig{
+				Target: TargetConfig{Tuners: 1},
+			},
+			metrics: idleTunerMetrics("0", 1),
+		},
+		{
+			name: "skipped tuner",
+			d: &testDevice{
+				model:   "hdhomerun_test",
+				queries: primeQueries,
+				tuners: []testTuner{
+					{index: 0, err: errors.New("dead tuner")},
+					{index: 1, debug: idleDebug()},
+				},
+			},
+			cfg: collectorConfig{
+				Target: TargetConfig{SkipTuners: []int{0}},
+			},
+			metrics: idleTunerMetrics("1", 2),
+		},
+		{
+			name: "tuner error",
+			d: &testDevice{
+				model:   "hdhomerun_test",
+				queries: primeQueries,
+				tuners: []testTuner{
+					{index: 0, err: errors.New("dead tuner")},
+					{index: 1, debug: idleDebug()},
+				},
+			},
+			metrics: append(
+				idleTunerMetrics("1", 2),
+				`hdhomerun_tuner_errors_total{tuner="0"} 1`,
+			),
+		},
+		{
+			name: "tuner keys",
+			d: &testDevice{
+				model: "hdhomerun_test",
+				queries: mergeQueries(primeQueries, map[string]string{
+					"/tuner0/target":     "rtp://192.168.1.5:5000",
+					"/tuner0/channelmap": "us-bcast",
+					"/tuner0/vchannel":   "5.1",
+					"/tuner0/lockkey":    "192.168.1.20",
+					"/tuner0/vstatus":    "vch=5.1 name=WABC auth=subscribed cci=copy-once cgms=none",
+					"/tuner0/program":    "3",
+					"/tuner0/filter":     "0x0000 0x0030-0x0033",
+				}),
+				tuners: []testTuner{{index: 0, debug: idleDebug()}},
+			},
+			metrics: append(
+				idleTunerMetrics("0", 1),
+				`hdhomerun_tuner_info{channel="none",channelmap="us-bcast",lock="none",tuner="0"} 1`,
+				`hdhomerun_tuner_locked{tuner="0"} 0`,
+				`hdhomerun_tuner_copy_protection_info{cci="copy-once",cgms="none",tuner="0"} 1`,
+				`hdhomerun_tuner_locked_by_info{holder="192.168.1.20",tuner="0"} 1`,
+				`hdhomerun_tuner_filter_pids{tuner="0"} 5`,
+				`hdhomerun_tuner_program_info{filter="0x0000 0x0030-0x0033",program="3",tuner="0"} 1`,
+				`hdhomerun_tuner_target_info{target="rtp://192.168.1.5:5000",tuner="0"} 1`,
+				`hdhomerun_tuner_vchannel_info{tuner="0",vchannel="5.1"} 1`,
+			),
+		},
+		{
+			name: "no tuner status",
+			d: &testDevice{
+				model: "hdhomerun_test",
+				tuners: []testTuner{{index: 0, debug: &hdhomerun.TunerDebug{
+					Device:          &hdhomerun.DeviceStatus{},
+					TransportStream: &hdhomerun.TransportStreamStatus{},
+					Network:         &hdhomerun.NetworkStatus{},
+				}}},
+			},
+			metrics: []string{
+				`hdhomerun_device_info{device_id="",firmware="",hwmodel="",model="hdhomerun_test"} 1`,
+				`hdhomerun_device_stream_bytes_per_second{tuner="0"} 0`,
+				`hdhomerun_device_stream_overflows_total{tuner="0"} 0`,
+				`hdhomerun_device_stream_resyncs_total{tuner="0"} 0`,
+				`hdhomerun_device_tuners 1`,
+				`hdhomerun_device_tuners_in_use 0`,
+				`hdhomerun_network_errors_total{tuner="0"} 0`,
+				`hdhomerun_network_packets_per_second{tuner="0"} 0`,
+				`hdhomerun_transport_stream_bytes_per_second{tuner="0"} 0`,
+				`hdhomerun_transport_stream_crc_errors_total{tuner="0"} 0`,
+				`hdhomerun_transport_stream_transport_errors_total{tuner="0"} 0`,
+				`hdhomerun_tuner_errors_total{tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="connection_loss",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="http_connection_close",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="icmp_reject",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="intentional",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="not_stopped",tuner="0"} 1`,
+				`hdhomerun_tuner_stream_stops_total{reason="connection_loss",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stops_total{reason="http_connection_close",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stops_total{reason="icmp_reject",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stops_total{reason="intentional",tuner="0"} 0`,
+				`hdhomerun_up 1`,
+			},
+		},
+		{
+			name: "ATSC 3.0",
+			d: &testDevice{
+				model: "hdhomerun_test",
+				queries: map[string]string{
+					"/sys/features":   "modulation: 8vsb atsc3\n",
+					"/tuner0/plpinfo": "0: mod=qam256 cod=10/15 lock=1 snq=85 seq=100\n",
+				},
+				tuners: []testTuner{{index: 0, debug: &hdhomerun.TunerDebug{
+					Tuner: &hdhomerun.TunerStatus{
+						Channel: "none",
+						Lock:    "none",
+					},
+				}}},
+			},
+			metrics: []string{
+				`hdhomerun_device_features_info{feature="modulation",value="8vsb"} 1`,
+				`hdhomerun_device_features_info{feature="modulation",value="atsc3"} 1`,
+				`hdhomerun_device_info{device_id="",firmware="",hwmodel="",model="hdhomerun_test"} 1`,
+				`hdhomerun_device_tuners 1`,
+				`hdhomerun_device_tuners_in_use 0`,
+				`hdhomerun_tuner_errors_total{tuner="0"} 0`,
+				`hdhomerun_tuner_info{channel="none",channelmap="",lock="none",tuner="0"} 1`,
+				`hdhomerun_tuner_locked{tuner="0"} 0`,
+				`hdhomerun_tuner_plp_info{code_rate="10/15",modulation="qam256",plp="0",tuner="0"} 1`,
+				`hdhomerun_tuner_plp_locked{plp="0",tuner="0"} 1`,
+				`hdhomerun_tuner_plp_signal_to_noise_ratio{plp="0",tuner="0"} 0.85`,
+				`hdhomerun_tuner_plp_symbol_error_ratio{plp="0",tuner="0"} 1`,
+				`hdhomerun_tuner_signal_strength_ratio{tuner="0"} 0`,
+				`hdhomerun_tuner_signal_to_noise_ratio{tuner="0"} 0`,
+				`hdhomerun_tuner_symbol_error_ratio{tuner="0"} 0`,
+				`hdhomerun_up 1`,
+			},
+		},
+		{
+			name: "transcode",
+			d: &testDevice{
+				model: "hdhomerun_test",
+				queries: map[string]string{
+					"/sys/features":     "transcode: heavy mobile\n",
+					"/tuner0/transcode": "profile=mobile bitrate=2000000",
+				},
+				tuners: []testTuner{{index: 0, debug: &hdhomerun.TunerDebug{
+					Tuner: &hdhomerun.TunerStatus{
+						Channel: "none",
+						Lock:    "none",
+					},
+				}}},
+			},
+			metrics: []string{
+				`hdhomerun_device_features_info{feature="transcode",value="heavy"} 1`,
+				`hdhomerun_device_features_info{feature="transcode",value="mobile"} 1`,
+				`hdhomerun_device_info{device_id="",firmware="",hwmodel="",model="hdhomerun_test"} 1`,
+				`hdhomerun_device_tuners 1`,
+				`hdhomerun_device_tuners_in_use 0`,
+				`hdhomerun_tuner_errors_total{tuner="0"} 0`,
+				`hdhomerun_tuner_info{channel="none",channelmap="",lock="none",tuner="0"} 1`,
+				`hdhomerun_tuner_locked{tuner="0"} 0`,
+				`hdhomerun_tuner_signal_strength_ratio{tuner="0"} 0`,
+				`hdhomerun_tuner_signal_to_noise_ratio{tuner="0"} 0`,
+				`hdhomerun_tuner_symbol_error_ratio{tuner="0"} 0`,
+				`hdhomerun_tuner_transcode_bytes_per_second{tuner="0"} 250000`,
+				`hdhomerun_tuner_transcode_info{profile="mobile",tuner="0"} 1`,
+				`hdhomerun_up 1`,
+			},
+		},
+		{
+			name: "status only",
+			d: &testDevice{
+				model: "hdhomerun_test",
+				queries: map[string]string{
+					"/tuner0/status": "ch=qam:381000000 lock=qam256:381000000 ss=100 snq=90 seq=100 bps=38809216 pps=3200",
+					"/tuner1/status": "ch=none lock=none ss=0 snq=0 seq=0 bps=0 pps=0",
+				},
+			},
+			cfg: collectorConfig{TunerKeys: []string{"status"}},
+			metrics: []string{
+				`hdhomerun_device_info{device_id="",firmware="",hwmodel="",model="hdhomerun_test"} 1`,
+				`hdhomerun_device_signal_strength_ratio_avg 1`,
+				`hdhomerun_device_signal_strength_ratio_min 1`,
+				`hdhomerun_device_signal_to_noise_ratio_avg 0.9`,
+				`hdhomerun_device_signal_to_noise_ratio_min 0.9`,
+				`hdhomerun_device_tuners 2`,
+				`hdhomerun_device_tuners_in_use 1`,
+				`hdhomerun_tuner_frequency_hz{tuner="0"} 3.81e+08`,
+				`hdhomerun_tuner_errors_total{tuner="0"} 0`,
+				`hdhomerun_tuner_errors_total{tuner="1"} 0`,
+				`hdhomerun_tuner_info{channel="none",channelmap="",lock="none",tuner="1"} 1`,
+				`hdhomerun_tuner_info{channel="qam:381000000",channelmap="",lock="qam256:381000000",tuner="0"} 1`,
+				`hdhomerun_tuner_locked{tuner="0"} 1`,
+				`hdhomerun_tuner_locked{tuner="1"} 0`,
+				`hdhomerun_tuner_signal_strength_ratio{tuner="0"} 1`,
+				`hdhomerun_tuner_signal_strength_ratio{tuner="1"} 0`,
+				`hdhomerun_tuner_signal_to_noise_ratio{tuner="0"} 0.9`,
+				`hdhomerun_tuner_signal_to_noise_ratio{tuner="1"} 0`,
+				`hdhomerun_tuner_symbol_error_ratio{tuner="0"} 1`,
+				`hdhomerun_tuner_symbol_error_scrapes_total{tuner="0"} 0`,
+				`hdhomerun_tuner_symbol_error_ratio{tuner="1"} 0`,
+				`hdhomerun_up 1`,
+			},
+		},
+		{
+			name: "query plan",
+			d: &testDevice{
+				model: "hdhomerun_test",
+				queries: map[string]string{
+					"/tuner0/status":   "ch=none lock=none ss=0 snq=0 seq=0 bps=0 pps=0",
+					"/tuner0/target":   "udp://192.168.1.20:5000",
+					"/tuner0/vchannel": "5.1",
+				},
+			},
+			cfg: collectorConfig{TunerKeys: []string{"status", "vchannel"}},
+			metrics: []string{
+				`hdhomerun_device_info{device_id="",firmware="",hwmodel="",model="hdhomerun_test"} 1`,
+				`hdhomerun_device_tuners 1`,
+				`hdhomerun_device_tuners_in_use 0`,
+				`hdhomerun_tuner_errors_total{tuner="0"} 0`,
+				`hdhomerun_tuner_info{channel="none",channelmap="",lock="none",tuner="0"} 1`,
+				`hdhomerun_tuner_locked{tuner="0"} 0`,
+				`hdhomerun_tuner_signal_strength_ratio{tuner="0"} 0`,
+				`hdhomerun_tuner_signal_to_noise_ratio{tuner="0"} 0`,
+				`hdhomerun_tuner_symbol_error_ratio{tuner="0"} 0`,
+				`hdhomerun_tuner_vchannel_info{tuner="0",vchannel="5.1"} 1`,
+				`hdhomerun_up 1`,
+			},
+		},
+		{
+			name: "status only tuner error",
+			d: &testDevice{
+				model: "hdhomerun_test",
+				queries: map[string]string{
+					"/tuner0/status":   "ch=none lock=none ss=0 snq=0 seq=0 bps=0 pps=0",
+					"/tuner0/vchannel": "5.1",
+					"/tuner1/status":   "ch=none lock=none ss=0 snq=0 seq=0 bps=0 pps=0",
+				},
+				queryErrs: map[string]error{
+					"/tuner1/vchannel": errors.New("dead tuner"),
+				},
+			},
+			cfg: collectorConfig{TunerKeys: []string{"status", "vchannel"}},
+			metrics: []string{
+				`hdhomerun_device_info{device_id="",firmware="",hwmodel="",model="hdhomerun_test"} 1`,
+				`hdhomerun_device_tuners 2`,
+				`hdhomerun_device_tuners_in_use 0`,
+				`hdhomerun_tuner_errors_total{tuner="0"} 0`,
+				`hdhomerun_tuner_errors_total{tuner="1"} 1`,
+				`hdhomerun_tuner_info{channel="none",channelmap="",lock="none",tuner="0"} 1`,
+				`hdhomerun_tuner_locked{tuner="0"} 0`,
+				`hdhomerun_tuner_signal_strength_ratio{tuner="0"} 0`,
+				`hdhomerun_tuner_signal_to_noise_ratio{tuner="0"} 0`,
+				`hdhomerun_tuner_symbol_error_ratio{tuner="0"} 0`,
+				`hdhomerun_tuner_vchannel_info{tuner="0",vchannel="5.1"} 1`,
+				`hdhomerun_up 1`,
+			},
+		},
+		{
+			name: "network collector only",
+			d: &testDevice{
+				model:   "hdhomerun_test",
+				queries: primeQueries,
+				tuners:  []testTuner{{index: 0, debug: idleDebug()}},
+			},
+			cfg: collectorConfig{
+				Collectors: collectorSet{collectorNetwork: true},
+			},
+			metrics: []string{
+				`hdhomerun_device_info{device_id="1040A1B2",firmware="20190621",hwmodel="HDHR3-CC",model="hdhomerun_test"} 1`,
+				`hdhomerun_device_tuners 1`,
+				`hdhomerun_device_tuners_in_use 0`,
+				`hdhomerun_network_errors_total{tuner="0"} 0`,
+				`hdhomerun_network_packets_per_second{tuner="0"} 0`,
+				`hdhomerun_tuner_errors_total{tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="connection_loss",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="http_connection_close",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="icmp_reject",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="intentional",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="not_stopped",tuner="0"} 1`,
+				`hdhomerun_tuner_stream_stops_total{reason="connection_loss",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stops_total{reason="http_connection_close",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stops_total{reason="icmp_reject",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stops_total{reason="intentional",tuner="0"} 0`,
+				`hdhomerun_up 1`,
+			},
+		},
+		{
+			name: "legacy counter gauges",
+			d: &testDevice{
+				model:   "hdhomerun_test",
+				queries: primeQueries,
+				tuners:  []testTuner{{index: 0, debug: idleDebug()}},
+			},
+			cfg: collectorConfig{LegacyCounterGauges: true},
+			metrics: append(
+				idleTunerMetrics("0", 1),
+				`hdhomerun_cablecard_overflow 0`,
+				`hdhomerun_cablecard_resync 0`,
+				`hdhomerun_device_stream_overflows{tuner="0"} 0`,
+				`hdhomerun_device_stream_resyncs{tuner="0"} 0`,
+				`hdhomerun_network_errors{tuner="0"} 0`,
+				`hdhomerun_transport_stream_crc_errors{tuner="0"} 0`,
+				`hdhomerun_transport_stream_transport_errors{tuner="0"} 0`,
+			),
+		},
+		{
+			name: "model family quirks",
+			d: &testDevice{
+				model: "hdhomerun_test",
+				queries: map[string]string{
+					"/sys/hwmodel": "HDFX-8US",
+					"/card/status": primeQueries["/card/status"],
+				},
+				tuners: []testTuner{{index: 0, debug: idleDebug()}},
+			},
+			metrics: []string{
+				`hdhomerun_device_info{device_id="",firmware="",hwmodel="HDFX-8US",model="hdhomerun_test"} 1`,
+				`hdhomerun_device_stream_bytes_per_second{tuner="0"} 0`,
+				`hdhomerun_device_stream_overflows_total{tuner="0"} 0`,
+				`hdhomerun_device_stream_resyncs_total{tuner="0"} 0`,
+				`hdhomerun_device_tuners 1`,
+				`hdhomerun_device_tuners_in_use 0`,
+				`hdhomerun_network_errors_total{tuner="0"} 0`,
+				`hdhomerun_network_packets_per_second{tuner="0"} 0`,
+				`hdhomerun_transport_stream_bytes_per_second{tuner="0"} 0`,
+				`hdhomerun_transport_stream_crc_errors_total{tuner="0"} 0`,
+				`hdhomerun_transport_stream_transport_errors_total{tuner="0"} 0`,
+				`hdhomerun_tuner_errors_total{tuner="0"} 0`,
+				`hdhomerun_tuner_info{channel="none",channelmap="",lock="none",tuner="0"} 1`,
+				`hdhomerun_tuner_locked{tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="connection_loss",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="http_connection_close",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="icmp_reject",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="intentional",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="not_stopped",tuner="0"} 1`,
+				`hdhomerun_tuner_stream_stops_total{reason="connection_loss",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stops_total{reason="http_connection_close",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stops_total{reason="icmp_reject",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stops_total{reason="intentional",tuner="0"} 0`,
+				`hdhomerun_tuner_signal_strength_ratio{tuner="0"} 0`,
+				`hdhomerun_tuner_signal_to_noise_ratio{tuner="0"} 0`,
+				`hdhomerun_tuner_symbol_error_ratio{tuner="0"} 0`,
+				`hdhomerun_up 1`,
+			},
+		},
+		{
+			name: "model quirks",
+			d: &testDevice{
+				model: "hdhomerun_test",
+				queries: map[string]string{
+					"/sys/hwmodel": "HDHR5-4US",
+					"/sys/uptime":  "3600",
+					"/card/status": primeQueries["/card/status"],
+				},
+				tuners: []testTuner{{index: 0, debug: idleDebug()}},
+			},
+			cfg: collectorConfig{
+				Quirks: map[string]Quirks{
+					"HDHR5-4US": {
+						MissingKeys: []string{"/sys/uptime"},
+						NoCableCARD: true,
+					},
+				},
+			},
+			metrics: []string{
+				`hdhomerun_device_info{device_id="",firmware="",hwmodel="HDHR5-4US",model="hdhomerun_test"} 1`,
+				`hdhomerun_device_stream_bytes_per_second{tuner="0"} 0`,
+				`hdhomerun_device_stream_overflows_total{tuner="0"} 0`,
+				`hdhomerun_device_stream_resyncs_total{tuner="0"} 0`,
+				`hdhomerun_device_tuners 1`,
+				`hdhomerun_device_tuners_in_use 0`,
+				`hdhomerun_network_errors_total{tuner="0"} 0`,
+				`hdhomerun_network_packets_per_second{tuner="0"} 0`,
+				`hdhomerun_transport_stream_bytes_per_second{tuner="0"} 0`,
+				`hdhomerun_transport_stream_crc_errors_total{tuner="0"} 0`,
+				`hdhomerun_transport_stream_transport_errors_total{tuner="0"} 0`,
+				`hdhomerun_tuner_errors_total{tuner="0"} 0`,
+				`hdhomerun_tuner_info{channel="none",channelmap="",lock="none",tuner="0"} 1`,
+				`hdhomerun_tuner_locked{tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="connection_loss",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="http_connection_close",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="icmp_reject",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="intentional",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stop_reason{reason="not_stopped",tuner="0"} 1`,
+				`hdhomerun_tuner_stream_stops_total{reason="connection_loss",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stops_total{reason="http_connection_close",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stops_total{reason="icmp_reject",tuner="0"} 0`,
+				`hdhomerun_tuner_stream_stops_total{reason="intentional",tuner="0"} 0`,
+				`hdhomerun_tuner_signal_strength_ratio{tuner="0"} 0`,
+				`hdhomerun_tuner_signal_to_noise_ratio{tuner="0"} 0`,
+				`hdhomerun_tuner_symbol_error_ratio{tuner="0"} 0`,
+				`hdhomerun_up 1`,
+			},
+		},
+		{
+			name: "target quirks override",
+			d: &testDevice{
+				model:   "hdhomerun_test",
+				queries: primeQueries,
+				tuners:  []testTuner{{index: 0, debug: idleDebug()}},
+			},
+			cfg: collectorConfig{
+				Target: TargetConfig{Quirks: &Quirks{}},
+				Quirks: map[string]Quirks{
+					"HDHR3-CC": {NoCableCARD: true},
+				},
+			},
+			metrics: idleTunerMetrics("0", 1),
+		},
+		{
+			name: "CableCARD status",
+			d: &testDevice{
+				model: "hdhomerun_test",
+				queries: map[string]string{
+					"/sys/hwmodel": "HDHR3-CC",
+					"/card/status": "card=inserted auth=none oob=success act=none",
+					"/oob/status":  "ch=qam:75000000 lock=qam64 ss=80 snq=90 seq=100",
+				},
+			},
+			metrics: []string{
+				`hdhomerun_cablecard_authorized 0`,
+				`hdhomerun_cablecard_info{act="none",auth="none",card="inserted",oob="success"} 1`,
+				`hdhomerun_cablecard_oob_locked 1`,
+				`hdhomerun_cablecard_oob_signal_strength_ratio 0.8`,
+				`hdhomerun_cablecard_oob_signal_to_noise_ratio 0.9`,
+				`hdhomerun_device_info{device_id="",firmware="",hwmodel="HDHR3-CC",model="hdhomerun_test"} 1`,
+				`hdhomerun_device_tuners 0`,
+				`hdhomerun_device_tuners_in_use 0`,
+				`hdhomerun_up 1`,
+			},
+		},
+		{
+			name: "lineup",
+			d: &testDevice{
+				model: "hdhomerun_test",
+			},
+			a: &testAPI{
+				paths: map[string]interface{}{
+					"/discover.json": discoverJSON{
+						DeviceID:   "1040A1B2",
+						DeviceAuth: "abcdef0123456789",
+						DVRActive:  intPtr(1),
+					},
+					"/lineup.json": []lineupJSON{
+						{GuideNumber: "2.1"},
+						{GuideNumber: "702", DRM: 1},
+					},
+					"/status.json": []tunerStatusJSON{
+						{
+							Resource:             "tuner0",
+							TargetIP:             "192.168.1.20",
+							NetworkRate:          19392000,
+							SymbolQualityPercent: 100,
+						},
+						{Resource: "tuner1"},
+					},
+					"/lineup_status.json": lineupStatusJSON{
+						ScanInProgress: 1,
+						Progress:       45,
+						Found:          12,
+					},
+				},
+			},
+			metrics: []string{
+				`hdhomerun_device_auth_present 1`,
+				`hdhomerun_device_dvr_active 1`,
+				`hdhomerun_device_info{device_id="1040A1B2",firmware="",hwmodel="",model="hdhomerun_test"} 1`,
+				`hdhomerun_device_tuners 0`,
+				`hdhomerun_device_tuners_in_use 0`,
+				`hdhomerun_lineup_channels 2`,
+				`hdhomerun_lineup_drm_channels 1`,
+				`hdhomerun_lineup_scan_found_channels 12`,
+				`hdhomerun_lineup_scan_in_progress 1`,
+				`hdhomerun_lineup_scan_progress_ratio 0.45`,
+				`hdhomerun_tuner_http_network_bytes_per_second{tuner="0"} 2.424e+06`,
+				`hdhomerun_tuner_http_network_bytes_per_second{tuner="1"} 0`,
+				`hdhomerun_tuner_http_symbol_quality_ratio{tuner="0"} 1`,
+				`hdhomerun_tuner_http_symbol_quality_ratio{tuner="1"} 0`,
+				`hdhomerun_tuner_http_target_info{target_ip="",tuner="1"} 1`,
+				`hdhomerun_tuner_http_target_info{target_ip="192.168.1.20",tuner="0"} 1`,
+				`hdhomerun_up 1`,
+			},
+		},
+		{
+			name: "storage",
+			d: &testDevice{
+				model: "hdhomerun_test",
+			},
+			a: &testAPI{
+				paths: map[string]interface{}{
+					"/discover.json": discoverJSON{
+						DeviceID:   "1040A1B2",
+						StorageID:  "1040A1B2-ABCD",
+						StorageURL: "http://192.168.1.10/recorded_files.json",
+						TotalSpace: 1000000000000,
+						FreeSpace:  250000000000,
+
+						LiveBufferSpace: int64Ptr(50000000000),
+					},
+					"/recorded_files.json": []struct{ Title string }{
+						{Title: "News"},
+						{Title: "Movie"},
+					},
+					"/status.json": []storageStatusJSON{
+						{Resource: "record"},
+						{Resource: "live"},
+					},
+					"/upcoming.json": []struct{ Title string }{
+						{Title: "News"},
+						{Title: "News"},
+						{Title: "Movie"},
+					},
+				},
+			},
+			metrics: []string{
+				`hdhomerun_device_auth_present 0`,
+				`hdhomerun_device_info{device_id="1040A1B2",firmware="",hwmodel="",model="hdhomerun_test"} 1`,
+				`hdhomerun_device_tuners 0`,
+				`hdhomerun_device_tuners_in_use 0`,
+				`hdhomerun_dvr_active_recordings 1`,
+				`hdhomerun_dvr_live_sessions 1`,
+				`hdhomerun_dvr_upcoming_recordings 3`,
+				`hdhomerun_storage_free_bytes 2.5e+11`,
+				`hdhomerun_storage_info{storage_id="1040A1B2-ABCD"} 1`,
+				`hdhomerun_storage_live_buffer_bytes 5e+10`,
+				`hdhomerun_storage_recordings 2`,
+				`hdhomerun_storage_total_bytes 1e+12`,
+				`hdhomerun_up 1`,
+			},
+		},
+		{
+			name: "HTTP protocol",
+			a: &testAPI{
+				paths: map[string]interface{}{
+					"/discover.json": discoverJSON{
+						FriendlyName:    "HDHomeRun CONNECT QUATRO",
+						ModelNumber:     "HDHR5-4US",
+						FirmwareVersion: "20200101",
+						DeviceID:        "1040A1B2",
+						TunerCount:      2,
+					},
+					"/status.json": []tunerStatusJSON{
+						{
+							Resource:              "tuner0",
+							VctNumber:             "5.1",
+							Frequency:             177000000,
+							SignalStrengthPercent: 100,
+							SignalQualityPercent:  90,
+							SymbolQualityPercent:  100,
+							TargetIP:              "192.168.1.20",
+							NetworkRate:           8000000,
+						},
+						{Resource: "tuner1"},
+					},
+				},
+			},
+			cfg: collectorConfig{Protocol: ProtocolHTTP},
+			metrics: []string{
+				`hdhomerun_device_auth_present 0`,
+				`hdhomerun_device_info{device_id="1040A1B2",firmware="20200101",hwmodel="HDHR5-4US",model="HDHomeRun CONNECT QUATRO"} 1`,
+				`hdhomerun_device_tuners 2`,
+				`hdhomerun_device_tuners_in_use 1`,
+				`hdhomerun_tuner_frequency_hz{tuner="0"} 1.77e+08`,
+				`hdhomerun_tuner_http_network_bytes_per_second{tuner="0"} 1e+06`,
+				`hdhomerun_tuner_http_network_bytes_per_second{tuner="1"} 0`,
+				`hdhomerun_tuner_http_symbol_quality_ratio{tuner="0"} 1`,
+				`hdhomerun_tuner_http_symbol_quality_ratio{tuner="1"} 0`,
+				`hdhomerun_tuner_http_target_info{target_ip="",tuner="1"} 1`,
+				`hdhomerun_tuner_http_target_info{target_ip="192.168.1.20",tuner="0"} 1`,
+				`hdhomerun_tuner_signal_strength_ratio{tuner="0"} 1`,
+				`hdhomerun_tuner_signal_strength_ratio{tuner="1"} 0`,
+				`hdhomerun_tuner_signal_to_noise_ratio{tuner="0"} 0.9`,
+				`hdhomerun_tuner_signal_to_noise_ratio{tuner="1"} 0`,
+				`hdhomerun_tuner_symbol_error_ratio{tuner="0"} 1`,
+				`hdhomerun_tuner_symbol_error_scrapes_total{tuner="0"} 0`,
+				`hdhomerun_tuner_symbol_error_ratio{tuner="1"} 0`,
+				`hdhomerun_tuner_vchannel_info{tuner="0",vchannel="5.1"} 1`,
+				`hdhomerun_up 1`,
+			},
+		},
+		{
+			name: "RECORD engine",
+			a: &testAPI{
+				paths: map[string]interface{}{
+					"/discover.json": discoverJSON{
+						FriendlyName: "HDHomeRun DVR",
+						StorageID:    "5E9C1A2B-0000-4F1E-9A6D-0123456789AB",
+						TotalSpace:   4000000000000,
+						FreeSpace:    1000000000000,
+						Version:      "20200225",
+					},
+				},
+			},
+			cfg: collectorConfig{Protocol: ProtocolHTTP},
+			metrics: []string{
+				`hdhomerun_device_auth_present 0`,
+				`hdhomerun_device_info{device_id="",firmware="20200225",hwmodel="",model="HDHomeRun DVR"} 1`,
+				`hdhomerun_dvr_active_recordings 0`,
+				`hdhomerun_dvr_live_sessions 0`,
+				`hdhomerun_storage_free_bytes 1e+12`,
+				`hdhomerun_storage_info{storage_id="5E9C1A2B-0000-4F1E-9A6D-0123456789AB"} 1`,
+				`hdhomerun_storage_total_bytes 4e+12`,
+				`hdhomerun_up 1`,
 			},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			body := testCollector(t, tt.d)
+			body := testCollector(t, tt.d, tt.a, tt.cfg)
 
 			s := bufio.NewScanner(bytes.NewReader(body))
 			for s.Scan() {
@@ -145,6 +972,11 @@ func TestCollector(t *testing.T) {
 					continue
 				}
 
+				// Scrape duration is not deterministic.
+				if strings.HasPrefix(text, "hdhomerun_scrape_duration_seconds ") {
+					continue
+				}
+
 				var found bool
 				for _, m := range tt.metrics {
 					if text == m {
@@ -166,12 +998,191 @@ func TestCollector(t *testing.T) {
 	}
 }
 
-// testCollector uses the input device to generate a blob of Prometheus text
-// format metrics.
-func testCollector(t *testing.T, d device) []byte {
+// idleTunerMetrics returns the metrics expected for a device with a single,
+// idle tuner collected at the specified index, out of n tuners in total.
+func idleTunerMetrics(tuner string, n int) []string {
+	return []string{
+		`hdhomerun_cablecard_authorized 1`,
+		`hdhomerun_cablecard_info{act="success",auth="success",card="ready",oob="success"} 1`,
+		`hdhomerun_cablecard_oob_locked 1`,
+		`hdhomerun_cablecard_bytes_per_second 0`,
+		`hdhomerun_cablecard_overflows_total 0`,
+		`hdhomerun_cablecard_resyncs_total 0`,
+		`hdhomerun_device_info{device_id="1040A1B2",firmware="20190621",hwmodel="HDHR3-CC",model="hdhomerun_test"} 1`,
+		`hdhomerun_device_stream_bytes_per_second{tuner="` + tuner + `"} 0`,
+		`hdhomerun_device_stream_overflows_total{tuner="` + tuner + `"} 0`,
+		`hdhomerun_device_stream_resyncs_total{tuner="` + tuner + `"} 0`,
+		`hdhomerun_device_tuners ` + strconv.Itoa(n),
+		`hdhomerun_device_tuners_in_use 0`,
+		`hdhomerun_network_errors_total{tuner="` + tuner + `"} 0`,
+		`hdhomerun_network_packets_per_second{tuner="` + tuner + `"} 0`,
+		`hdhomerun_transport_stream_bytes_per_second{tuner="` + tuner + `"} 0`,
+		`hdhomerun_transport_stream_crc_errors_total{tuner="` + tuner + `"} 0`,
+		`hdhomerun_transport_stream_transport_errors_total{tuner="` + tuner + `"} 0`,
+		`hdhomerun_tuner_errors_total{tuner="` + tuner + `"} 0`,
+		`hdhomerun_tuner_info{channel="none",channelmap="",lock="none",tuner="` + tuner + `"} 1`,
+		`hdhomerun_tuner_locked{tuner="` + tuner + `"} 0`,
+		`hdhomerun_tuner_stream_stop_reason{reason="connection_loss",tuner="` + tuner + `"} 0`,
+		`hdhomerun_tuner_stream_stop_reason{reason="http_connection_close",tuner="` + tuner + `"} 0`,
+		`hdhomerun_tuner_stream_stop_reason{reason="icmp_reject",tuner="` + tuner + `"} 0`,
+		`hdhomerun_tuner_stream_stop_reason{reason="intentional",tuner="` + tuner + `"} 0`,
+		`hdhomerun_tuner_stream_stop_reason{reason="not_stopped",tuner="` + tuner + `"} 1`,
+		`hdhomerun_tuner_stream_stops_total{reason="connection_loss",tuner="` + tuner + `"} 0`,
+		`hdhomerun_tuner_stream_stops_total{reason="http_connection_close",tuner="` + tuner + `"} 0`,
+		`hdhomerun_tuner_stream_stops_total{reason="icmp_reject",tuner="` + tuner + `"} 0`,
+		`hdhomerun_tuner_stream_stops_total{reason="intentional",tuner="` + tuner + `"} 0`,
+		`hdhomerun_tuner_signal_strength_ratio{tuner="` + tuner + `"} 0`,
+		`hdhomerun_tuner_signal_to_noise_ratio{tuner="` + tuner + `"} 0`,
+		`hdhomerun_tuner_symbol_error_ratio{tuner="` + tuner + `"} 0`,
+		`hdhomerun_up 1`,
+	}
+}
+
+func TestCollectorOpenMetrics(t *testing.T) {
+	d := &testDevice{
+		model:   "hdhomerun_test",
+		queries: primeQueries,
+		tuners:  []testTuner{{index: 0, debug: idleDebug()}},
+	}
+
+	s := httptest.NewServer(serveMetrics(d, nil, newDeviceState(), collectorConfig{}))
+	defer s.Close()
+
+	req, err := http.NewRequest(http.MethodGet, s.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create HTTP request: %v", err)
+	}
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to perform HTTP request: %v", err)
+	}
+	defer res.Body.Close()
+
+	if ct := res.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/openmetrics-text") {
+		t.Fatalf("unexpected content type: %q", ct)
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("failed to read response body: %v", err)
+	}
+
+	// Every counter carries the time at which the exporter began tracking
+	// the device, including totals accumulated from device counters.
+	for _, m := range []string{
+		`hdhomerun_tuner_errors_created{tuner="0"}`,
+		`hdhomerun_network_errors_created{tuner="0"}`,
+		`hdhomerun_transport_stream_crc_errors_created{tuner="0"}`,
+		`hdhomerun_cablecard_resyncs_created `,
+	} {
+		if !strings.Contains(string(b), m) {
+			t.Fatalf("created sample %q not found in response:\n%s", m, string(b))
+		}
+	}
+}
+
+func TestCollectorDiscoverOnce(t *testing.T) {
+	d := &testDevice{
+		model:   "hdhomerun_test",
+		queries: primeQueries,
+	}
+
+	a := &testAPI{
+		paths: map[string]interface{}{
+			"/discover.json": discoverJSON{
+				DeviceID:   "1040A1B2",
+				StorageID:  "1040A1B2-storage",
+				TotalSpace: 1000000000000,
+			},
+		},
+	}
+
+	// The capabilities probe and the collection of the device's HTTP API
+	// metrics share a single request for discover.json.
+	testCollector(t, d, a, collectorConfig{})
+
+	if n := a.gets["/discover.json"]; n != 1 {
+		t.Fatalf("unexpected number of discover.json requests: %d", n)
+	}
+}
+
+func TestCollectorDiscoverUnavailable(t *testing.T) {
+	d := &testDevice{model: "hdhomerun_test"}
+
+	a := &testAPI{
+		paths: map[string]interface{}{
+			"/discover.json": discoverJSON{
+				DeviceID:   "1040A1B2",
+				DeviceAuth: "abcdef0123456789",
+				StorageID:  "1040A1B2-ABCD",
+			},
+			"/lineup.json": []lineupJSON{{GuideNumber: "2.1"}},
+			"/status.json": []storageStatusJSON{{Resource: "record"}},
+		},
+	}
+
+	s := newDeviceState()
+	scrape := func() string {
+		w := httptest.NewRecorder()
+		serveMetrics(d, a, s, collectorConfig{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return w.Body.String()
+	}
+
+	// The first scrape caches the device's capabilities, so that a later
+	// failure to fetch discover.json still permits collecting the other HTTP
+	// API metrics.
+	scrape()
+	delete(a.paths, "/discover.json")
+	s.discoverTime = s.discoverTime.Add(-discoverCacheInterval)
+
+	body := scrape()
+	for _, want := range []string{
+		"hdhomerun_dvr_active_recordings 1",
+		"hdhomerun_lineup_channels 1",
+		"hdhomerun_up 1",
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("missing metric %q in scrape:\n%s", want, body)
+		}
+	}
+
+	if strings.Contains(body, "hdhomerun_device_auth_present") {
+		t.Fatalf("unexpected DeviceAuth metric without discover.json:\n%s", body)
+	}
+}
+
+func TestCollectorCachedHTTPAPIWithoutAPI(t *testing.T) {
+	d := &testDevice{model: "hdhomerun_test"}
+	a := &testAPI{
+		paths: map[string]interface{}{
+			"/discover.json": discoverJSON{DeviceID: "1040A1B2"},
+		},
+	}
+
+	s := newDeviceState()
+	scrape := func(a api) string {
+		w := httptest.NewRecorder()
+		serveMetrics(d, a, s, collectorConfig{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return w.Body.String()
+	}
+
+	// A scrape using both protocols caches that the device has an HTTP API,
+	// which a later scrape using only the control protocol must not use.
+	scrape(a)
+
+	if body := scrape(nil); !strings.Contains(body, "hdhomerun_up 1") {
+		t.Fatalf("control protocol scrape failed:\n%s", body)
+	}
+}
+
+// testCollector uses the input device, API, and configuration to generate a
+// blob of Prometheus text format metrics.
+func testCollector(t *testing.T, d device, a api, cfg collectorConfig) []byte {
 	t.Helper()
 
-	s := httptest.NewServer(serveMetrics(d))
+	s := httptest.NewServer(serveMetrics(d, a, newDeviceState(), cfg))
 	defer s.Close()
 
 	u, err := url.Parse(s.URL)
@@ -210,14 +1221,44 @@ func testCollector(t *testing.T, d device) []byte {
 var _ device = &testDevice{}
 
 type testDevice struct {
-	model  string
-	tuners []testTuner
+	model     string
+	modelErr  error
+	queries   map[string]string
+	queryErrs map[string]error
+	tuners    []testTuner
 }
 
 func (d *testDevice) Model() (string, error) {
+	if d.modelErr != nil {
+		return "", d.modelErr
+	}
+
 	return d.model, nil
 }
 
+func (d *testDevice) Query(query string) (string, error) {
+	if err, ok := d.queryErrs[query]; ok {
+		return "", err
+	}
+
+	v, ok := d.queries[query]
+	if !ok {
+		return "", errNotExist
+	}
+
+	return v, nil
+}
+
+func (d *testDevice) Tuner(n int) tuner {
+	for _, t := range d.tuners {
+		if t.index == n {
+			return t
+		}
+	}
+
+	return testTuner{index: n, err: errNotExist}
+}
+
 func (d *testDevice) ForEachTuner(fn func(t tuner) error) error {
 	for _, t := range d.tuners {
 		if err := fn(t); err != nil {
@@ -228,12 +1269,87 @@ func (d *testDevice) ForEachTuner(fn func(t tuner) error) error {
 	return nil
 }
 
+// primeQueries are device queries for an HDHomeRun PRIME with a CableCARD.
+var primeQueries = map[string]string{
+	"/sys/hwmodel":   "HDHR3-CC",
+	"/sys/version":   "20190621",
+	"/sys/device_id": "1040A1B2",
+	"/card/status":   "card=ready auth=success oob=success act=success",
+}
+
+// mergeQueries merges the device queries in qs into a new map, with later
+// maps taking precedence.
+func mergeQueries(qs ...map[string]string) map[string]string {
+	out := make(map[string]string)
+	for _, q := range qs {
+		for k, v := range q {
+			out[k] = v
+		}
+	}
+
+	return out
+}
+
+// intPtr returns a pointer to v.
+func intPtr(v int) *int { return &v }
+
+// int64Ptr returns a pointer to v.
+func int64Ptr(v int64) *int64 { return &v }
+
+// errNotExist is the error returned by a device when a queried key does
+// not exist.
+var errNotExist = &hdhomerun.Error{Message: "unknown getset variable"}
+
 var _ tuner = &testTuner{}
 
 type testTuner struct {
 	index int
 	debug *hdhomerun.TunerDebug
+	err   error
 }
 
 func (t testTuner) Index() int                            { return t.index }
-func (t testTuner) Debug() (*hdhomerun.TunerDebug, error) { return t.debug, nil }
+func (t testTuner) Debug() (*hdhomerun.TunerDebug, error) { return t.debug, t.err }
+
+var _ api = &testAPI{}
+
+// A testAPI is an api which serves JSON-encoded values keyed by path.
+type testAPI struct {
+	paths map[string]interface{}
+
+	// gets counts the requests for each path.
+	gets map[string]int
+}
+
+func (a *testAPI) Get(path string, v interface{}) error {
+	if a.gets == nil {
+		a.gets = make(map[string]int)
+	}
+	a.gets[path]++
+
+	pv, ok := a.paths[path]
+	if !ok {
+		return errNotFound
+	}
+
+	b, err := json.Marshal(pv)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+// idleDebug returns debug information for a tuner which is not tuned.
+func idleDebug() *hdhomerun.TunerDebug {
+	return &hdhomerun.TunerDebug{
+		Tuner: &hdhomerun.TunerStatus{
+			Channel: "none",
+			Lock:    "none",
+		},
+		Device:          &hdhomerun.DeviceStatus{},
+		CableCARD:       &hdhomerun.CableCARDStatus{},
+		TransportStream: &hdhomerun.TransportStreamStatus{},
+		Network:         &hdhomerun.NetworkStatus{},
+	}
+}
@@ -0,0 +1,102 @@
+package hdhomerunexporter
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Possible groups of metrics which may be enabled or disabled using the
+// "collect[]" query parameter.
+const (
+	collectorTuner     = "tuner"
+	collectorStream    = "stream"
+	collectorNetwork   = "network"
+	collectorTransport = "transport"
+	collectorCableCARD = "cablecard"
+	collectorLineup    = "lineup"
+	collectorStorage   = "storage"
+)
+
+// collectorNames is the set of all valid collector names.
+var collectorNames = map[string]bool{
+	collectorTuner:     true,
+	collectorStream:    true,
+	collectorNetwork:   true,
+	collectorTransport: true,
+	collectorCableCARD: true,
+	collectorLineup:    true,
+	collectorStorage:   true,
+}
+
+// Collectors returns the names of the groups of metrics which may be enabled
+// or disabled, sorted by name.
+func Collectors() []string {
+	names := make([]string, 0, len(collectorNames))
+	for n := range collectorNames {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// WithDisabledCollectors disables the groups of metrics with the specified
+// names, as returned by Collectors, so that the device queries they require
+// are skipped entirely. Disabled collectors cannot be enabled using the
+// "collect[]" query parameter. Unknown names are ignored.
+func WithDisabledCollectors(names []string) HandlerOption {
+	return func(h *Handler) {
+		for _, n := range names {
+			if collectorNames[n] {
+				h.disabledCollectors = append(h.disabledCollectors, n)
+			}
+		}
+	}
+}
+
+// A collectorSet is a set of enabled collectors. A nil collectorSet enables
+// all collectors.
+type collectorSet map[string]bool
+
+// parseCollectors parses a collectorSet from the values of the "collect[]"
+// query parameter. If no values are specified, all collectors are enabled.
+func parseCollectors(names []string) (collectorSet, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	cs := make(collectorSet, len(names))
+	for _, n := range names {
+		if !collectorNames[n] {
+			return nil, fmt.Errorf("unknown collector %q", n)
+		}
+
+		cs[n] = true
+	}
+
+	return cs, nil
+}
+
+// without returns a copy of cs with the collectors named by disabled removed.
+func (cs collectorSet) without(disabled []string) collectorSet {
+	if len(disabled) == 0 {
+		return cs
+	}
+
+	out := make(collectorSet, len(collectorNames))
+	for n := range collectorNames {
+		if cs.enabled(n) {
+			out[n] = true
+		}
+	}
+	for _, n := range disabled {
+		delete(out, n)
+	}
+
+	return out
+}
+
+// enabled determines if the collector with the specified name is enabled.
+func (cs collectorSet) enabled(name string) bool {
+	return cs == nil || cs[name]
+}
@@ -0,0 +1,48 @@
+package hdhomerunexporter
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCollectorSetWithout(t *testing.T) {
+	tests := []struct {
+		name     string
+		cs       collectorSet
+		disabled []string
+		want     collectorSet
+	}{
+		{
+			name: "all enabled",
+		},
+		{
+			name:     "all but disabled",
+			disabled: []string{collectorLineup, collectorStorage},
+			want: collectorSet{
+				collectorTuner:     true,
+				collectorStream:    true,
+				collectorNetwork:   true,
+				collectorTransport: true,
+				collectorCableCARD: true,
+			},
+		},
+		{
+			name: "selected",
+			cs: collectorSet{
+				collectorTuner:  true,
+				collectorLineup: true,
+			},
+			disabled: []string{collectorLineup},
+			want:     collectorSet{collectorTuner: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, tt.cs.without(tt.disabled)); diff != "" {
+				t.Fatalf("unexpected collectors (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
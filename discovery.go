@@ -0,0 +1,214 @@
+package hdhomerunexporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mdlayher/hdhomerun"
+)
+
+// discoveryTimeout is the maximum amount of time spent discovering devices.
+const discoveryTimeout = 2 * time.Second
+
+// AutoTarget is a special target which scrapes every device found using
+// discovery, when discovery is enabled using WithDiscovery.
+const AutoTarget = "auto"
+
+// A DiscoverFunc discovers HDHomeRun tuner devices on the local network. If
+// id is set, only the device with that device ID is discovered. A DiscoverFunc
+// must return the devices found so far once ctx is canceled.
+type DiscoverFunc func(ctx context.Context, id string) ([]*hdhomerun.DiscoveredDevice, error)
+
+var _ DiscoverFunc = Discover
+
+// Discover is a DiscoverFunc which uses the HDHomeRun UDP discovery protocol.
+func Discover(ctx context.Context, id string) ([]*hdhomerun.DiscoveredDevice, error) {
+	options := []hdhomerun.DiscovererOption{
+		hdhomerun.DiscoverDeviceType(hdhomerun.DeviceTypeTuner),
+	}
+	if id != "" {
+		options = append(options, hdhomerun.DiscoverDeviceID(id))
+	}
+
+	d, err := hdhomerun.NewDiscoverer(options...)
+	if err != nil {
+		return nil, err
+	}
+
+	// The Discoverer only releases its resources once a Discover call
+	// observes that ctx is canceled.
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		_, _ = d.Discover(ctx)
+	}()
+
+	var devices []*hdhomerun.DiscoveredDevice
+	seen := make(map[string]bool)
+	for {
+		device, err := d.Discover(ctx)
+		switch err {
+		case nil:
+		case io.EOF:
+			return devices, nil
+		default:
+			return nil, err
+		}
+
+		// A device may reply more than once, such as on multiple interfaces.
+		if seen[device.ID] {
+			continue
+		}
+		seen[device.ID] = true
+
+		devices = append(devices, device)
+		if id != "" {
+			return devices, nil
+		}
+	}
+}
+
+// WithDiscovery enables the handler to resolve targets which are HDHomeRun
+// device IDs, such as "1040A1B2", to device addresses using discover. This is
+// useful when devices are assigned addresses dynamically. Targets with an
+// address configured using WithTargets are not resolved.
+func WithDiscovery(discover DiscoverFunc) HandlerOption {
+	return func(h *Handler) {
+		h.discover = discover
+	}
+}
+
+// isDeviceID determines if target is an HDHomeRun device ID.
+func isDeviceID(target string) bool {
+	_, err := hdhomerun.ParseDeviceID(target)
+	return err == nil
+}
+
+// resolve resolves the device ID id to a device address, using a previously
+// resolved address if one is known.
+func (h *Handler) resolve(ctx context.Context, id string) (string, error) {
+	id = strings.ToUpper(id)
+
+	h.mu.Lock()
+	addr, ok := h.resolved[id]
+	h.mu.Unlock()
+	if ok {
+		return addr, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+
+	devices, err := h.discover(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	for _, d := range devices {
+		if !strings.EqualFold(d.ID, id) {
+			continue
+		}
+
+		addr := deviceAddr(d)
+
+		h.mu.Lock()
+		h.resolved[id] = addr
+		h.mu.Unlock()
+
+		return addr, nil
+	}
+
+	return "", fmt.Errorf("device %q not found using discovery", id)
+}
+
+// forget discards any previously resolved address for the device ID id, so
+// that it will be resolved again, such as after its address changes.
+func (h *Handler) forget(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.resolved, strings.ToUpper(id))
+}
+
+// discoverTargets discovers every device on the network and returns the
+// device IDs of those which may be scraped, recording their addresses so
+// that they need not be resolved again.
+func (h *Handler) discoverTargets(ctx context.Context) ([]string, error) {
+	if h.discover == nil {
+		return nil, &statusError{
+			code: http.StatusBadRequest,
+			err:  fmt.Errorf("target %q requires discovery to be enabled", AutoTarget),
+		}
+	}
+
+	devices, err := h.discoverDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(devices))
+	for _, d := range devices {
+		ids = append(ids, strings.ToUpper(d.ID))
+	}
+
+	return ids, nil
+}
+
+// discoverDevices discovers every device on the network and returns those
+// which may be scraped, sorted by device ID, recording their addresses so
+// that they need not be resolved again.
+func (h *Handler) discoverDevices(ctx context.Context) ([]*hdhomerun.DiscoveredDevice, error) {
+	if h.discover == nil {
+		return nil, &statusError{
+			code: http.StatusNotFound,
+			err:  errors.New("device discovery is not enabled"),
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+
+	devices, err := h.discover(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := make([]*hdhomerun.DiscoveredDevice, 0, len(devices))
+	for _, d := range devices {
+		id := strings.ToUpper(d.ID)
+		if !h.isAllowed(id) {
+			continue
+		}
+
+		h.mu.Lock()
+		h.resolved[id] = deviceAddr(d)
+		h.mu.Unlock()
+
+		allowed = append(allowed, d)
+	}
+
+	sort.Slice(allowed, func(i, j int) bool {
+		return strings.ToUpper(allowed[i].ID) < strings.ToUpper(allowed[j].ID)
+	})
+
+	return allowed, nil
+}
+
+// deviceAddr returns the control protocol address of a discovered device.
+func deviceAddr(d *hdhomerun.DiscoveredDevice) string {
+	host, _, err := net.SplitHostPort(d.Addr)
+	if err != nil {
+		host = d.Addr
+	}
+
+	// Devices reply to discovery from the same port used by their control
+	// protocol.
+	return net.JoinHostPort(host, hdhomerunPort)
+}
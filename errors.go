@@ -0,0 +1,81 @@
+package hdhomerunexporter
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/mdlayher/hdhomerun"
+)
+
+// Possible classes of errors which may occur while scraping a device.
+const (
+	errorClassDial    = "dial"
+	errorClassTimeout = "timeout"
+	errorClassQuery   = "query"
+	errorClassParse   = "parse"
+	errorClassPanic   = "panic"
+	errorClassUnknown = "unknown"
+)
+
+// A dialError is an error which occurred while dialing a device. If timeout
+// is set, the device did not respond before the dial timed out.
+type dialError struct {
+	err     error
+	timeout bool
+}
+
+func (err *dialError) Error() string { return err.err.Error() }
+
+// A panicError is an error which occurred due to a panic while scraping a
+// device, such as from a malformed device reply.
+type panicError struct {
+	v interface{}
+}
+
+func (err *panicError) Error() string { return fmt.Sprintf("panic while scraping device: %v", err.v) }
+
+// errorClass classifies err into one of a bounded set of error classes.
+func errorClass(err error) string {
+	switch err := err.(type) {
+	case *dialError:
+		return errorClassDial
+	case *panicError:
+		return errorClassPanic
+	case net.Error:
+		if err.Timeout() {
+			return errorClassTimeout
+		}
+	case *hdhomerun.Error:
+		return errorClassQuery
+	case *strconv.NumError:
+		return errorClassParse
+	}
+
+	return errorClassUnknown
+}
+
+// isTimeout determines if err is a timeout.
+func isTimeout(err error) bool {
+	nerr, ok := err.(net.Error)
+	return ok && nerr.Timeout()
+}
+
+// statusCode returns the HTTP status code which describes err, an error which
+// occurred while scraping a device, so that clients can classify failures.
+func statusCode(err error) int {
+	if derr, ok := err.(*dialError); ok && derr.timeout {
+		return http.StatusGatewayTimeout
+	}
+
+	switch errorClass(err) {
+	case errorClassTimeout:
+		return http.StatusGatewayTimeout
+	case errorClassDial, errorClassQuery, errorClassParse:
+		// The device could not be reached or returned an error.
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,111 @@
+package hdhomerunexporter
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/hdhomerun"
+)
+
+func TestErrorClass(t *testing.T) {
+	_, perr := strconv.Atoi("foo")
+
+	tests := []struct {
+		name  string
+		err   error
+		class string
+	}{
+		{
+			name:  "dial",
+			err:   &dialError{err: errors.New("connection refused")},
+			class: errorClassDial,
+		},
+		{
+			name:  "timeout",
+			err:   &net.OpError{Op: "read", Err: timeoutError{}},
+			class: errorClassTimeout,
+		},
+		{
+			name:  "query",
+			err:   &hdhomerun.Error{Message: "unknown getset variable"},
+			class: errorClassQuery,
+		},
+		{
+			name:  "parse",
+			err:   perr,
+			class: errorClassParse,
+		},
+		{
+			name:  "panic",
+			err:   &panicError{v: "runtime error: invalid memory address or nil pointer dereference"},
+			class: errorClassPanic,
+		},
+		{
+			name:  "unknown",
+			err:   errors.New("something else"),
+			class: errorClassUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.class, errorClass(tt.err)); diff != "" {
+				t.Fatalf("unexpected error class (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestStatusCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{
+			name: "dial",
+			err:  &dialError{err: errors.New("connection refused")},
+			code: http.StatusBadGateway,
+		},
+		{
+			name: "dial timeout",
+			err:  &dialError{err: errors.New("i/o timeout"), timeout: true},
+			code: http.StatusGatewayTimeout,
+		},
+		{
+			name: "timeout",
+			err:  &net.OpError{Op: "read", Err: timeoutError{}},
+			code: http.StatusGatewayTimeout,
+		},
+		{
+			name: "query",
+			err:  &hdhomerun.Error{Message: "unknown getset variable"},
+			code: http.StatusBadGateway,
+		},
+		{
+			name: "panic",
+			err:  &panicError{v: "oops"},
+			code: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.code, statusCode(tt.err)); diff != "" {
+				t.Fatalf("unexpected HTTP status code (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+var _ net.Error = timeoutError{}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
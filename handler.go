@@ -1,9 +1,17 @@
 package hdhomerunexporter
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/mdlayher/hdhomerun"
 	"github.com/prometheus/client_golang/prometheus"
@@ -14,67 +22,1030 @@ const (
 	// hdhomerunPort is the default TCP port used to communicate with
 	// HDHomeRun devices.
 	hdhomerunPort = "65001"
+
+	// defaultTimeoutOffset is the default amount of time subtracted from
+	// Prometheus's scrape timeout to leave time for the response to be
+	// served.
+	defaultTimeoutOffset = 500 * time.Millisecond
 )
 
-var _ http.Handler = &handler{}
+var _ http.Handler = &Handler{}
+
+// A Handler is an http.Handler that serves Prometheus metrics for
+// HDHomeRun devices. Handlers also provide auxiliary http.Handlers which
+// share the Handler's configuration and device state.
+type Handler struct {
+	dial    func(addr string) (*hdhomerun.Client, error)
+	targets map[string]TargetConfig
+	quirks  map[string]Quirks
+	modules map[string]Module
+	clients map[string]*http.Client
+	client  *http.Client
+	allowed map[string]bool
+
+	staticTargets []string
+
+	discover DiscoverFunc
+	resolved map[string]string
+
+	failOnError         bool
+	legacyCounterGauges bool
+	disabledCollectors  []string
+
+	timeout       time.Duration
+	timeoutOffset time.Duration
+
+	defaultPort string
+
+	streamInterval time.Duration
+
+	cacheTTL time.Duration
+	scrapes  chan struct{}
 
-// A handler is an http.Handler that serves Prometheus metrics for
-// HDHomeRun devices.
-type handler struct {
-	dial func(addr string) (*hdhomerun.Client, error)
+	pollTargets  []string
+	pollInterval time.Duration
+
+	stopPollInterval time.Duration
+
+	readyRequiresDevice bool
+
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	devices map[string]*deviceState
 }
 
-// NewHandler returns an http.Handler that serves Prometheus metrics for
+// NewHandler returns a Handler that serves Prometheus metrics for
 // HDHomeRun devices. The dial function specifies how to connect to a
 // device with the specified address on each HTTP request.
 //
 // Each HTTP request must contain a "target" query parameter which indicates
-// the network address of the device which should be scraped for metrics.
-// If no port is specified, the HDHomeRun device default of 65001 will be used.
-func NewHandler(dial func(addr string) (*hdhomerun.Client, error)) http.Handler {
-	return &handler{
-		dial: dial,
+// the network address of the device which should be scraped for metrics. If
+// multiple targets are specified, each is scraped and its metrics are labeled
+// with a "device" label containing the target. If discovery is enabled using
+// WithDiscovery, the target AutoTarget scrapes every discovered device.
+// If no port is specified, the HDHomeRun device default of 65001 will be used
+// unless another default is set using WithDefaultPort.
+// An optional "auth" query parameter specifies the device auth token used
+// for requests to the device's HTTP API, and an optional "module" query
+// parameter selects a Module configured using WithModules. If no module is
+// specified, the Module named DefaultModule is used, if configured. An
+// optional "timeout" query parameter, such as "2s", overrides the time allowed
+// for the scrape. If no target is specified, the targets configured using
+// WithStaticTargets are scraped.
+//
+// HandlerOptions may be specified to further configure the handler.
+func NewHandler(dial func(addr string) (*hdhomerun.Client, error), options ...HandlerOption) *Handler {
+	h := &Handler{
+		dial:    dial,
+		targets: make(map[string]TargetConfig),
+		quirks:  defaultQuirks(),
+		modules: make(map[string]Module),
+		clients: make(map[string]*http.Client),
+
+		// Scrapes which use no module have their own client, so that the
+		// handler does not share connections with http.DefaultClient.
+		client: &http.Client{
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment},
+		},
+
+		resolved: make(map[string]string),
+
+		legacyCounterGauges: true,
+
+		timeoutOffset:  defaultTimeoutOffset,
+		streamInterval: defaultStreamInterval,
+
+		defaultPort: hdhomerunPort,
+
+		logger: nopLogger,
+
+		devices: make(map[string]*deviceState),
+	}
+
+	for _, o := range options {
+		o(h)
+	}
+
+	return h
+}
+
+// A HandlerOption is an option which modifies the behavior of the Handler
+// returned by NewHandler.
+type HandlerOption func(h *Handler)
+
+// A TargetConfig contains configuration for a single scrape target.
+type TargetConfig struct {
+	// Address, if set, is the network address which will be dialed in place
+	// of the target itself. This is useful for devices behind NAT or port
+	// forwarding, where the advertised device address is not reachable.
+	Address string
+
+	// Tuners, if non-zero, pins the number of tuners available to the
+	// device so that tuners need not be probed on each scrape.
+	Tuners int
+
+	// SkipTuners specifies the indices of any tuners which should not be
+	// collected, such as a faulty tuner which always returns errors.
+	SkipTuners []int
+
+	// Quirks, if set, overrides the Quirks which would otherwise be applied
+	// to the device based on its hardware model.
+	Quirks *Quirks
+
+	// Auth, if set, is the device auth token sent with requests to the
+	// device's HTTP API. An "auth" query parameter overrides Auth.
+	Auth Secret
+
+	// Protocol, if set, selects the protocol used to scrape the device,
+	// overriding the Protocol of any Module used to scrape it.
+	Protocol Protocol
+}
+
+// WithTargets applies per-target configuration to the handler. The map's
+// keys are the logical targets which appear in the "target" query parameter,
+// such as a device ID or a device's advertised address.
+func WithTargets(targets map[string]TargetConfig) HandlerOption {
+	return func(h *Handler) {
+		for k, v := range targets {
+			h.targets[k] = v
+		}
+	}
+}
+
+// WithAllowedTargets restricts the handler to scraping only the specified
+// targets, such as device IDs or addresses. Requests for any other target are
+// rejected with HTTP 403. A target is also allowed if the address it is
+// mapped to using WithTargets is allowed. By default, any target may be
+// scraped.
+func WithAllowedTargets(targets []string) HandlerOption {
+	return func(h *Handler) {
+		if h.allowed == nil {
+			h.allowed = make(map[string]bool)
+		}
+
+		for _, t := range targets {
+			// An empty entry would otherwise allow any target which is not
+			// mapped to an address.
+			if t != "" {
+				h.allowed[t] = true
+			}
+		}
+	}
+}
+
+// WithStaticTargets configures the targets which are scraped by requests
+// which do not specify a "target" query parameter, so that a fixed set of
+// devices may be served without the multi-target exporter pattern. As with
+// the "target" query parameter, a single target is served unlabeled, and
+// multiple targets are labeled by their targets.
+func WithStaticTargets(targets []string) HandlerOption {
+	return func(h *Handler) {
+		h.staticTargets = parseTargets(targets)
+	}
+}
+
+// WithFailOnError configures whether the handler should fail the entire
+// scrape with an HTTP error when a device cannot be dialed or scraped. By
+// default, such errors are reported using the hdhomerun_up and
+// hdhomerun_scrape_error metrics along with any partial data.
+func WithFailOnError(fail bool) HandlerOption {
+	return func(h *Handler) {
+		h.failOnError = fail
+	}
+}
+
+// WithLegacyCounterGauges configures whether the handler should continue to
+// export cumulative device counters using their original gauge metric names,
+// such as hdhomerun_network_errors, alongside their replacement counters with
+// the _total suffix. This eases migration of existing dashboards and alerts.
+// The original gauges are deprecated, but are exported by default until
+// existing users have had time to migrate.
+func WithLegacyCounterGauges(legacy bool) HandlerOption {
+	return func(h *Handler) {
+		h.legacyCounterGauges = legacy
+	}
+}
+
+// WithTimeout configures the time allowed for each scrape of a device, which
+// bounds dialing the device and every request made during the scrape. By
+// default, scrapes have no timeout unless one is set by a Module, a "timeout"
+// query parameter, or Prometheus's scrape timeout.
+func WithTimeout(d time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.timeout = d
+	}
+}
+
+// WithLogger configures the handler to log details of scrapes to logger,
+// such as the outcome of each scrape at the debug level. By default, nothing
+// is logged.
+func WithLogger(logger *slog.Logger) HandlerOption {
+	return func(h *Handler) {
+		h.logger = logger
+	}
+}
+
+// WithDefaultPort configures the TCP port used to communicate with devices
+// whose targets do not specify a port, such as devices reached through NAT
+// port forwarding. By default, the HDHomeRun device default of 65001 is used.
+func WithDefaultPort(port int) HandlerOption {
+	return func(h *Handler) {
+		h.defaultPort = strconv.Itoa(port)
+	}
+}
+
+// WithTimeoutOffset configures the amount of time subtracted from the scrape
+// timeout sent by Prometheus in the X-Prometheus-Scrape-Timeout-Seconds
+// header, which bounds the time allowed for a scrape of a device. By default,
+// an offset of 500 milliseconds is used.
+func WithTimeoutOffset(d time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.timeoutOffset = d
 	}
 }
 
 // ServeHTTP implements http.Handler.
-func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Prometheus is configured to send a target parameter with each scrape
-	// request. This determines which device should be scraped for metrics.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// The scrape duration includes the time taken to dial the device.
+	start := time.Now()
+
+	targets := parseTargets(r.URL.Query()["target"])
+	if len(targets) == 0 && len(h.staticTargets) > 0 {
+		targets = h.staticTargets
+	}
+
+	// Constant labels may be attached to every metric served by the scrape,
+	// such as to identify a device's site without relabeling.
+	labels, err := scrapeLabels(r.URL.Query())
+	if err != nil {
+		httpError(w, &statusError{
+			code: http.StatusBadRequest,
+			err:  err,
+		})
+		return
+	}
+
+	auto := len(targets) == 1 && targets[0] == AutoTarget
+	if auto {
+		ids, err := h.discoverTargets(r.Context())
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+
+		targets = ids
+	}
+
+	if !auto && len(targets) < 2 {
+		if len(targets) == 1 {
+			r = withTarget(r, targets[0])
+		}
+
+		c, done, err := h.scrapeCollector(r, start)
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		defer done()
+
+		if h.failOnError {
+			// The scrape must complete to determine its status code.
+			metrics := collectMetrics(c)
+			if err := h.scrapeError(targets[0]); err != nil {
+				httpError(w, err)
+				return
+			}
+
+			c = h.cachedCollector(metrics)
+		}
+
+		reg := prometheus.NewRegistry()
+		if err := prometheus.WrapRegistererWith(labels, reg).Register(c); err != nil {
+			httpError(w, &statusError{
+				code: http.StatusBadRequest,
+				err:  fmt.Errorf("failed to apply labels: %v", err),
+			})
+			return
+		}
+
+		promhttp.HandlerFor(newOutcomeGatherer(r.Context(), reg), handlerOpts).ServeHTTP(w, r)
+		return
+	}
+
+	// Multiple devices are served in a single response, with each device's
+	// metrics labeled by its target. Discovered devices are labeled by their
+	// device IDs. Devices are scraped concurrently, and each device's
+	// resources are released as soon as its metrics are collected, so that
+	// one response does not exhaust the handler's concurrency limits.
+	var (
+		wg      sync.WaitGroup
+		metrics = make([][]prometheus.Metric, len(targets))
+		errs    = make([]error, len(targets))
+	)
+
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target string) {
+			defer wg.Done()
+
+			c, done, err := h.scrapeCollector(withTarget(r, target), start)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer done()
+
+			metrics[i] = collectMetrics(c)
+			errs[i] = h.scrapeError(target)
+		}(i, target)
+	}
+	wg.Wait()
+
+	reg := prometheus.NewRegistry()
+	for i, target := range targets {
+		if errs[i] != nil {
+			httpError(w, errs[i])
+			return
+		}
+
+		c := h.cachedCollector(metrics[i])
+		wrapped := prometheus.WrapRegistererWith(labels,
+			prometheus.WrapRegistererWith(prometheus.Labels{"device": target}, reg),
+		)
+		if err := wrapped.Register(c); err != nil {
+			httpError(w, &statusError{
+				code: http.StatusBadRequest,
+				err:  fmt.Errorf("failed to apply labels: %v", err),
+			})
+			return
+		}
+	}
+
+	promhttp.HandlerFor(newOutcomeGatherer(r.Context(), reg), handlerOpts).ServeHTTP(w, r)
+}
+
+// scrapeCollector creates a prometheus.Collector which scrapes the target
+// specified in r's "target" query parameter, for a scrape which began at
+// start. Unless the handler is configured to fail on errors, a device which
+// cannot be dialed is reported using metrics. The returned function must be
+// called to release the collector's resources when it is no longer needed.
+func (h *Handler) scrapeCollector(r *http.Request, start time.Time) (prometheus.Collector, func(), error) {
 	target := r.URL.Query().Get("target")
 	if target == "" {
-		http.Error(w, "missing target parameter", http.StatusBadRequest)
-		return
+		return h.deviceCollector(r, start)
+	}
+
+	// Scrapes with identical parameters are served by a single scrape of
+	// the device, because devices handle concurrent connections poorly. If
+	// caching or polling is enabled, a recent scrape is served without
+	// contacting the device at all.
+	name, _, _ := splitScheme(target)
+	if !h.isAllowed(name) {
+		// Disallowed targets must not be tracked or served from the cache.
+		return nil, nil, &statusError{
+			code: http.StatusForbidden,
+			err:  fmt.Errorf("target %q is not allowed", name),
+		}
+	}
+
+	h.mu.Lock()
+	tc := h.targets[name]
+	h.mu.Unlock()
+
+	s, key := h.state(name), scrapeKey(r.URL.Query(), scrapeAuth(tc, r.URL.Query()))
+	if ttl := h.cacheTTLFor(target, key); ttl > 0 {
+		now := time.Now()
+		if cs, ok := s.cached(key, ttl, now); ok {
+			h.logger.Debug("serving cached metrics", "target", target, "age", now.Sub(cs.time))
+
+			cc := h.cachedCollector(nil)
+			cc.metrics = cc.c.withFreshness(cs, now)
+
+			return cc, func() {}, nil
+		}
+	}
+
+	f, leader := s.join(key)
+	if !leader {
+		h.logger.Debug("waiting on identical scrape in progress", "target", target)
+
+		metrics, err := f.wait(r.Context())
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return h.cachedCollector(metrics), func() {}, nil
+	}
+
+	release, err := h.acquire(r.Context(), name)
+	if err != nil {
+		s.land(key, f, nil, err)
+		return nil, nil, err
 	}
 
-	host, port, err := net.SplitHostPort(target)
+	c, cdone, err := h.deviceCollector(r, start)
 	if err != nil {
+		release()
+		s.land(key, f, nil, err)
+		return nil, nil, err
+	}
+
+	done := func() {
+		cdone()
+		release()
+	}
+
+	sc := &sharedCollector{
+		c:     c,
+		s:     s,
+		key:   key,
+		f:     f,
+		cache: h.cacheTTL > 0,
+	}
+
+	return sc, func() {
+		// Release any waiting scrapes if the collector is never collected.
+		s.land(key, f, nil, errAbandoned)
+		done()
+	}, nil
+}
+
+// deviceCollector creates a prometheus.Collector which scrapes the target
+// specified in r's "target" query parameter, as described by scrapeCollector.
+func (h *Handler) deviceCollector(r *http.Request, start time.Time) (prometheus.Collector, func(), error) {
+	c, done, err := h.collector(r)
+	if err == nil {
+		c.start = start
+		return c, done, nil
+	}
+
+	serr, ok := err.(*statusError)
+	if !ok || h.failOnError {
+		return nil, nil, err
+	}
+
+	derr, ok := serr.err.(*dialError)
+	if !ok {
+		return nil, nil, err
+	}
+
+	h.logger.Debug("failed to dial device", "target", r.URL.Query().Get("target"), "err", derr)
+
+	// Report the dial failure using metrics instead.
+	cfg := collectorConfig{TargetName: r.URL.Query().Get("target")}
+	fc := &failedCollector{
+		c:     newCollector(nil, nil, nil, cfg).(*collector),
+		start: start,
+		err:   derr,
+	}
+
+	return fc, func() {}, nil
+}
+
+// cachedCollector creates a prometheus.Collector which serves metrics from a
+// previous or concurrent scrape.
+func (h *Handler) cachedCollector(metrics []prometheus.Metric) *cachedCollector {
+	return &cachedCollector{
+		c:       newCollector(nil, nil, nil, collectorConfig{}).(*collector),
+		metrics: metrics,
+	}
+}
+
+// scrapeError returns a *statusError describing the most recent scrape of
+// target if it failed and the handler is configured to fail on errors.
+func (h *Handler) scrapeError(target string) error {
+	if !h.failOnError {
+		return nil
+	}
+
+	name, _, _ := splitScheme(target)
+	err := h.state(name).lastScrape().Err
+	if err == nil {
+		return nil
+	}
+
+	return &statusError{
+		code: statusCode(err),
+		err:  err,
+	}
+}
+
+// splitAddr splits addr into a host and port, using defaultPort if addr has
+// none.
+func splitAddr(addr, defaultPort string) (host, port string, err error) {
+	host, port, err = net.SplitHostPort(addr)
+	if err != nil {
+		// An address with colons must either be an IPv6 address or specify
+		// a port.
+		ip := strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+		if strings.Contains(addr, ":") && net.ParseIP(ip) == nil {
+			return "", "", fmt.Errorf("malformed target address %q", addr)
+		}
+
 		// Assume no port was provided and use the default.
-		host = target
-		port = hdhomerunPort
+		host = ip
+		port = defaultPort
 	}
 
-	addr := net.JoinHostPort(host, port)
+	if host == "" {
+		return "", "", fmt.Errorf("malformed target address %q: missing host", addr)
+	}
+
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", "", fmt.Errorf("malformed target address %q: invalid port %q", addr, port)
+	}
 
-	c, err := h.dial(addr)
+	return host, port, nil
+}
+
+// scrapeAuth returns the device auth token used by a scrape of the target
+// with configuration tc and query parameters q. The token may be set
+// per-scrape, so that it need not be stored in the exporter's configuration.
+func scrapeAuth(tc TargetConfig, q url.Values) Secret {
+	if v := q.Get("auth"); v != "" {
+		return Secret(v)
+	}
+
+	return tc.Auth
+}
+
+// hasPort reports whether addr specifies a port.
+func hasPort(addr string) bool {
+	_, _, err := net.SplitHostPort(addr)
+	return err == nil
+}
+
+// splitScheme splits a target such as "http://192.168.1.10" into the target
+// without its scheme and the Protocol selected by the scheme, if any. If the
+// scheme is not supported, target is returned unmodified along with an error.
+func splitScheme(target string) (string, Protocol, error) {
+	i := strings.Index(target, "://")
+	if i == -1 {
+		return target, "", nil
+	}
+
+	switch p := Protocol(strings.ToLower(target[:i])); p {
+	case ProtocolControl, ProtocolHTTP:
+		return target[i+len("://"):], p, nil
+	default:
+		return target, "", fmt.Errorf("unsupported scheme %q for target %q: must be control or http", target[:i], target)
+	}
+}
+
+// parseTargets parses the values of the "target" query parameter, which may
+// be repeated or contain comma-separated targets. Duplicate targets are
+// removed.
+func parseTargets(values []string) []string {
+	var targets []string
+	seen := make(map[string]bool)
+	for _, v := range values {
+		for _, t := range strings.Split(v, ",") {
+			t = strings.TrimSpace(t)
+			if t == "" || seen[t] {
+				continue
+			}
+
+			seen[t] = true
+			targets = append(targets, t)
+		}
+	}
+
+	return targets
+}
+
+// withTarget returns a shallow copy of r whose "target" query parameter is
+// set to target alone.
+func withTarget(r *http.Request, target string) *http.Request {
+	u := *r.URL
+	q := u.Query()
+	q.Set("target", target)
+	u.RawQuery = q.Encode()
+
+	r2 := r.WithContext(r.Context())
+	r2.URL = &u
+
+	return r2
+}
+
+// collector creates a collector for the target specified in r's "target"
+// query parameter. The returned function must be called to release the
+// collector's resources when it is no longer needed.
+func (h *Handler) collector(r *http.Request) (*collector, func(), error) {
+	// Prometheus is configured to send a target parameter with each scrape
+	// request. This determines which device should be scraped for metrics.
+	name := r.URL.Query().Get("target")
+	if name == "" {
+		return nil, nil, &statusError{
+			code: http.StatusBadRequest,
+			err:  errors.New("missing target parameter"),
+		}
+	}
+
+	// The target may specify a scheme which selects the protocol used to
+	// scrape the device, such as when one of its protocols is unresponsive.
+	target, scheme, err := splitScheme(name)
 	if err != nil {
-		http.Error(
-			w,
-			fmt.Sprintf("failed to dial HDHomeRun device at %q: %v", addr, err),
-			http.StatusInternalServerError,
-		)
-		return
+		return nil, nil, &statusError{
+			code: http.StatusBadRequest,
+			err:  err,
+		}
 	}
-	defer c.Close()
 
-	metrics := serveMetrics(newDevice(c))
-	metrics.ServeHTTP(w, r)
+	if !h.isAllowed(target) {
+		return nil, nil, &statusError{
+			code: http.StatusForbidden,
+			err:  fmt.Errorf("target %q is not allowed", target),
+		}
+	}
+
+	m, client, err := h.module(r.URL.Query().Get("module"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	timeout := h.timeout
+	if m.Timeout != 0 {
+		timeout = m.Timeout
+	}
+
+	// The timeout may also be overridden per-scrape, for devices on slow
+	// networks.
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, nil, &statusError{
+				code: http.StatusBadRequest,
+				err:  fmt.Errorf("invalid timeout parameter %q", v),
+			}
+		}
+
+		timeout = d
+	}
+
+	// Metric groups may be enabled selectively per-module or per-scrape, as
+	// with the node_exporter's collect[] parameter.
+	names := r.URL.Query()["collect[]"]
+	if len(names) == 0 {
+		names = m.Collectors
+	}
+
+	collectors, err := parseCollectors(names)
+	if err != nil {
+		return nil, nil, &statusError{
+			code: http.StatusBadRequest,
+			err:  err,
+		}
+	}
+	collectors = collectors.without(h.disabledCollectors)
+
+	// Fail fast within Prometheus's deadline, rather than letting Prometheus
+	// give up on the scrape without any context.
+	if d, ok := h.scrapeTimeout(r); ok && (timeout == 0 || d < timeout) {
+		timeout = d
+	}
+
+	// If configured, replace the logical target with the address which
+	// should actually be dialed.
+	h.mu.Lock()
+	tc := h.targets[target]
+	h.mu.Unlock()
+
+	addr := target
+	resolved := tc.Address == "" && h.discover != nil && isDeviceID(target)
+	switch {
+	case tc.Address != "":
+		addr = tc.Address
+	case resolved:
+		a, err := h.resolve(r.Context(), target)
+		if err != nil {
+			derr := &dialError{
+				err:     fmt.Errorf("failed to resolve HDHomeRun device %q: %v", target, err),
+				timeout: isTimeout(err),
+			}
+
+			h.state(target).recordScrape(time.Now(), backendControl, derr)
+
+			return nil, nil, &statusError{
+				code: statusCode(derr),
+				err:  derr,
+			}
+		}
+
+		addr = a
+	}
+
+	host, port, err := splitAddr(addr, h.defaultPort)
+	if err != nil {
+		return nil, nil, &statusError{
+			code: http.StatusBadRequest,
+			err:  err,
+		}
+	}
+
+	// A port found by discovery or filled in by default is a control
+	// protocol port, but a port given by the target or its configuration is
+	// used as is.
+	explicitPort := !resolved && hasPort(addr)
+
+	addr = net.JoinHostPort(host, port)
+
+	s := h.state(target)
+	s.setAddr(addr)
+
+	auth := scrapeAuth(tc, r.URL.Query())
+
+	protocol := ProtocolBoth
+	switch {
+	case scheme != "":
+		protocol = scheme
+	case tc.Protocol != "":
+		protocol = tc.Protocol
+	case m.Protocol != "":
+		protocol = m.Protocol
+	}
+
+	tunerKeys := m.TunerKeys
+	if m.Lightweight {
+		tunerKeys = []string{"status"}
+	}
+
+	cfg := collectorConfig{
+		Target:              tc,
+		TargetName:          name,
+		Quirks:              h.quirks,
+		Protocol:            protocol,
+		TunerKeys:           tunerKeys,
+		Collectors:          collectors,
+		Logger:              h.logger,
+		LegacyCounterGauges: h.legacyCounterGauges,
+		FailOnError:         h.failOnError,
+		Timeout:             timeout,
+	}
+
+	ctx, cancel := r.Context(), func() {}
+	if timeout != 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	if protocol == ProtocolHTTP {
+		// The device is not dialed, and its HTTP API is served on the
+		// default HTTP port unless another port is specified.
+		apiHost := host
+		if explicitPort {
+			apiHost = addr
+		}
+
+		a := newAPI(ctx, client, apiHost, auth)
+		c := newCollector(nil, a, s, cfg).(*collector)
+
+		return c, cancel, nil
+	}
+
+	// The timeout is a budget for the entire scrape, so the dial and every
+	// subsequent request to the device share a single deadline.
+	hc, err := h.dialContext(ctx, addr)
+	if err != nil {
+		cancel()
+
+		// The device's address may have changed.
+		if resolved {
+			h.forget(target)
+		}
+
+		derr := &dialError{
+			err:     fmt.Errorf("failed to dial HDHomeRun device at %q: %v", addr, err),
+			timeout: isTimeout(err),
+		}
+
+		s.recordScrape(time.Now(), backendControl, derr)
+
+		return nil, nil, &statusError{
+			code: statusCode(derr),
+			err:  derr,
+		}
+	}
+
+	var deadline time.Time
+	if d, ok := ctx.Deadline(); ok {
+		deadline = d
+	}
+
+	var a api
+	if protocol == ProtocolBoth {
+		a = newAPI(ctx, client, host, auth)
+	}
+
+	c := newCollector(newDevice(hc, deadline), a, s, cfg).(*collector)
+
+	return c, func() {
+		cancel()
+		_ = hc.Close()
+	}, nil
+}
+
+// dialContext dials the device at addr using the Handler's dial function,
+// giving up if ctx is done first. A connection which is established after
+// ctx is done is closed.
+func (h *Handler) dialContext(ctx context.Context, addr string) (*hdhomerun.Client, error) {
+	type result struct {
+		c   *hdhomerun.Client
+		err error
+	}
+
+	resC := make(chan result, 1)
+	go func() {
+		c, err := h.dial(addr)
+		resC <- result{c: c, err: err}
+	}()
+
+	select {
+	case res := <-resC:
+		return res.c, res.err
+	case <-ctx.Done():
+		go func() {
+			if res := <-resC; res.err == nil {
+				_ = res.c.Close()
+			}
+		}()
+
+		return nil, ctx.Err()
+	}
+}
+
+// scrapeTimeout returns the time remaining for a scrape according to the
+// X-Prometheus-Scrape-Timeout-Seconds header, less the handler's timeout
+// offset, if the header is set.
+func (h *Handler) scrapeTimeout(r *http.Request) (time.Duration, bool) {
+	v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if v == "" {
+		return 0, false
+	}
+
+	secs, err := strconv.ParseFloat(v, 64)
+	if err != nil || secs <= 0 {
+		return 0, false
+	}
+
+	d := time.Duration(secs * float64(time.Second))
+	if d > h.timeoutOffset {
+		// Only apply the offset if time would remain for the scrape.
+		d -= h.timeoutOffset
+	}
+
+	return d, true
+}
+
+// isAllowed determines if target may be scraped.
+func (h *Handler) isAllowed(target string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.allowed == nil || h.allowed[target] {
+		return true
+	}
+
+	addr := h.targets[target].Address
+	return addr != "" && h.allowed[addr]
+}
+
+// module returns the Module with the specified name and its HTTP client. If
+// name is empty, the module named DefaultModule is used if configured, and
+// otherwise, the zero Module.
+func (h *Handler) module(name string) (Module, *http.Client, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if name == "" {
+		name = DefaultModule
+		if _, ok := h.modules[name]; !ok {
+			return Module{}, h.client, nil
+		}
+	}
+
+	m, ok := h.modules[name]
+	if !ok {
+		return Module{}, nil, &statusError{
+			code: http.StatusBadRequest,
+			err:  fmt.Errorf("unknown module %q", name),
+		}
+	}
+
+	return m, h.clients[name], nil
+}
+
+// Close closes the idle HTTP connections kept open for reuse by the
+// handler's HTTP clients, such as when the exporter shuts down. Scrapes which
+// are in progress are not interrupted, and the handler may continue to be
+// used after Close, though new connections will be dialed.
+func (h *Handler) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.client.CloseIdleConnections()
+	for _, c := range h.clients {
+		c.CloseIdleConnections()
+	}
+
+	return nil
+}
+
+// A statusError is an error which should be reported to an HTTP client with
+// a specific status code.
+type statusError struct {
+	code int
+	err  error
+}
+
+func (err *statusError) Error() string { return err.err.Error() }
+
+// httpError replies to an HTTP request with err, using the status code from
+// a *statusError if possible.
+func httpError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	if serr, ok := err.(*statusError); ok {
+		code = serr.code
+	}
+
+	http.Error(w, err.Error(), code)
+}
+
+// WithQuirks adds or replaces entries in the table of Quirks applied to devices
+// based on their hardware model, as reported by /sys/hwmodel.
+func WithQuirks(quirks map[string]Quirks) HandlerOption {
+	return func(h *Handler) {
+		for k, v := range quirks {
+			h.quirks[k] = v
+		}
+	}
+}
+
+// state returns the deviceState for target, creating it if necessary.
+func (h *Handler) state(target string) *deviceState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	s, ok := h.devices[target]
+	if !ok {
+		// Targets may be arbitrary, so discard the state of any devices
+		// which are no longer scraped before tracking another.
+		h.evictIdle(now)
+
+		s = newDeviceState()
+		h.devices[target] = s
+	}
+	s.touch(now)
+
+	return s
+}
+
+// evictIdle discards the state of any devices which are idle as of now. The
+// caller must hold h.mu.
+func (h *Handler) evictIdle(now time.Time) {
+	for target, s := range h.devices {
+		if s.idle(now) {
+			delete(h.devices, target)
+		}
+	}
+}
+
+// A failedCollector is a prometheus.Collector which reports a device that
+// could not be scraped at all, such as due to a dial failure.
+type failedCollector struct {
+	c     *collector
+	start time.Time
+	err   error
+}
+
+// Describe implements prometheus.Collector.
+func (fc *failedCollector) Describe(ch chan<- *prometheus.Desc) { fc.c.Describe(ch) }
+
+// Collect implements prometheus.Collector.
+func (fc *failedCollector) Collect(ch chan<- prometheus.Metric) {
+	fc.c.collectDuration(ch, fc.start)
+	fc.c.collectUp(ch, fc.err)
+}
+
+// handlerOpts are the options for each of the Handler's metrics responses.
+// OpenMetrics is negotiated with clients which support it, so that counters
+// maintained by the exporter carry their creation time.
+var handlerOpts = promhttp.HandlerOpts{
+	EnableOpenMetrics:                   true,
+	EnableOpenMetricsTextCreatedSamples: true,
+}
+
+// serveMetrics creates a Prometheus metrics handler for a device and its
+// api, using deviceState s to track state across scrapes and cfg to configure
+// collection.
+func serveMetrics(d device, a api, s *deviceState, cfg collectorConfig) http.Handler {
+	return serveCollector(newCollector(d, a, s, cfg))
 }
 
-// serveMetrics creates a Prometheus metrics handler for a Device.
-func serveMetrics(d device) http.Handler {
+// serveCollector creates a Prometheus metrics handler for a collector.
+func serveCollector(c prometheus.Collector) http.Handler {
 	reg := prometheus.NewRegistry()
-	reg.MustRegister(newCollector(d))
+	reg.MustRegister(c)
 
-	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+	return promhttp.HandlerFor(reg, handlerOpts)
 }
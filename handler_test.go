@@ -1,11 +1,19 @@
 package hdhomerunexporter_test
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/mdlayher/hdhomerun"
@@ -14,48 +22,812 @@ import (
 
 func TestNewHandler(t *testing.T) {
 	tests := []struct {
-		name   string
-		target string
-		code   int
+		name    string
+		target  string
+		module  string
+		timeout string
+		options []hdhomerunexporter.HandlerOption
+		addr    string
+		code    int
 	}{
 		{
 			name: "no target",
 			code: http.StatusBadRequest,
 		},
 		{
-			name:   "bad target",
+			name:   "bad target port",
 			target: "foo:bar",
-			code:   http.StatusInternalServerError,
+			code:   http.StatusBadRequest,
+		},
+		{
+			name:   "bad target",
+			target: "foo:bar:baz",
+			code:   http.StatusBadRequest,
+		},
+		{
+			name:   "target IPv6 no port",
+			target: "fe80::1",
+			addr:   "[fe80::1]:65001",
+			code:   http.StatusOK,
 		},
 		{
 			name:   "target no port",
 			target: "foo",
-			code:   http.StatusInternalServerError,
+			addr:   "foo:65001",
+			code:   http.StatusOK,
+		},
+		{
+			name:   "target default port",
+			target: "foo",
+			options: []hdhomerunexporter.HandlerOption{
+				hdhomerunexporter.WithDefaultPort(8001),
+			},
+			addr: "foo:8001",
+			code: http.StatusOK,
+		},
+		{
+			name:   "target address rewritten",
+			target: "1040a1b2",
+			options: []hdhomerunexporter.HandlerOption{
+				hdhomerunexporter.WithTargets(map[string]hdhomerunexporter.TargetConfig{
+					"1040a1b2": {Address: "203.0.113.1:8000"},
+				}),
+			},
+			addr: "203.0.113.1:8000",
+			code: http.StatusOK,
+		},
+		{
+			name:   "target address rewritten no port",
+			target: "192.168.1.10",
+			options: []hdhomerunexporter.HandlerOption{
+				hdhomerunexporter.WithTargets(map[string]hdhomerunexporter.TargetConfig{
+					"192.168.1.10": {Address: "203.0.113.1"},
+				}),
+			},
+			addr: "203.0.113.1:65001",
+			code: http.StatusOK,
+		},
+		{
+			name:   "static target overridden",
+			target: "bar",
+			options: []hdhomerunexporter.HandlerOption{
+				hdhomerunexporter.WithStaticTargets([]string{"foo"}),
+			},
+			addr: "bar:65001",
+			code: http.StatusOK,
+		},
+		{
+			name:   "unknown module",
+			target: "foo",
+			module: "bar",
+			code:   http.StatusBadRequest,
+		},
+		{
+			name:    "bad timeout",
+			target:  "foo",
+			timeout: "foo",
+			code:    http.StatusBadRequest,
+		},
+		{
+			name:    "timeout",
+			target:  "foo",
+			timeout: "2s",
+			addr:    "foo:65001",
+			code:    http.StatusOK,
+		},
+		{
+			name:   "known module",
+			target: "foo",
+			module: "legacy",
+			options: []hdhomerunexporter.HandlerOption{
+				hdhomerunexporter.WithModules(map[string]hdhomerunexporter.Module{
+					"legacy": {Protocol: hdhomerunexporter.ProtocolControl},
+				}),
+			},
+			addr: "foo:65001",
+			code: http.StatusOK,
+		},
+		{
+			// The device is not dialed when only its HTTP API is used.
+			name:   "default module",
+			target: "127.0.0.1:1",
+			options: []hdhomerunexporter.HandlerOption{
+				hdhomerunexporter.WithModules(map[string]hdhomerunexporter.Module{
+					hdhomerunexporter.DefaultModule: {Protocol: hdhomerunexporter.ProtocolHTTP},
+				}),
+			},
+			code: http.StatusOK,
+		},
+		{
+			name:   "control scheme",
+			target: "control://foo",
+			options: []hdhomerunexporter.HandlerOption{
+				hdhomerunexporter.WithModules(map[string]hdhomerunexporter.Module{
+					hdhomerunexporter.DefaultModule: {Protocol: hdhomerunexporter.ProtocolHTTP},
+				}),
+			},
+			addr: "foo:65001",
+			code: http.StatusOK,
+		},
+		{
+			// The device is not dialed when only its HTTP API is used.
+			name:   "http scheme",
+			target: "http://127.0.0.1:1",
+			code:   http.StatusOK,
+		},
+		{
+			name:   "bad scheme",
+			target: "ftp://foo",
+			code:   http.StatusBadRequest,
+		},
+		{
+			name:   "target not allowed",
+			target: "foo",
+			options: []hdhomerunexporter.HandlerOption{
+				hdhomerunexporter.WithAllowedTargets([]string{"bar"}),
+			},
+			code: http.StatusForbidden,
+		},
+		{
+			name:   "target allowed",
+			target: "foo",
+			options: []hdhomerunexporter.HandlerOption{
+				hdhomerunexporter.WithAllowedTargets([]string{"foo", "bar"}),
+			},
+			addr: "foo:65001",
+			code: http.StatusOK,
+		},
+		{
+			name:   "empty allowed target ignored",
+			target: "foo",
+			options: []hdhomerunexporter.HandlerOption{
+				hdhomerunexporter.WithAllowedTargets([]string{"", "bar"}),
+			},
+			code: http.StatusForbidden,
+		},
+		{
+			name:   "mapped address allowed",
+			target: "1040a1b2",
+			options: []hdhomerunexporter.HandlerOption{
+				hdhomerunexporter.WithTargets(map[string]hdhomerunexporter.TargetConfig{
+					"1040a1b2": {Address: "203.0.113.1:8000"},
+				}),
+				hdhomerunexporter.WithAllowedTargets([]string{"203.0.113.1:8000"}),
+			},
+			addr: "203.0.113.1:8000",
+			code: http.StatusOK,
+		},
+		{
+			name:   "device ID discovered",
+			target: "1040a1b2",
+			options: []hdhomerunexporter.HandlerOption{
+				hdhomerunexporter.WithDiscovery(testDiscover),
+			},
+			addr: "192.168.1.10:65001",
+			code: http.StatusOK,
+		},
+		{
+			name:   "device ID not discovered",
+			target: "1040ffff",
+			options: []hdhomerunexporter.HandlerOption{
+				hdhomerunexporter.WithDiscovery(testDiscover),
+			},
+			code: http.StatusOK,
+		},
+		{
+			name:   "fail on error",
+			target: "foo",
+			options: []hdhomerunexporter.HandlerOption{
+				hdhomerunexporter.WithFailOnError(true),
+			},
+			addr: "foo:65001",
+			code: http.StatusBadGateway,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			res := testHandler(t, tt.target)
+			res, addr := testHandler(t, tt.target, tt.module, tt.timeout, tt.options...)
 
 			if diff := cmp.Diff(tt.code, res.StatusCode); diff != "" {
 				t.Fatalf("unexpected HTTP status code (-want +got):\n%s", diff)
 			}
+
+			if diff := cmp.Diff(tt.addr, addr); diff != "" {
+				t.Fatalf("unexpected dial address (-want +got):\n%s", diff)
+			}
+
+			if res.StatusCode != http.StatusOK {
+				return
+			}
+
+			// Dial and HTTP API failures are reported using metrics.
+			b, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("failed to read response body: %v", err)
+			}
+
+			ms := []string{
+				`hdhomerun_scrape_duration_seconds `,
+				`hdhomerun_up 0`,
+			}
+			if tt.addr != "" {
+				ms = append(ms,
+					fmt.Sprintf(`hdhomerun_scrape_error{class="dial",target=%q} 1`, tt.target),
+				)
+			}
+
+			for _, m := range ms {
+				if !strings.Contains(string(b), m) {
+					t.Fatalf("metric %q not found in response:\n%s", m, string(b))
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerMultipleTargets(t *testing.T) {
+	dial := func(_ string) (*hdhomerun.Client, error) {
+		return nil, errors.New("always fails")
+	}
+
+	s := httptest.NewServer(hdhomerunexporter.NewHandler(dial))
+	defer s.Close()
+
+	res, err := http.Get(s.URL + "?target=foo,bar&target=foo")
+	if err != nil {
+		t.Fatalf("failed to perform HTTP request: %v", err)
+	}
+	defer res.Body.Close()
+
+	if diff := cmp.Diff(http.StatusOK, res.StatusCode); diff != "" {
+		t.Fatalf("unexpected HTTP status code (-want +got):\n%s", diff)
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("failed to read response body: %v", err)
+	}
+
+	for _, m := range []string{
+		`hdhomerun_up{device="bar"} 0`,
+		`hdhomerun_up{device="foo"} 0`,
+	} {
+		if !strings.Contains(string(b), m) {
+			t.Fatalf("metric %q not found in response:\n%s", m, string(b))
+		}
+	}
+}
+
+func TestHandlerHTTPAPIPort(t *testing.T) {
+	var hits atomic.Int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		hits.Add(1)
+		http.NotFound(w, nil)
+	}))
+	defer api.Close()
+
+	u, err := url.Parse(api.URL)
+	if err != nil {
+		t.Fatalf("failed to parse URL: %v", err)
+	}
+
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatalf("failed to parse port: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		target  string
+		options []hdhomerunexporter.HandlerOption
+		ok      bool
+	}{
+		{
+			name:   "explicit port",
+			target: "http://" + u.Host,
+			ok:     true,
+		},
+		{
+			// The port matches the default control protocol port, but was
+			// given explicitly, so it must still be used.
+			name:   "explicit default port",
+			target: "http://" + u.Host,
+			options: []hdhomerunexporter.HandlerOption{
+				hdhomerunexporter.WithDefaultPort(port),
+			},
+			ok: true,
+		},
+		{
+			name:   "configured port",
+			target: "http://foo",
+			options: []hdhomerunexporter.HandlerOption{
+				hdhomerunexporter.WithTargets(map[string]hdhomerunexporter.TargetConfig{
+					"foo": {Address: u.Host},
+				}),
+			},
+			ok: true,
+		},
+		{
+			// The default control protocol port is not used for the HTTP
+			// API, so the test server is not reached.
+			name:   "default port",
+			target: "http://" + u.Hostname(),
+			options: []hdhomerunexporter.HandlerOption{
+				hdhomerunexporter.WithDefaultPort(port),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits.Store(0)
+
+			s := httptest.NewServer(hdhomerunexporter.NewHandler(nil, tt.options...))
+			defer s.Close()
+
+			res, err := http.Get(s.URL + "?target=" + url.QueryEscape(tt.target))
+			if err != nil {
+				t.Fatalf("failed to perform HTTP request: %v", err)
+			}
+			_ = res.Body.Close()
+
+			if diff := cmp.Diff(tt.ok, hits.Load() > 0); diff != "" {
+				t.Fatalf("unexpected HTTP API use (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandlerDialTimeout(t *testing.T) {
+	// The dial never completes, so only the scrape's deadline can end it.
+	block := make(chan struct{})
+	defer close(block)
+
+	dial := func(_ string) (*hdhomerun.Client, error) {
+		<-block
+		return nil, errors.New("dial canceled")
+	}
+
+	s := httptest.NewServer(hdhomerunexporter.NewHandler(dial))
+	defer s.Close()
+
+	c := &http.Client{Timeout: 5 * time.Second}
+	res, err := c.Get(s.URL + "?target=foo&timeout=50ms")
+	if err != nil {
+		t.Fatalf("failed to perform HTTP request: %v", err)
+	}
+	defer res.Body.Close()
+
+	if diff := cmp.Diff(http.StatusOK, res.StatusCode); diff != "" {
+		t.Fatalf("unexpected HTTP status code (-want +got):\n%s", diff)
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("failed to read response body: %v", err)
+	}
+
+	const m = `hdhomerun_up 0`
+	if !strings.Contains(string(b), m) {
+		t.Fatalf("metric %q not found in response:\n%s", m, string(b))
+	}
+}
+
+func TestHandlerStaticTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []string
+		metrics []string
+	}{
+		{
+			name:    "one",
+			targets: []string{"foo"},
+			metrics: []string{
+				`hdhomerun_up 0`,
+				`hdhomerun_scrape_error{class="dial",target="foo"} 1`,
+			},
+		},
+		{
+			name:    "multiple",
+			targets: []string{"foo", "bar"},
+			metrics: []string{
+				`hdhomerun_up{device="bar"} 0`,
+				`hdhomerun_up{device="foo"} 0`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dial := func(_ string) (*hdhomerun.Client, error) {
+				return nil, errors.New("always fails")
+			}
+
+			s := httptest.NewServer(hdhomerunexporter.NewHandler(
+				dial,
+				hdhomerunexporter.WithStaticTargets(tt.targets),
+			))
+			defer s.Close()
+
+			res, err := http.Get(s.URL)
+			if err != nil {
+				t.Fatalf("failed to perform HTTP request: %v", err)
+			}
+			defer res.Body.Close()
+
+			if diff := cmp.Diff(http.StatusOK, res.StatusCode); diff != "" {
+				t.Fatalf("unexpected HTTP status code (-want +got):\n%s", diff)
+			}
+
+			b, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("failed to read response body: %v", err)
+			}
+
+			for _, m := range tt.metrics {
+				if !strings.Contains(string(b), m) {
+					t.Fatalf("metric %q not found in response:\n%s", m, string(b))
+				}
+			}
 		})
 	}
 }
 
+func TestHandlerLabels(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		code  int
+		want  []string
+	}{
+		{
+			name:  "single target",
+			query: "target=foo&label_site=garage",
+			code:  http.StatusOK,
+			want:  []string{`hdhomerun_up{site="garage"} 0`},
+		},
+		{
+			name:  "multiple targets",
+			query: "target=foo,bar&label_site=garage",
+			code:  http.StatusOK,
+			want: []string{
+				`hdhomerun_up{device="bar",site="garage"} 0`,
+				`hdhomerun_up{device="foo",site="garage"} 0`,
+			},
+		},
+		{
+			name:  "invalid name",
+			query: "target=foo&label_0site=garage",
+			code:  http.StatusBadRequest,
+		},
+		{
+			name:  "repeated",
+			query: "target=foo&label_site=garage&label_site=attic",
+			code:  http.StatusBadRequest,
+		},
+		{
+			name:  "conflicts with metric label",
+			query: "target=foo&label_class=foo",
+			code:  http.StatusBadRequest,
+		},
+		{
+			name:  "conflicts with device label",
+			query: "target=foo,bar&label_device=foo",
+			code:  http.StatusBadRequest,
+		},
+	}
+
+	dial := func(_ string) (*hdhomerun.Client, error) {
+		return nil, errors.New("always fails")
+	}
+
+	s := httptest.NewServer(hdhomerunexporter.NewHandler(dial))
+	defer s.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := http.Get(s.URL + "?" + tt.query)
+			if err != nil {
+				t.Fatalf("failed to perform HTTP request: %v", err)
+			}
+			defer res.Body.Close()
+
+			if diff := cmp.Diff(tt.code, res.StatusCode); diff != "" {
+				t.Fatalf("unexpected HTTP status code (-want +got):\n%s", diff)
+			}
+
+			b, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("failed to read response body: %v", err)
+			}
+
+			for _, m := range tt.want {
+				if !strings.Contains(string(b), m) {
+					t.Fatalf("metric %q not found in response:\n%s", m, string(b))
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerLogger(t *testing.T) {
+	dial := func(_ string) (*hdhomerun.Client, error) {
+		return nil, errors.New("always fails")
+	}
+
+	var buf bytes.Buffer
+	h := hdhomerunexporter.NewHandler(dial,
+		hdhomerunexporter.WithLogger(testLogger(&buf)),
+	)
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	res, err := http.Get(s.URL + "?target=foo")
+	if err != nil {
+		t.Fatalf("failed to perform HTTP request: %v", err)
+	}
+	_ = res.Body.Close()
+
+	want := `level=DEBUG msg="failed to dial device" target=foo`
+	if !strings.Contains(buf.String(), want) {
+		t.Fatalf("log output does not contain %q:\n%s", want, buf.String())
+	}
+}
+
+func TestHandlerUnknownCollector(t *testing.T) {
+	dial := func(_ string) (*hdhomerun.Client, error) {
+		return nil, errors.New("always fails")
+	}
+
+	s := httptest.NewServer(hdhomerunexporter.NewHandler(dial))
+	defer s.Close()
+
+	res, err := http.Get(s.URL + "?target=foo&collect[]=tuner&collect[]=bar")
+	if err != nil {
+		t.Fatalf("failed to perform HTTP request: %v", err)
+	}
+	defer res.Body.Close()
+
+	if diff := cmp.Diff(http.StatusBadRequest, res.StatusCode); diff != "" {
+		t.Fatalf("unexpected HTTP status code (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandlerAutoTarget(t *testing.T) {
+	var dialed string
+	dial := func(addr string) (*hdhomerun.Client, error) {
+		dialed = addr
+		return nil, errors.New("always fails")
+	}
+
+	s := httptest.NewServer(hdhomerunexporter.NewHandler(
+		dial,
+		hdhomerunexporter.WithDiscovery(testDiscover),
+	))
+	defer s.Close()
+
+	res, err := http.Get(s.URL + "?target=" + hdhomerunexporter.AutoTarget)
+	if err != nil {
+		t.Fatalf("failed to perform HTTP request: %v", err)
+	}
+	defer res.Body.Close()
+
+	if diff := cmp.Diff(http.StatusOK, res.StatusCode); diff != "" {
+		t.Fatalf("unexpected HTTP status code (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff("192.168.1.10:65001", dialed); diff != "" {
+		t.Fatalf("unexpected dial address (-want +got):\n%s", diff)
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("failed to read response body: %v", err)
+	}
+
+	const m = `hdhomerun_up{device="1040A1B2"} 0`
+	if !strings.Contains(string(b), m) {
+		t.Fatalf("metric %q not found in response:\n%s", m, string(b))
+	}
+}
+
+func TestHandlerHealthy(t *testing.T) {
+	h := hdhomerunexporter.NewHandler(nil)
+
+	s := httptest.NewServer(h.Healthy())
+	defer s.Close()
+
+	res, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatalf("failed to perform HTTP request: %v", err)
+	}
+	defer res.Body.Close()
+
+	if diff := cmp.Diff(http.StatusOK, res.StatusCode); diff != "" {
+		t.Fatalf("unexpected HTTP status code (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandlerReady(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []hdhomerunexporter.HandlerOption
+		scrape  bool
+		code    int
+	}{
+		{
+			name: "ready",
+			code: http.StatusOK,
+		},
+		{
+			name: "no device scraped",
+			options: []hdhomerunexporter.HandlerOption{
+				hdhomerunexporter.WithReadyRequiresDevice(true),
+			},
+			code: http.StatusServiceUnavailable,
+		},
+		{
+			name: "no device reachable",
+			options: []hdhomerunexporter.HandlerOption{
+				hdhomerunexporter.WithReadyRequiresDevice(true),
+			},
+			scrape: true,
+			code:   http.StatusServiceUnavailable,
+		},
+	}
+
+	dial := func(_ string) (*hdhomerun.Client, error) {
+		return nil, errors.New("always fails")
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := hdhomerunexporter.NewHandler(dial, tt.options...)
+
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", h)
+			mux.Handle("/-/ready", h.Ready())
+
+			s := httptest.NewServer(mux)
+			defer s.Close()
+
+			if tt.scrape {
+				res, err := http.Get(s.URL + "/metrics?target=foo")
+				if err != nil {
+					t.Fatalf("failed to perform HTTP request: %v", err)
+				}
+				_ = res.Body.Close()
+			}
+
+			res, err := http.Get(s.URL + "/-/ready")
+			if err != nil {
+				t.Fatalf("failed to perform HTTP request: %v", err)
+			}
+			defer res.Body.Close()
+
+			if diff := cmp.Diff(tt.code, res.StatusCode); diff != "" {
+				t.Fatalf("unexpected HTTP status code (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandlerStream(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		code  int
+	}{
+		{
+			name: "no target",
+			code: http.StatusBadRequest,
+		},
+		{
+			name:  "bad interval",
+			query: "target=foo&interval=bar",
+			code:  http.StatusBadRequest,
+		},
+		{
+			name:  "dial failure",
+			query: "target=foo&interval=1s",
+			code:  http.StatusBadGateway,
+		},
+	}
+
+	dial := func(_ string) (*hdhomerun.Client, error) {
+		return nil, errors.New("always fails")
+	}
+
+	s := httptest.NewServer(hdhomerunexporter.NewHandler(dial).Stream())
+	defer s.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := http.Get(s.URL + "?" + tt.query)
+			if err != nil {
+				t.Fatalf("failed to perform HTTP request: %v", err)
+			}
+			defer res.Body.Close()
+
+			if diff := cmp.Diff(tt.code, res.StatusCode); diff != "" {
+				t.Fatalf("unexpected HTTP status code (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandlerStatusAPI(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		code  int
+	}{
+		{
+			name: "no target",
+			code: http.StatusBadRequest,
+		},
+		{
+			name:  "dial failure",
+			query: "target=foo",
+			code:  http.StatusBadGateway,
+		},
+	}
+
+	dial := func(_ string) (*hdhomerun.Client, error) {
+		return nil, errors.New("always fails")
+	}
+
+	s := httptest.NewServer(hdhomerunexporter.NewHandler(dial).StatusAPI())
+	defer s.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := http.Get(s.URL + "?" + tt.query)
+			if err != nil {
+				t.Fatalf("failed to perform HTTP request: %v", err)
+			}
+			defer res.Body.Close()
+
+			if diff := cmp.Diff(tt.code, res.StatusCode); diff != "" {
+				t.Fatalf("unexpected HTTP status code (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// testDiscover is a hdhomerunexporter.DiscoverFunc which discovers a single
+// device.
+func testDiscover(_ context.Context, id string) ([]*hdhomerun.DiscoveredDevice, error) {
+	d := &hdhomerun.DiscoveredDevice{
+		ID:     "1040A1B2",
+		Addr:   "192.168.1.10:65001",
+		Type:   hdhomerun.DeviceTypeTuner,
+		Tuners: 2,
+	}
+
+	if id != "" && !strings.EqualFold(id, d.ID) {
+		return nil, nil
+	}
+
+	return []*hdhomerun.DiscoveredDevice{d}, nil
+}
+
 // testHandler performs a single HTTP request to a handler created using
-// NewHandler, using the specified target.
-func testHandler(t *testing.T, target string) *http.Response {
+// NewHandler, using the specified target, module, timeout, and options. The address passed
+// to the handler's dial function is returned along with the response.
+func testHandler(t *testing.T, target, module, timeout string, options ...hdhomerunexporter.HandlerOption) (*http.Response, string) {
 	t.Helper()
 
+	var dialed string
 	dial := func(addr string) (*hdhomerun.Client, error) {
 		t.Logf("target: %s", addr)
+		dialed = addr
 		return nil, errors.New("always fails")
 	}
 
-	s := httptest.NewServer(hdhomerunexporter.NewHandler(dial))
+	s := httptest.NewServer(hdhomerunexporter.NewHandler(dial, options...))
 	defer s.Close()
 
 	u, err := url.Parse(s.URL)
@@ -63,16 +835,22 @@ func testHandler(t *testing.T, target string) *http.Response {
 		t.Fatalf("failed to parse URL: %v", err)
 	}
 
+	q := u.Query()
 	if target != "" {
-		q := u.Query()
 		q.Set("target", target)
-		u.RawQuery = q.Encode()
 	}
+	if module != "" {
+		q.Set("module", module)
+	}
+	if timeout != "" {
+		q.Set("timeout", timeout)
+	}
+	u.RawQuery = q.Encode()
 
 	res, err := http.Get(u.String())
 	if err != nil {
 		t.Fatalf("failed to perform HTTP request: %v", err)
 	}
 
-	return res
+	return res, dialed
 }
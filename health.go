@@ -0,0 +1,59 @@
+package hdhomerunexporter
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// WithReadyRequiresDevice configures whether the handler returned by Ready
+// reports the exporter as ready only once at least one device has been
+// scraped successfully. By default, the exporter is ready as soon as it is
+// serving requests.
+func WithReadyRequiresDevice(require bool) HandlerOption {
+	return func(h *Handler) {
+		h.readyRequiresDevice = require
+	}
+}
+
+// Healthy returns an http.Handler which reports that the exporter is alive,
+// for use as a liveness check.
+func (h *Handler) Healthy() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprintln(w, "HDHomeRun exporter is healthy.")
+	})
+}
+
+// Ready returns an http.Handler which reports whether the exporter is ready
+// to serve scrapes, for use as a readiness check. Because the exporter's
+// configuration is loaded before it begins serving requests, the exporter is
+// ready whenever it can respond, unless WithReadyRequiresDevice is set.
+func (h *Handler) Ready() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if h.readyRequiresDevice && !h.deviceReachable() {
+			http.Error(w, "HDHomeRun exporter is not ready: no device has been scraped successfully.", http.StatusServiceUnavailable)
+			return
+		}
+
+		_, _ = fmt.Fprintln(w, "HDHomeRun exporter is ready.")
+	})
+}
+
+// deviceReachable determines if the most recent scrape of any device
+// succeeded.
+func (h *Handler) deviceReachable() bool {
+	h.mu.Lock()
+	states := make([]*deviceState, 0, len(h.devices))
+	for _, s := range h.devices {
+		states = append(states, s)
+	}
+	h.mu.Unlock()
+
+	for _, s := range states {
+		scrape := s.lastScrape()
+		if !scrape.Time.IsZero() && scrape.Err == nil {
+			return true
+		}
+	}
+
+	return false
+}
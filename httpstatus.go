@@ -0,0 +1,272 @@
+package hdhomerunexporter
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// A tunerStatusJSON is the status of a tuner served by an HDHomeRun device's
+// status.json endpoint.
+type tunerStatusJSON struct {
+	Resource              string
+	VctNumber             string `json:",omitempty"`
+	Frequency             int    `json:",omitempty"`
+	SignalStrengthPercent int    `json:",omitempty"`
+	SignalQualityPercent  int    `json:",omitempty"`
+	SymbolQualityPercent  int    `json:",omitempty"`
+	TargetIP              string `json:",omitempty"`
+	NetworkRate           int    `json:",omitempty"`
+
+	// tuner is the tuner index parsed from Resource.
+	tuner string
+}
+
+// tunerStatusJSON fetches the status of the device's tuners from its HTTP
+// API, omitting any tuners which should not be collected. A device which
+// does not serve status.json reports no tuners.
+func (c *collector) tunerStatusJSON() ([]tunerStatusJSON, error) {
+	var status []tunerStatusJSON
+	switch err := c.a.Get("/status.json", &status); err {
+	case nil:
+	case errNotFound:
+		return nil, nil
+	default:
+		return nil, err
+	}
+
+	skip := make(map[string]bool, len(c.cfg.Target.SkipTuners))
+	for _, i := range c.cfg.Target.SkipTuners {
+		skip[strconv.Itoa(i)] = true
+	}
+
+	tuners := make([]tunerStatusJSON, 0, len(status))
+	for _, s := range status {
+		// Only tuner resources are reported, such as "tuner0".
+		tuner := strings.TrimPrefix(s.Resource, "tuner")
+		if tuner == s.Resource || skip[tuner] {
+			continue
+		}
+
+		s.tuner = tuner
+		tuners = append(tuners, s)
+	}
+
+	return tuners, nil
+}
+
+// collectTunerStatusJSON collects supplemental tuner metrics from the device's
+// HTTP API, which are not available through the control protocol.
+func (c *collector) collectTunerStatusJSON(ch chan<- prometheus.Metric, status []tunerStatusJSON) {
+	for _, s := range status {
+		ch <- prometheus.MustNewConstMetric(
+			c.TunerHTTPTargetInfo,
+			prometheus.GaugeValue,
+			1,
+			s.tuner, s.TargetIP,
+		)
+
+		ds := []descValue{
+			{
+				desc:  c.TunerHTTPNetworkBytesPerSecond,
+				value: bytesPerSecond(s.NetworkRate),
+			},
+			{
+				desc:  c.TunerHTTPSymbolQualityRatio,
+				value: ratio(s.SymbolQualityPercent),
+			},
+		}
+
+		for _, d := range ds {
+			ch <- prometheus.MustNewConstMetric(
+				d.desc,
+				prometheus.GaugeValue,
+				d.value,
+				s.tuner,
+			)
+		}
+	}
+}
+
+// collectHTTP collects metrics for the device using only its HTTP API, for
+// devices whose control protocol is unreachable. If an error occurs, it
+// returns the description of the metric which could not be collected along
+// with the error.
+func (c *collector) collectHTTP(ch chan<- prometheus.Metric) (*prometheus.Desc, error) {
+	discover, err := c.discoverJSON()
+	if err != nil {
+		return c.DeviceInfo, err
+	}
+
+	c.caps = capabilities{
+		HWModel:  discover.ModelNumber,
+		DeviceID: discover.DeviceID,
+		HTTPAPI:  true,
+		Storage:  discover.StorageID != "" || discover.StorageURL != "",
+	}
+
+	c.collectDiscoverDeviceInfo(ch, discover)
+
+	if desc, err := c.collectAPI(ch, &discover); err != nil {
+		return desc, err
+	}
+
+	if c.caps.Storage {
+		return nil, nil
+	}
+
+	status, err := c.tunerStatusJSON()
+	if err != nil {
+		return c.TunerHTTPTargetInfo, err
+	}
+
+	tunerMetrics := c.cfg.Collectors.enabled(collectorTuner)
+	if tunerMetrics {
+		c.collectTunerStatusJSON(ch, status)
+	}
+
+	var inUse int
+	for _, s := range status {
+		// Idle tuners report no frequency.
+		if s.Frequency != 0 {
+			inUse++
+		}
+
+		if tunerMetrics {
+			c.collectTunerStatusSignal(ch, s)
+		}
+	}
+
+	tuners := discover.TunerCount
+	if c.cfg.Target.Tuners != 0 {
+		tuners = c.cfg.Target.Tuners
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		c.DeviceTuners,
+		prometheus.GaugeValue,
+		float64(tuners),
+	)
+
+	ch <- prometheus.MustNewConstMetric(
+		c.DeviceTunersInUse,
+		prometheus.GaugeValue,
+		float64(inUse),
+	)
+
+	return nil, nil
+}
+
+// collectTunerStatusSignal collects a tuner's signal metrics from its HTTP
+// API status, in place of those reported by the control protocol.
+func (c *collector) collectTunerStatusSignal(ch chan<- prometheus.Metric, s tunerStatusJSON) {
+	if s.VctNumber != "" {
+		ch <- prometheus.MustNewConstMetric(
+			c.TunerVChannelInfo,
+			prometheus.GaugeValue,
+			1,
+			s.tuner, s.VctNumber,
+		)
+	}
+
+	ds := []descValue{
+		{
+			desc:  c.TunerSignalStrengthRatio,
+			value: ratio(s.SignalStrengthPercent),
+		},
+		{
+			desc:  c.TunerSignalToNoiseRatio,
+			value: ratio(s.SignalQualityPercent),
+		},
+		{
+			desc:  c.TunerSymbolErrorRatio,
+			value: ratio(s.SymbolQualityPercent),
+		},
+	}
+
+	if s.Frequency != 0 {
+		ds = append(ds, descValue{
+			desc:  c.TunerFrequency,
+			value: float64(s.Frequency),
+		})
+	}
+
+	for _, d := range ds {
+		ch <- prometheus.MustNewConstMetric(
+			d.desc,
+			prometheus.GaugeValue,
+			d.value,
+			s.tuner,
+		)
+	}
+}
+
+// collectDiscoverInfo collects device metadata from the device's HTTP API, if
+// it is available. Errors are ignored, as this is only used as a fallback
+// when the device's metadata cannot be queried using the control protocol.
+func (c *collector) collectDiscoverInfo(ch chan<- prometheus.Metric) {
+	if c.a == nil {
+		return
+	}
+
+	discover, err := c.discoverJSON()
+	if err != nil {
+		return
+	}
+
+	c.collectDiscoverDeviceInfo(ch, discover)
+}
+
+// discoverJSON fetches the device's discover.json from its HTTP API. The
+// result is reused for the remainder of the scrape and cached across scrapes
+// for discoverCacheInterval, as its contents rarely change.
+func (c *collector) discoverJSON() (discoverJSON, error) {
+	if c.discover != nil {
+		return *c.discover, nil
+	}
+
+	now := time.Now()
+	discover, ok := c.s.cachedDiscover(now)
+	if !ok {
+		if err := c.a.Get("/discover.json", &discover); err != nil {
+			return discoverJSON{}, err
+		}
+
+		c.s.setDiscover(discover, now)
+	}
+
+	c.discover = &discover
+	return discover, nil
+}
+
+// collectDiscoverDeviceInfo collects device metadata from discover.
+func (c *collector) collectDiscoverDeviceInfo(ch chan<- prometheus.Metric, discover discoverJSON) {
+	firmware := discover.FirmwareVersion
+	if firmware == "" {
+		firmware = discover.Version
+	}
+
+	// The control protocol's model name is not reported by the HTTP API, so
+	// the device's friendly name, such as "HDHomeRun FLEX 4K", is reported in
+	// its place, or else its hardware model.
+	model := discover.FriendlyName
+	if model == "" {
+		model = discover.ModelNumber
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		c.DeviceInfo,
+		prometheus.GaugeValue,
+		1,
+		model, discover.ModelNumber, firmware, discover.DeviceID,
+	)
+
+	c.s.setIdentity(deviceIdentity{
+		DeviceID: discover.DeviceID,
+		Model:    model,
+		HWModel:  discover.ModelNumber,
+		Firmware: firmware,
+	})
+}
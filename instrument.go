@@ -0,0 +1,51 @@
+package hdhomerunexporter
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// InstrumentHandler wraps next with metrics describing the HTTP requests it
+// serves, so that the exporter itself can be monitored. The metrics are
+// registered with reg and exported under the hdhomerun_exporter_http prefix.
+func InstrumentHandler(reg prometheus.Registerer, next http.Handler) http.Handler {
+	const (
+		namespace = "hdhomerun_exporter"
+		subsystem = "http"
+	)
+
+	var (
+		inFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "requests_in_flight",
+			Help:      "Number of HTTP requests currently being served.",
+		})
+
+		duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "request_duration_seconds",
+			Help:      "Amount of time spent serving HTTP requests.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"code"})
+
+		size = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "response_size_bytes",
+			Help:      "Size of HTTP responses.",
+			Buckets:   prometheus.ExponentialBuckets(256, 4, 8),
+		}, []string{"code"})
+	)
+
+	reg.MustRegister(inFlight, duration, size)
+
+	return promhttp.InstrumentHandlerInFlight(inFlight,
+		promhttp.InstrumentHandlerDuration(duration,
+			promhttp.InstrumentHandlerResponseSize(size, next),
+		),
+	)
+}
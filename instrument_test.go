@@ -0,0 +1,41 @@
+package hdhomerunexporter_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mdlayher/hdhomerun_exporter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestInstrumentHandler(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	h := hdhomerunexporter.InstrumentHandler(reg, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	rec := httptest.NewRecorder()
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	b, err := ioutil.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatalf("failed to read metrics: %v", err)
+	}
+
+	for _, s := range []string{
+		"hdhomerun_exporter_http_requests_in_flight 0",
+		`hdhomerun_exporter_http_request_duration_seconds_count{code="400"} 1`,
+		`hdhomerun_exporter_http_response_size_bytes_count{code="400"} 1`,
+	} {
+		if !strings.Contains(string(b), s) {
+			t.Fatalf("metrics do not contain %q:\n%s", s, string(b))
+		}
+	}
+}
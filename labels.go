@@ -0,0 +1,75 @@
+package hdhomerunexporter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// labelPrefix is the prefix of query parameters which specify constant labels
+// attached to every metric served by a scrape, such as "label_site=garage".
+const labelPrefix = "label_"
+
+// labelNameRE matches valid Prometheus label names.
+var labelNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// scrapeLabels parses the constant labels specified by the "label_" query
+// parameters in q.
+func scrapeLabels(q url.Values) (prometheus.Labels, error) {
+	labels := make(prometheus.Labels)
+	for k, vs := range q {
+		if !strings.HasPrefix(k, labelPrefix) {
+			continue
+		}
+
+		name := strings.TrimPrefix(k, labelPrefix)
+		if !labelNameRE.MatchString(name) || strings.HasPrefix(name, "__") {
+			return nil, fmt.Errorf("invalid label name %q in parameter %q", name, k)
+		}
+		if len(vs) != 1 {
+			return nil, fmt.Errorf("label %q must be specified exactly once", name)
+		}
+
+		labels[name] = vs[0]
+	}
+
+	return labels, nil
+}
+
+// scrapeKey returns the key which identifies identical scrapes with query
+// parameters q, which use the device auth token auth. Only the parameters
+// which affect which metrics are collected from a device are part of the key,
+// so that constant labels and unknown parameters neither split nor leak into
+// the cache.
+//
+// The auth token determines which data the device's HTTP API returns, so
+// scrapes with different tokens must not share results. Only a hash of the
+// token is part of the key.
+func scrapeKey(q url.Values, auth Secret) string {
+	k := make(url.Values, len(q))
+	for _, p := range []string{"target", "module", "timeout"} {
+		if v := q.Get(p); v != "" {
+			k.Set(p, v)
+		}
+	}
+
+	if auth != "" {
+		sum := sha256.Sum256([]byte(auth))
+		k.Set("auth", hex.EncodeToString(sum[:]))
+	}
+
+	// The order in which collectors are enabled does not matter.
+	if names := q["collect[]"]; len(names) > 0 {
+		names = append([]string(nil), names...)
+		sort.Strings(names)
+		k["collect[]"] = names
+	}
+
+	return k.Encode()
+}
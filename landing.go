@@ -0,0 +1,100 @@
+package hdhomerunexporter
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"runtime"
+	"runtime/debug"
+)
+
+// A Link is a link to an HTTP endpoint served by the exporter, displayed on
+// the landing page served by LandingPage.
+type Link struct {
+	Path        string
+	Description string
+}
+
+// LandingPage returns an http.Handler which serves an HTML landing page for
+// the exporter at "/", listing each of links, a scrape URL at metricsPath for
+// every target known to the Handler, and the exporter's build information.
+// If version is empty, the exporter's module version is displayed. Requests
+// for any other path are rejected with HTTP 404.
+func (h *Handler) LandingPage(metricsPath, version string, links []Link) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		lp := landingPage{
+			Links:     links,
+			Version:   version,
+			GoVersion: runtime.Version(),
+		}
+
+		if lp.Version == "" {
+			lp.Version = "unknown"
+			if bi, ok := debug.ReadBuildInfo(); ok {
+				lp.Version = bi.Main.Version
+			}
+		}
+
+		for _, ts := range h.targetStatuses() {
+			lp.Targets = append(lp.Targets, landingTarget{
+				Target: ts.Target,
+				URL:    metricsPath + "?" + url.Values{"target": {ts.Target}}.Encode(),
+			})
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = landingTemplate.Execute(w, lp)
+	})
+}
+
+// A landingPage is the data used to render the landing page.
+type landingPage struct {
+	Links     []Link
+	Targets   []landingTarget
+	Version   string
+	GoVersion string
+}
+
+// A landingTarget is a known target and the URL used to scrape it.
+type landingTarget struct {
+	Target string
+	URL    string
+}
+
+// landingTemplate renders a landingPage as HTML.
+var landingTemplate = template.Must(template.New("landing").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>HDHomeRun exporter</title>
+<style>
+body { font-family: sans-serif; }
+</style>
+</head>
+<body>
+<h1>HDHomeRun exporter</h1>
+<ul>
+{{- range .Links }}
+<li><a href="{{ .Path }}">{{ .Path }}</a>{{ with .Description }}: {{ . }}{{ end }}</li>
+{{- end }}
+</ul>
+<h2>Targets</h2>
+{{- if .Targets }}
+<ul>
+{{- range .Targets }}
+<li><a href="{{ .URL }}">{{ .Target }}</a></li>
+{{- end }}
+</ul>
+{{- else }}
+<p>No targets are known yet.</p>
+{{- end }}
+<h2>Build information</h2>
+<p>Version: {{ .Version }}, built with {{ .GoVersion }}</p>
+</body>
+</html>
+`))
@@ -0,0 +1,53 @@
+package hdhomerunexporter
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHandlerLandingPage(t *testing.T) {
+	h := NewHandler(nil, WithTargets(map[string]TargetConfig{
+		"192.168.1.10": {},
+	}))
+
+	s := httptest.NewServer(h.LandingPage("/metrics", "v1.0.0", []Link{
+		{Path: "/metrics", Description: "Device metrics"},
+	}))
+	defer s.Close()
+
+	res, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatalf("failed to perform HTTP request: %v", err)
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("failed to read response body: %v", err)
+	}
+
+	for _, s := range []string{
+		`<a href="/metrics">/metrics</a>: Device metrics`,
+		`<a href="/metrics?target=192.168.1.10">192.168.1.10</a>`,
+		"Version: v1.0.0, ",
+	} {
+		if !strings.Contains(string(b), s) {
+			t.Fatalf("landing page does not contain %q:\n%s", s, string(b))
+		}
+	}
+
+	res, err = http.Get(s.URL + "/foo")
+	if err != nil {
+		t.Fatalf("failed to perform HTTP request: %v", err)
+	}
+	_ = res.Body.Close()
+
+	if diff := cmp.Diff(http.StatusNotFound, res.StatusCode); diff != "" {
+		t.Fatalf("unexpected HTTP status code (-want +got):\n%s", diff)
+	}
+}
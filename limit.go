@@ -0,0 +1,63 @@
+package hdhomerunexporter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// WithMaxConcurrentScrapes limits the number of devices which may be scraped
+// at once. Scrapes beyond the limit wait for an earlier scrape to complete,
+// or fail with HTTP 503 if the request is canceled first. Regardless of this
+// limit, only one scrape of each device runs at a time. By default, the number
+// of concurrent scrapes is unlimited.
+func WithMaxConcurrentScrapes(n int) HandlerOption {
+	return func(h *Handler) {
+		if n > 0 {
+			h.scrapes = make(chan struct{}, n)
+		}
+	}
+}
+
+// acquire waits until the handler's concurrency limits permit a scrape of
+// target, or until ctx is canceled. The returned function must be called to
+// release the scrape's place when the scrape is complete.
+func (h *Handler) acquire(ctx context.Context, target string) (func(), error) {
+	return h.acquireState(ctx, target, h.state(target))
+}
+
+// acquireState is like acquire, but uses the deviceState s of target.
+func (h *Handler) acquireState(ctx context.Context, target string, s *deviceState) (func(), error) {
+	// Wait for the device before taking a place from the global limit, so
+	// that waiting on a busy device does not hold up other devices.
+	select {
+	case s.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, busyError(target, ctx.Err())
+	}
+
+	if h.scrapes != nil {
+		select {
+		case h.scrapes <- struct{}{}:
+		case <-ctx.Done():
+			<-s.sem
+			return nil, busyError(target, ctx.Err())
+		}
+	}
+
+	return func() {
+		if h.scrapes != nil {
+			<-h.scrapes
+		}
+		<-s.sem
+	}, nil
+}
+
+// busyError returns an error which indicates that a scrape of target could
+// not begin before err occurred.
+func busyError(target string, err error) error {
+	return &statusError{
+		code: http.StatusServiceUnavailable,
+		err:  fmt.Errorf("timed out waiting to scrape HDHomeRun device %q: %v", target, err),
+	}
+}
@@ -0,0 +1,85 @@
+package hdhomerunexporter
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHandlerAcquire(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []HandlerOption
+		targets []string
+		ok      bool
+	}{
+		{
+			name:    "different devices",
+			targets: []string{"foo", "bar"},
+			ok:      true,
+		},
+		{
+			name:    "same device",
+			targets: []string{"foo", "foo"},
+		},
+		{
+			name:    "global limit",
+			options: []HandlerOption{WithMaxConcurrentScrapes(1)},
+			targets: []string{"foo", "bar"},
+		},
+		{
+			name:    "within global limit",
+			options: []HandlerOption{WithMaxConcurrentScrapes(2)},
+			targets: []string{"foo", "bar"},
+			ok:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(nil, tt.options...)
+
+			release, err := h.acquire(context.Background(), tt.targets[0])
+			if err != nil {
+				t.Fatalf("failed to acquire first scrape: %v", err)
+			}
+
+			// The second scrape must not wait if it cannot begin immediately.
+			ctx, cancel := context.WithCancel(context.Background())
+			if !tt.ok {
+				cancel()
+			}
+			defer cancel()
+
+			release2, err := h.acquire(ctx, tt.targets[1])
+			if tt.ok {
+				if err != nil {
+					t.Fatalf("failed to acquire second scrape: %v", err)
+				}
+
+				release2()
+				release()
+				return
+			}
+
+			serr, ok := err.(*statusError)
+			if !ok {
+				t.Fatalf("expected status error, but got: %#v", err)
+			}
+
+			if diff := cmp.Diff(http.StatusServiceUnavailable, serr.code); diff != "" {
+				t.Fatalf("unexpected HTTP status code (-want +got):\n%s", diff)
+			}
+
+			// Once released, the second scrape may begin.
+			release()
+			release2, err = h.acquire(context.Background(), tt.targets[1])
+			if err != nil {
+				t.Fatalf("failed to acquire second scrape after release: %v", err)
+			}
+			release2()
+		})
+	}
+}
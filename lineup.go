@@ -0,0 +1,100 @@
+package hdhomerunexporter
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// A lineupJSON is a channel served by an HDHomeRun device's lineup.json
+// endpoint.
+type lineupJSON struct {
+	GuideNumber string
+	DRM         int `json:",omitempty"`
+}
+
+// collectLineup collects channel lineup metrics from the device's HTTP API.
+func (c *collector) collectLineup(ch chan<- prometheus.Metric) error {
+	var lineup []lineupJSON
+	switch err := c.a.Get("/lineup.json", &lineup); err {
+	case nil:
+	case errNotFound:
+		// Devices without tuners, such as storage devices, have no lineup.
+		return nil
+	default:
+		return err
+	}
+
+	var drm int
+	for _, l := range lineup {
+		if l.DRM != 0 {
+			drm++
+		}
+	}
+
+	ds := []descValue{
+		{
+			desc:  c.LineupChannels,
+			value: float64(len(lineup)),
+		},
+		{
+			desc:  c.LineupDRMChannels,
+			value: float64(drm),
+		},
+	}
+
+	for _, d := range ds {
+		ch <- prometheus.MustNewConstMetric(
+			d.desc,
+			prometheus.GaugeValue,
+			d.value,
+		)
+	}
+
+	return nil
+}
+
+// A lineupStatusJSON is the channel scan status served by an HDHomeRun
+// device's lineup_status.json endpoint.
+type lineupStatusJSON struct {
+	ScanInProgress int
+	Progress       int `json:",omitempty"`
+	Found          int `json:",omitempty"`
+}
+
+// collectLineupStatus collects channel scan metrics from the device's HTTP API.
+func (c *collector) collectLineupStatus(ch chan<- prometheus.Metric) error {
+	var status lineupStatusJSON
+	switch err := c.a.Get("/lineup_status.json", &status); err {
+	case nil:
+	case errNotFound:
+		return nil
+	default:
+		return err
+	}
+
+	ds := []descValue{{
+		desc:  c.LineupScanInProgress,
+		value: boolValue(status.ScanInProgress != 0),
+	}}
+
+	// Progress is only reported while a scan is in progress.
+	if status.ScanInProgress != 0 {
+		ds = append(ds, []descValue{
+			{
+				desc:  c.LineupScanProgressRatio,
+				value: ratio(status.Progress),
+			},
+			{
+				desc:  c.LineupScanFoundChannels,
+				value: float64(status.Found),
+			},
+		}...)
+	}
+
+	for _, d := range ds {
+		ch <- prometheus.MustNewConstMetric(
+			d.desc,
+			prometheus.GaugeValue,
+			d.value,
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,178 @@
+package hdhomerunexporter
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// LogRequests wraps next to log each HTTP request it serves to logger at the
+// info level, including the request's target and module parameters, its
+// duration, its HTTP status code, and the client's address. A scrape of a
+// device which fails is served with HTTP 200 unless the handler is configured
+// to fail on errors, so the class of each error reported by a Handler is also
+// logged. If errorsOnly is set, only requests which fail with an HTTP error
+// status or report a failed scrape are logged.
+func LogRequests(logger *slog.Logger, errorsOnly bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+		o := &scrapeOutcome{}
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), scrapeOutcomeKey{}, o)))
+
+		errs := o.errors()
+		if errorsOnly && sw.code < http.StatusBadRequest && len(errs) == 0 {
+			return
+		}
+
+		q := r.URL.Query()
+		args := []any{
+			"target", q.Get("target"),
+			"module", q.Get("module"),
+			"code", sw.code,
+		}
+		if len(errs) > 0 {
+			args = append(args, "scrape_errors", strings.Join(errs, ","))
+		}
+		args = append(args,
+			"duration", time.Since(start).Round(time.Millisecond),
+			"remote", r.RemoteAddr,
+		)
+
+		logger.Info("request", args...)
+	})
+}
+
+// A statusWriter is an http.ResponseWriter which records the HTTP status code
+// of its response.
+type statusWriter struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.code = code
+		w.wroteHeader = true
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// A scrapeOutcome records the failed scrapes reported in the response to a
+// request logged by LogRequests.
+type scrapeOutcome struct {
+	mu   sync.Mutex
+	errs []string
+}
+
+// scrapeOutcomeKey is the context key for a request's scrapeOutcome.
+type scrapeOutcomeKey struct{}
+
+// errors returns the failed scrapes recorded in o.
+func (o *scrapeOutcome) errors() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.errs
+}
+
+// An outcomeGatherer is a prometheus.Gatherer which records the failed
+// scrapes among the metrics it gathers in the scrapeOutcome of the request
+// being served, if the request is logged.
+type outcomeGatherer struct {
+	prometheus.Gatherer
+	ctx context.Context
+}
+
+// newOutcomeGatherer wraps g to record failed scrapes for the request with
+// context ctx.
+func newOutcomeGatherer(ctx context.Context, g prometheus.Gatherer) prometheus.Gatherer {
+	if _, ok := ctx.Value(scrapeOutcomeKey{}).(*scrapeOutcome); !ok {
+		return g
+	}
+
+	return &outcomeGatherer{Gatherer: g, ctx: ctx}
+}
+
+// Gather implements prometheus.Gatherer.
+func (g *outcomeGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := g.Gatherer.Gather()
+
+	// The error class of each failed device is found by the device label,
+	// which is only set when a response includes multiple devices.
+	var (
+		failed  []string
+		classes = make(map[string]string)
+	)
+
+	for _, mf := range mfs {
+		switch mf.GetName() {
+		case "hdhomerun_up":
+			for _, m := range mf.GetMetric() {
+				if m.GetGauge().GetValue() == 0 {
+					failed = append(failed, labelValue(m, "device"))
+				}
+			}
+		case "hdhomerun_scrape_error":
+			for _, m := range mf.GetMetric() {
+				if m.GetGauge().GetValue() == 1 {
+					classes[labelValue(m, "device")] = labelValue(m, "class")
+				}
+			}
+		}
+	}
+
+	if len(failed) == 0 {
+		return mfs, err
+	}
+
+	o := g.ctx.Value(scrapeOutcomeKey{}).(*scrapeOutcome)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, device := range failed {
+		class := classes[device]
+		if class == "" {
+			class = errorClassUnknown
+		}
+
+		if device != "" {
+			class = device + ":" + class
+		}
+
+		o.errs = append(o.errs, class)
+	}
+
+	return mfs, err
+}
+
+// labelValue returns the value of the label with name on m, if any.
+func labelValue(m *dto.Metric, name string) string {
+	for _, lp := range m.GetLabel() {
+		if lp.GetName() == name {
+			return lp.GetValue()
+		}
+	}
+
+	return ""
+}
+
+// nopLogger is the logger used when none is configured.
+var nopLogger = slog.New(discardHandler{})
+
+// A discardHandler is a slog.Handler which discards all records.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
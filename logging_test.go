@@ -0,0 +1,119 @@
+package hdhomerunexporter_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/hdhomerun"
+	"github.com/mdlayher/hdhomerun_exporter"
+)
+
+func TestLogRequests(t *testing.T) {
+	tests := []struct {
+		name       string
+		errorsOnly bool
+		code       int
+		want       string
+	}{
+		{
+			name: "OK",
+			code: http.StatusOK,
+			want: `level=INFO msg=request target=192.168.1.10 module=foo code=200`,
+		},
+		{
+			name:       "OK errors only",
+			errorsOnly: true,
+			code:       http.StatusOK,
+		},
+		{
+			name:       "error errors only",
+			errorsOnly: true,
+			code:       http.StatusBadGateway,
+			want:       `level=INFO msg=request target=192.168.1.10 module=foo code=502`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := testLogger(&buf)
+
+			h := hdhomerunexporter.LogRequests(logger, tt.errorsOnly, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tt.code)
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/metrics?target=192.168.1.10&module=foo", nil)
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			// Trim the variable duration and remote address.
+			got := buf.String()
+			if i := strings.Index(got, " duration="); i != -1 {
+				got = got[:i]
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("unexpected log output (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLogRequestsFailedScrape(t *testing.T) {
+	dial := func(_ string) (*hdhomerun.Client, error) {
+		return nil, errors.New("always fails")
+	}
+
+	var buf bytes.Buffer
+	h := hdhomerunexporter.LogRequests(testLogger(&buf), true, hdhomerunexporter.NewHandler(dial))
+
+	for _, target := range []string{"192.168.1.10", "192.168.1.10,192.168.1.11"} {
+		r := httptest.NewRequest(http.MethodGet, "/metrics?target="+target, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		// The failed scrape is reported using metrics, but must still be
+		// logged.
+		if diff := cmp.Diff(http.StatusOK, w.Code); diff != "" {
+			t.Fatalf("unexpected HTTP status code (-want +got):\n%s", diff)
+		}
+	}
+
+	want := []string{
+		`level=INFO msg=request target=192.168.1.10 module="" code=200 scrape_errors=dial`,
+		`level=INFO msg=request target=192.168.1.10,192.168.1.11 module="" code=200 scrape_errors=192.168.1.10:dial,192.168.1.11:dial`,
+	}
+
+	var got []string
+	for _, l := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if i := strings.Index(l, " duration="); i != -1 {
+			l = l[:i]
+		}
+		got = append(got, l)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected log output (-want +got):\n%s", diff)
+	}
+}
+
+// testLogger creates a logger which writes all messages to w in logfmt,
+// omitting their variable timestamps.
+func testLogger(w io.Writer) *slog.Logger {
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+
+			return a
+		},
+	}))
+}
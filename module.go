@@ -0,0 +1,114 @@
+package hdhomerunexporter
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+)
+
+// A Module is a named scrape configuration, selected using the "module" query
+// parameter, so that devices with differing capabilities can be scraped by a
+// single exporter.
+type Module struct {
+	// Protocol, if set, selects the protocol used to scrape devices. By
+	// default, ProtocolBoth is used.
+	Protocol Protocol
+
+	// Timeout, if non-zero, overrides the time allowed for each scrape of a
+	// device.
+	Timeout time.Duration
+
+	// Lightweight, if set, collects only basic tuner signal metrics using
+	// each tuner's status, rather than its full debug output. This reduces
+	// scrape latency on devices with many tuners. It is equivalent to setting
+	// TunerKeys to "status" alone.
+	Lightweight bool
+
+	// TunerKeys, if set, are the only per-tuner query keys which are queried
+	// for each tuner, reducing device load. Supported keys are "debug",
+	// "status", "channelmap", "target", "vchannel", "lockkey", "program",
+	// "filter", "vstatus", "plpinfo", and "transcode". If "debug" is omitted,
+	// basic tuner signal metrics are collected using "status" instead. By
+	// default, all supported keys are queried.
+	TunerKeys []string
+
+	// Collectors, if set, are the names of the only groups of metrics which
+	// are collected, as returned by Collectors. The "collect[]" query
+	// parameter takes precedence when it is set. By default, all collectors
+	// are enabled.
+	Collectors []string
+
+	// HTTP configures the HTTP client used to access the HTTP APIs of
+	// devices.
+	HTTP HTTPClientConfig
+}
+
+// An HTTPClientConfig configures the HTTP client used to access the HTTP APIs
+// of devices. The zero value uses http.DefaultClient.
+type HTTPClientConfig struct {
+	// Timeout, if non-zero, limits the time taken by each HTTP request.
+	Timeout time.Duration
+
+	// InsecureSkipVerify disables verification of device TLS certificates,
+	// for devices which serve their HTTP API over HTTPS.
+	InsecureSkipVerify bool
+
+	// DisableKeepAlives disables reuse of HTTP connections between requests.
+	DisableKeepAlives bool
+
+	// IdleConnTimeout, if non-zero, limits the time an idle HTTP connection
+	// is kept open for reuse.
+	IdleConnTimeout time.Duration
+}
+
+// client creates an *http.Client using the configuration.
+func (cfg HTTPClientConfig) client() *http.Client {
+	if cfg == (HTTPClientConfig{}) {
+		return http.DefaultClient
+	}
+
+	return &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: cfg.InsecureSkipVerify,
+			},
+			DisableKeepAlives: cfg.DisableKeepAlives,
+			IdleConnTimeout:   cfg.IdleConnTimeout,
+		},
+	}
+}
+
+// DefaultModule is the name of the Module used when a scrape does not specify
+// a "module" query parameter, if it is configured.
+const DefaultModule = "default"
+
+// A Protocol is a protocol which can be used to scrape a device.
+type Protocol string
+
+// Possible Protocol values.
+const (
+	// ProtocolBoth scrapes a device using its TCP control protocol, along
+	// with its HTTP API where available.
+	ProtocolBoth Protocol = "both"
+
+	// ProtocolControl scrapes a device using only its TCP control protocol,
+	// for older devices which do not provide an HTTP API.
+	ProtocolControl Protocol = "control"
+
+	// ProtocolHTTP scrapes a device using only its HTTP API, for devices or
+	// networks which only expose port 80. Fewer metrics are available.
+	ProtocolHTTP Protocol = "http"
+)
+
+// WithModules adds or replaces the named Modules which may be selected
+// using the "module" query parameter.
+func WithModules(modules map[string]Module) HandlerOption {
+	return func(h *Handler) {
+		for k, v := range modules {
+			h.modules[k] = v
+			h.clients[k] = v.HTTP.client()
+		}
+	}
+}
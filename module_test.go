@@ -0,0 +1,170 @@
+package hdhomerunexporter
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHTTPClientConfigClient(t *testing.T) {
+	if c := (HTTPClientConfig{}).client(); c != http.DefaultClient {
+		t.Fatal("zero value configuration did not use the default client")
+	}
+
+	c := HTTPClientConfig{
+		Timeout:            2 * time.Second,
+		InsecureSkipVerify: true,
+		DisableKeepAlives:  true,
+	}.client()
+
+	if c.Timeout != 2*time.Second {
+		t.Fatalf("unexpected client timeout: %v", c.Timeout)
+	}
+
+	tr := c.Transport.(*http.Transport)
+	if !tr.TLSClientConfig.InsecureSkipVerify || !tr.DisableKeepAlives {
+		t.Fatalf("unexpected client transport configuration: %+v", tr)
+	}
+}
+
+func TestHandlerCloseIdleConnections(t *testing.T) {
+	closed := make(chan struct{})
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	s.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			close(closed)
+		}
+	}
+	s.Start()
+	defer s.Close()
+
+	h := NewHandler(nil, WithModules(map[string]Module{
+		"http": {HTTP: HTTPClientConfig{Timeout: 2 * time.Second}},
+	}))
+
+	_, c, err := h.module("http")
+	if err != nil {
+		t.Fatalf("failed to get module: %v", err)
+	}
+
+	res, err := c.Get(s.URL)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	_, _ = ioutil.ReadAll(res.Body)
+	_ = res.Body.Close()
+
+	if err := h.Close(); err != nil {
+		t.Fatalf("failed to close handler: %v", err)
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle connection was not closed")
+	}
+}
+
+func TestHandlerReloadClients(t *testing.T) {
+	closed := make(chan struct{})
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	s.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			close(closed)
+		}
+	}
+	s.Start()
+	defer s.Close()
+
+	mods := map[string]Module{
+		"http": {HTTP: HTTPClientConfig{Timeout: 2 * time.Second}},
+	}
+
+	h := NewHandler(nil, WithModules(mods))
+
+	_, c, err := h.module("http")
+	if err != nil {
+		t.Fatalf("failed to get module: %v", err)
+	}
+
+	// An unchanged module keeps its client.
+	h.Reload(nil, mods, nil)
+
+	if _, got, _ := h.module("http"); got != c {
+		t.Fatal("client of unchanged module was replaced")
+	}
+
+	res, err := c.Get(s.URL)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	_, _ = ioutil.ReadAll(res.Body)
+	_ = res.Body.Close()
+
+	// A changed module's client is replaced, and its idle connections closed.
+	h.Reload(nil, map[string]Module{
+		"http": {HTTP: HTTPClientConfig{Timeout: 5 * time.Second}},
+	}, nil)
+
+	if _, got, _ := h.module("http"); got == c {
+		t.Fatal("client of changed module was not replaced")
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle connection was not closed")
+	}
+}
+
+func TestHandlerModuleCollectors(t *testing.T) {
+	h := NewHandler(nil, WithModules(map[string]Module{
+		"storage": {
+			Protocol:   ProtocolHTTP,
+			Collectors: []string{collectorStorage},
+		},
+	}))
+
+	tests := []struct {
+		name  string
+		query string
+		cs    collectorSet
+	}{
+		{
+			name:  "default",
+			query: "target=http://192.168.1.10",
+		},
+		{
+			name:  "module",
+			query: "target=http://192.168.1.10&module=storage",
+			cs:    collectorSet{collectorStorage: true},
+		},
+		{
+			name:  "collect parameter",
+			query: "target=http://192.168.1.10&module=storage&collect[]=lineup",
+			cs:    collectorSet{collectorLineup: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{URL: &url.URL{RawQuery: tt.query}}
+
+			c, done, err := h.collector(r)
+			if err != nil {
+				t.Fatalf("failed to create collector: %v", err)
+			}
+			defer done()
+
+			if diff := cmp.Diff(tt.cs, c.cfg.Collectors); diff != "" {
+				t.Fatalf("unexpected collectors (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
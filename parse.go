@@ -0,0 +1,42 @@
+package hdhomerunexporter
+
+import "strings"
+
+// parseKV parses a device query value consisting of whitespace-separated
+// key=value pairs, such as "card=ready auth=success". Fields which are not
+// key=value pairs are ignored.
+func parseKV(s string) map[string]string {
+	kvs := make(map[string]string)
+	for _, f := range strings.Fields(s) {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		kvs[kv[0]] = kv[1]
+	}
+
+	return kvs
+}
+
+// parseFeatures parses the value of /sys/features, which consists of lines
+// of the form "feature: value value ...", such as "modulation: 8vsb qam256".
+// Lines which do not contain a feature name are ignored.
+func parseFeatures(s string) map[string][]string {
+	features := make(map[string][]string)
+	for _, l := range strings.Split(s, "\n") {
+		kv := strings.SplitN(l, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		k := strings.TrimSpace(kv[0])
+		if k == "" {
+			continue
+		}
+
+		features[k] = strings.Fields(kv[1])
+	}
+
+	return features
+}
@@ -0,0 +1,143 @@
+package hdhomerunexporter
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// WithPolling configures the handler to scrape each of targets in the
+// background every interval, once Poll is called. Scrapes of a polled target
+// which specify no parameters other than the target are served from the most
+// recent poll, so that scrapes do not wait on slow devices. If targets
+// contains AutoTarget, every device found using discovery is polled.
+func WithPolling(targets []string, interval time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.pollTargets = targets
+		h.pollInterval = interval
+	}
+}
+
+// Poll scrapes the targets configured using WithPolling until ctx is
+// canceled. If polling is not configured, Poll returns immediately.
+func (h *Handler) Poll(ctx context.Context) {
+	if len(h.pollTargets) == 0 || h.pollInterval <= 0 {
+		return
+	}
+
+	t := time.NewTicker(h.pollInterval)
+	defer t.Stop()
+
+	var targets []string
+	for {
+		targets = h.pollRound(ctx, targets)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// pollRound scrapes every polled target concurrently and returns the targets
+// which were polled. If discovery fails, the previously polled targets are
+// polled again.
+func (h *Handler) pollRound(ctx context.Context, previous []string) []string {
+	var targets []string
+	for _, t := range h.pollTargets {
+		if t != AutoTarget {
+			targets = append(targets, t)
+			continue
+		}
+
+		ids, err := h.discoverTargets(ctx)
+		if err != nil {
+			ids = previous
+		}
+
+		targets = append(targets, ids...)
+	}
+	targets = parseTargets(targets)
+
+	// Each poll must complete before the next begins.
+	ctx, cancel := context.WithTimeout(ctx, h.pollInterval)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		wg.Add(1)
+		go func(t string) {
+			defer wg.Done()
+			h.poll(ctx, t)
+		}(t)
+	}
+	wg.Wait()
+
+	return targets
+}
+
+// poll scrapes target and caches its metrics under pollKey.
+func (h *Handler) poll(ctx context.Context, target string) {
+	start := time.Now()
+
+	name, _, _ := splitScheme(target)
+	release, err := h.acquire(ctx, name)
+	if err != nil {
+		h.logger.Debug("failed to poll target", "target", target, "err", err)
+		return
+	}
+	defer release()
+
+	key := h.pollKey(target)
+	r := (&http.Request{
+		URL:    &url.URL{RawQuery: url.Values{"target": {target}}.Encode()},
+		Header: make(http.Header),
+	}).WithContext(ctx)
+
+	c, done, err := h.deviceCollector(r, start)
+	if err != nil {
+		h.logger.Debug("failed to poll target", "target", target, "err", err)
+		return
+	}
+	defer done()
+
+	metrics := collectMetrics(c)
+
+	h.state(name).setCached(key, time.Now(), metrics, scrapeErr(c))
+}
+
+// pollKey returns the cache key under which the metrics polled from target
+// are stored, which matches the key of a scrape with no other parameters.
+func (h *Handler) pollKey(target string) string {
+	name, _, _ := splitScheme(target)
+
+	h.mu.Lock()
+	tc := h.targets[name]
+	h.mu.Unlock()
+
+	return scrapeKey(url.Values{"target": {target}}, tc.Auth)
+}
+
+// cacheTTLFor returns the amount of time for which metrics cached under key
+// are served for target. Polled metrics expire if polling stalls, so that
+// scrapes fall back to scraping the device.
+func (h *Handler) cacheTTLFor(target, key string) time.Duration {
+	ttl := h.cacheTTL
+	if key != h.pollKey(target) || h.pollInterval <= 0 {
+		return ttl
+	}
+
+	for _, t := range h.pollTargets {
+		if t == target || (t == AutoTarget && isDeviceID(target)) {
+			if d := 2 * h.pollInterval; d > ttl {
+				ttl = d
+			}
+			break
+		}
+	}
+
+	return ttl
+}
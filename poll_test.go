@@ -0,0 +1,70 @@
+package hdhomerunexporter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/hdhomerun"
+)
+
+func TestHandlerPoll(t *testing.T) {
+	var dials int
+	dial := func(_ string) (*hdhomerun.Client, error) {
+		dials++
+		return nil, errors.New("always fails")
+	}
+
+	h := NewHandler(dial, WithPolling([]string{"foo"}, time.Minute))
+
+	targets := h.pollRound(context.Background(), nil)
+	if diff := cmp.Diff([]string{"foo"}, targets); diff != "" {
+		t.Fatalf("unexpected polled targets (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(1, dials); diff != "" {
+		t.Fatalf("unexpected number of dials after poll (-want +got):\n%s", diff)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		dials int
+	}{
+		{
+			name:  "polled",
+			query: "target=foo",
+			dials: 1,
+		},
+		{
+			name:  "other parameters",
+			query: "target=foo&timeout=2s",
+			dials: 2,
+		},
+		{
+			name:  "not polled",
+			query: "target=bar",
+			dials: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{URL: &url.URL{RawQuery: tt.query}}
+
+			_, done, err := h.scrapeCollector(r, time.Now())
+			if err != nil {
+				t.Fatalf("failed to create collector: %v", err)
+			}
+			done()
+
+			if diff := cmp.Diff(tt.dials, dials); diff != "" {
+				t.Fatalf("unexpected number of dials (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package hdhomerunexporter
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/mdlayher/hdhomerun"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// parseTunerStatus parses the value of /tunerN/status, which consists of
+// key=value pairs such as "ch=qam:381000000 lock=qam256:381000000 ss=100
+// snq=100 seq=100 bps=38809216 pps=3200". Missing or malformed signal values
+// are reported as zero.
+func parseTunerStatus(s string) *hdhomerun.TunerStatus {
+	kvs := parseKV(s)
+
+	atoi := func(key string) int {
+		v, _ := strconv.Atoi(kvs[key])
+		return v
+	}
+
+	return &hdhomerun.TunerStatus{
+		Channel:              kvs["ch"],
+		Lock:                 kvs["lock"],
+		SignalStrength:       atoi("ss"),
+		SignalToNoiseQuality: atoi("snq"),
+		SymbolErrorQuality:   atoi("seq"),
+	}
+}
+
+// tunerKeyNames is the set of all supported per-tuner query keys.
+var tunerKeyNames = map[string]bool{
+	"debug":      true,
+	"status":     true,
+	"channelmap": true,
+	"target":     true,
+	"vchannel":   true,
+	"lockkey":    true,
+	"program":    true,
+	"filter":     true,
+	"vstatus":    true,
+	"plpinfo":    true,
+	"transcode":  true,
+}
+
+// TunerKeys returns the per-tuner query keys which may be set in a Module's
+// TunerKeys, sorted by name.
+func TunerKeys() []string {
+	keys := make([]string, 0, len(tunerKeyNames))
+	for k := range tunerKeyNames {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// A queryPlan is the set of per-tuner query keys, such as "debug" or
+// "vstatus", which are queried for each tuner during collection. A nil
+// queryPlan queries all supported keys.
+type queryPlan map[string]bool
+
+// newQueryPlan creates a queryPlan for keys. If keys is empty, all supported
+// keys are queried.
+func newQueryPlan(keys []string) queryPlan {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	p := make(queryPlan, len(keys))
+	for _, k := range keys {
+		p[k] = true
+	}
+
+	return p
+}
+
+// has determines if key should be queried for each tuner.
+func (p queryPlan) has(key string) bool {
+	return p == nil || p[key]
+}
+
+// collectTunerQueries collects metrics for the tuner with index i from each
+// of the per-tuner query keys in the collector's queryPlan, other than the
+// debug, status, and channelmap keys which are handled by the caller.
+func (c *collector) collectTunerQueries(ch chan<- prometheus.Metric, tuner string, i int) error {
+	if err := c.collectTunerKeys(ch, tuner, i); err != nil {
+		return err
+	}
+	if err := c.collectTunerProgram(ch, tuner, i); err != nil {
+		return err
+	}
+	if c.plan.has("vstatus") {
+		if err := c.collectTunerCopyProtection(ch, tuner, i); err != nil {
+			return err
+		}
+	}
+	if c.caps.ATSC3 && c.plan.has("plpinfo") {
+		if err := c.collectPLPs(ch, tuner, i); err != nil {
+			return err
+		}
+	}
+	if c.caps.Transcode && c.plan.has("transcode") {
+		if err := c.collectTranscode(ch, tuner, i); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// collectTunerDebug collects metrics for the tuner with index i, using its
+// status ts from the tuner's debug output and the keys in the collector's
+// queryPlan.
+func (c *collector) collectTunerDebug(ch chan<- prometheus.Metric, tuner string, i int, ts *hdhomerun.TunerStatus) error {
+	if err := c.collectTunerQueries(ch, tuner, i); err != nil {
+		return err
+	}
+
+	channelmap, err := c.channelMap(i)
+	if err != nil {
+		return err
+	}
+
+	c.collectTuner(ch, tuner, channelmap, ts)
+	return nil
+}
+
+// channelMap returns the channel map in use by the tuner with index i, if it
+// is included in the collector's queryPlan.
+func (c *collector) channelMap(i int) (string, error) {
+	if !c.plan.has("channelmap") {
+		return "", nil
+	}
+
+	return c.tunerChannelMap(i)
+}
+
+// collectWithoutDebug collects metrics for each of the device's tuners using
+// /tunerN/status and the other keys in the collector's queryPlan, rather than
+// the full debug output used by collect. As with collect, a tuner which fails
+// is reported using its error counter, and an error is returned only if no
+// tuner could be collected. If an error occurs, it returns the description of
+// the metric which could not be collected along with the error.
+func (c *collector) collectWithoutDebug(ch chan<- prometheus.Metric) (*prometheus.Desc, error) {
+	skip := make(map[int]bool, len(c.cfg.Target.SkipTuners))
+	for _, i := range c.cfg.Target.SkipTuners {
+		skip[i] = true
+	}
+
+	var (
+		n, inUse int
+		sig      signalAggregate
+
+		collected int
+		tunerErr  error
+	)
+
+	fail := func(tuner string, err error) {
+		c.logger().Debug("failed to collect tuner", "target", c.cfg.TargetName, "tuner", tuner, "err", err)
+
+		if tunerErr == nil {
+			tunerErr = err
+		}
+	}
+
+	for i := 0; c.cfg.Target.Tuners == 0 || i < c.cfg.Target.Tuners; i++ {
+		tuner := strconv.Itoa(i)
+
+		// Unless the tuner count is pinned, tuners are probed until the
+		// device reports that no more exist.
+		v, err := c.query(tunerKey(i, "status"))
+		if notExist(err) && c.cfg.Target.Tuners == 0 {
+			break
+		}
+
+		n++
+		if skip[i] {
+			continue
+		}
+
+		if err != nil {
+			c.collectTunerErrors(ch, tuner, true)
+			fail(tuner, err)
+
+			// Without a pinned tuner count, no further tuners are known.
+			if c.cfg.Target.Tuners == 0 {
+				break
+			}
+
+			continue
+		}
+
+		ts := parseTunerStatus(v)
+		if tuned(ts) {
+			inUse++
+		}
+
+		if !c.cfg.Collectors.enabled(collectorTuner) {
+			c.collectTunerErrors(ch, tuner, false)
+			collected++
+			continue
+		}
+
+		err = bufferTuner(ch, func(ch chan<- prometheus.Metric) error {
+			channelmap, err := c.channelMap(i)
+			if err != nil {
+				return err
+			}
+
+			c.collectTuner(ch, tuner, channelmap, ts)
+			return c.collectTunerQueries(ch, tuner, i)
+		})
+		c.collectTunerErrors(ch, tuner, err != nil)
+		if err != nil {
+			fail(tuner, err)
+			continue
+		}
+
+		collected++
+		sig.add(ts)
+	}
+
+	if tunerErr != nil && collected == 0 {
+		return c.TunerInfo, tunerErr
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		c.DeviceTuners,
+		prometheus.GaugeValue,
+		float64(n),
+	)
+
+	ch <- prometheus.MustNewConstMetric(
+		c.DeviceTunersInUse,
+		prometheus.GaugeValue,
+		float64(inUse),
+	)
+
+	c.collectSignalAggregate(ch, sig)
+
+	return nil, nil
+}
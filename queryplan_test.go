@@ -0,0 +1,66 @@
+package hdhomerunexporter
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/hdhomerun"
+)
+
+func TestParseTunerStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		ts   *hdhomerun.TunerStatus
+	}{
+		{
+			name: "empty",
+			ts:   &hdhomerun.TunerStatus{},
+		},
+		{
+			name: "not tuned",
+			s:    "ch=none lock=none ss=0 snq=0 seq=0 bps=0 pps=0",
+			ts: &hdhomerun.TunerStatus{
+				Channel: "none",
+				Lock:    "none",
+			},
+		},
+		{
+			name: "tuned",
+			s:    "ch=qam:381000000 lock=qam256:381000000 ss=100 snq=90 seq=foo bps=38809216 pps=3200",
+			ts: &hdhomerun.TunerStatus{
+				Channel:              "qam:381000000",
+				Lock:                 "qam256:381000000",
+				SignalStrength:       100,
+				SignalToNoiseQuality: 90,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.ts, parseTunerStatus(tt.s)); diff != "" {
+				t.Fatalf("unexpected tuner status (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestQueryPlan(t *testing.T) {
+	all := newQueryPlan(nil)
+	if !all.has("debug") || !all.has("vstatus") {
+		t.Fatal("empty query plan did not include all keys")
+	}
+
+	p := newQueryPlan([]string{"status", "vstatus"})
+	for k, want := range map[string]bool{
+		"debug":   false,
+		"status":  true,
+		"vstatus": true,
+		"target":  false,
+	} {
+		if diff := cmp.Diff(want, p.has(k)); diff != "" {
+			t.Fatalf("unexpected query plan membership for %q (-want +got):\n%s", k, diff)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package hdhomerunexporter
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/mdlayher/hdhomerun"
+)
+
+// Quirks describe the differences in behavior between HDHomeRun hardware
+// models which affect metrics collection. Quirks are applied automatically
+// based on a device's hardware model, as reported by /sys/hwmodel.
+type Quirks struct {
+	// MissingKeys specifies device query keys, such as "/sys/uptime", which
+	// do not exist on a model and should never be queried.
+	MissingKeys []string
+
+	// NoCableCARD indicates that a model has no CableCARD slot, and that any
+	// CableCARD statistics reported by its tuners should be ignored.
+	NoCableCARD bool
+
+	// TemperatureFahrenheit indicates that a model reports /sys/temperature
+	// in degrees Fahrenheit rather than Celsius.
+	TemperatureFahrenheit bool
+
+	// NoDebugSignalStrength indicates that the first value of a model's
+	// tuner debug field is not its absolute signal strength in tenths of a
+	// dBm, so that no absolute signal strength is exported.
+	NoDebugSignalStrength bool
+}
+
+// errMissingKey is returned when a query is skipped because a device's
+// Quirks indicate that the queried key does not exist.
+var errMissingKey = errors.New("key does not exist on this hardware model")
+
+// notExist determines if err indicates that a device query key does not exist,
+// either because the device reported so or because of the device's Quirks.
+func notExist(err error) bool {
+	return err == errMissingKey || hdhomerun.IsNotExist(err)
+}
+
+// missing determines if key is listed in q.MissingKeys.
+func (q Quirks) missing(key string) bool {
+	for _, k := range q.MissingKeys {
+		if k == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// defaultQuirks returns the built-in table of Quirks, keyed by hardware model.
+func defaultQuirks() map[string]Quirks {
+	// Only the HDHomeRun PRIME (HDHR3-CC) accepts a CableCARD.
+	noCC := Quirks{NoCableCARD: true}
+
+	return map[string]Quirks{
+		"HDHR3-US":  noCC,
+		"HDHR3-EU":  noCC,
+		"HDHR3-DT":  noCC,
+		"HDHR3-4DC": noCC,
+		"HDHR4-2US": noCC,
+		"HDHR4-2DT": noCC,
+		"HDHR5-2US": noCC,
+		"HDHR5-4US": noCC,
+		"HDHR5-2DT": noCC,
+		"HDHR5-4DT": noCC,
+		"HDHR5-4K":  noCC,
+		"HDFX-2US":  noCC,
+		"HDFX-4K":   noCC,
+		"HDTC-2US":  noCC,
+	}
+}
+
+// modelFamilies maps hardware model prefixes to the Quirks shared by every
+// model in a family, so that new models are handled before they are added to
+// the Quirks table. More specific prefixes must be listed first.
+var modelFamilies = []struct {
+	prefix string
+	quirks Quirks
+}{
+	// HDHomeRun PRIME.
+	{prefix: "HDHR3-CC"},
+	// HDHomeRun DUAL, CONNECT, and QUATRO.
+	{prefix: "HDHR", quirks: Quirks{NoCableCARD: true}},
+	// HDHomeRun FLEX.
+	{prefix: "HDFX-", quirks: Quirks{NoCableCARD: true}},
+	// HDHomeRun EXTEND.
+	{prefix: "HDTC-", quirks: Quirks{NoCableCARD: true}},
+	// HDHomeRun SCRIBE and SERVIO.
+	{prefix: "HDVR-", quirks: Quirks{NoCableCARD: true}},
+}
+
+// familyQuirks returns the Quirks shared by the model family of hwmodel, if
+// its family is known.
+func familyQuirks(hwmodel string) Quirks {
+	for _, f := range modelFamilies {
+		if strings.HasPrefix(hwmodel, f.prefix) {
+			return f.quirks
+		}
+	}
+
+	return Quirks{}
+}
@@ -0,0 +1,98 @@
+package hdhomerunexporter
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Reload replaces the per-target configuration, modules, and allowed targets
+// otherwise configured using WithTargets, WithModules, and WithAllowedTargets,
+// such as after the exporter's configuration file changes. Empty entries in
+// allowed are ignored, and if none remain, any target may be scraped. Any
+// cached metrics are discarded, and the HTTP clients of modules whose
+// configuration changed are replaced, while scrapes which are already in
+// progress complete using the previous configuration.
+func (h *Handler) Reload(targets map[string]TargetConfig, modules map[string]Module, allowed []string) {
+	ts := make(map[string]TargetConfig, len(targets))
+	for k, v := range targets {
+		ts[k] = v
+	}
+
+	var as map[string]bool
+	for _, t := range allowed {
+		if t == "" {
+			continue
+		}
+
+		if as == nil {
+			as = make(map[string]bool, len(allowed))
+		}
+		as[t] = true
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// A module's HTTP client is reused if its configuration is unchanged, so
+	// that its idle connections to devices remain available.
+	ms := make(map[string]Module, len(modules))
+	cs := make(map[string]*http.Client, len(modules))
+	inUse := make(map[*http.Client]bool, len(modules))
+	for k, v := range modules {
+		ms[k] = v
+		if old, ok := h.modules[k]; ok && old.HTTP == v.HTTP && h.clients[k] != nil {
+			cs[k] = h.clients[k]
+		} else {
+			cs[k] = v.HTTP.client()
+		}
+		inUse[cs[k]] = true
+	}
+
+	// Otherwise, the idle connections of a replaced client would never be
+	// closed. Requests which are in progress complete normally.
+	for _, c := range h.clients {
+		if !inUse[c] && c != http.DefaultClient {
+			c.CloseIdleConnections()
+		}
+	}
+
+	h.targets = ts
+	h.modules = ms
+	h.clients = cs
+	h.allowed = as
+
+	// Cached metrics were collected using the previous configuration.
+	for _, s := range h.devices {
+		s.resetCache()
+	}
+}
+
+// ReloadHandler returns an http.Handler which invokes reload when it receives
+// an HTTP POST request bearing token in its Authorization header, such as
+// "Authorization: Bearer <token>". Unauthenticated requests are rejected with
+// HTTP 401, and a failed reload is reported with HTTP 500.
+func ReloadHandler(token Secret, reload func() error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "reload requires HTTP POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "invalid reload token", http.StatusUnauthorized)
+			return
+		}
+
+		if err := reload(); err != nil {
+			http.Error(w, fmt.Sprintf("failed to reload configuration: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		_, _ = fmt.Fprintln(w, "HDHomeRun exporter configuration reloaded.")
+	})
+}
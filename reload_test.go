@@ -0,0 +1,136 @@
+package hdhomerunexporter_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/hdhomerun"
+	"github.com/mdlayher/hdhomerun_exporter"
+)
+
+func TestHandlerReload(t *testing.T) {
+	dial := func(_ string) (*hdhomerun.Client, error) {
+		return nil, errors.New("always fails")
+	}
+
+	h := hdhomerunexporter.NewHandler(dial,
+		hdhomerunexporter.WithAllowedTargets([]string{"foo"}),
+	)
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	get := func(query string) int {
+		t.Helper()
+
+		res, err := http.Get(s.URL + "?" + query)
+		if err != nil {
+			t.Fatalf("failed to perform HTTP request: %v", err)
+		}
+		_ = res.Body.Close()
+
+		return res.StatusCode
+	}
+
+	before := []int{
+		get("target=foo"),
+		get("target=bar"),
+		get("target=bar&module=legacy"),
+	}
+
+	h.Reload(nil, map[string]hdhomerunexporter.Module{
+		"legacy": {Protocol: hdhomerunexporter.ProtocolControl},
+	}, []string{"bar"})
+
+	after := []int{
+		get("target=foo"),
+		get("target=bar"),
+		get("target=bar&module=legacy"),
+	}
+
+	if diff := cmp.Diff([]int{http.StatusOK, http.StatusForbidden, http.StatusForbidden}, before); diff != "" {
+		t.Fatalf("unexpected HTTP status codes before reload (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]int{http.StatusForbidden, http.StatusOK, http.StatusOK}, after); diff != "" {
+		t.Fatalf("unexpected HTTP status codes after reload (-want +got):\n%s", diff)
+	}
+
+	// Empty entries do not allow unmapped targets.
+	h.Reload(nil, nil, []string{"", "bar"})
+
+	if diff := cmp.Diff(http.StatusForbidden, get("target=foo")); diff != "" {
+		t.Fatalf("unexpected HTTP status code after reload with empty entry (-want +got):\n%s", diff)
+	}
+}
+
+func TestReloadHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		auth   string
+		err    error
+		code   int
+		reload bool
+	}{
+		{
+			name:   "GET",
+			method: http.MethodGet,
+			auth:   "Bearer secret",
+			code:   http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "no token",
+			method: http.MethodPost,
+			code:   http.StatusUnauthorized,
+		},
+		{
+			name:   "bad token",
+			method: http.MethodPost,
+			auth:   "Bearer foo",
+			code:   http.StatusUnauthorized,
+		},
+		{
+			name:   "reload failed",
+			method: http.MethodPost,
+			auth:   "Bearer secret",
+			err:    errors.New("bad configuration"),
+			code:   http.StatusInternalServerError,
+			reload: true,
+		},
+		{
+			name:   "OK",
+			method: http.MethodPost,
+			auth:   "Bearer secret",
+			code:   http.StatusOK,
+			reload: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reloaded bool
+			h := hdhomerunexporter.ReloadHandler("secret", func() error {
+				reloaded = true
+				return tt.err
+			})
+
+			r := httptest.NewRequest(tt.method, "/-/reload", nil)
+			if tt.auth != "" {
+				r.Header.Set("Authorization", tt.auth)
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if diff := cmp.Diff(tt.code, w.Code); diff != "" {
+				t.Fatalf("unexpected HTTP status code (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.reload, reloaded); diff != "" {
+				t.Fatalf("unexpected reload (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
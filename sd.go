@@ -0,0 +1,70 @@
+package hdhomerunexporter
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// An sdTargetGroup is a target group in the Prometheus HTTP service discovery
+// JSON format.
+type sdTargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// ServiceDiscovery returns an http.Handler which serves every device found
+// using discovery in the Prometheus HTTP service discovery format, for use
+// with http_sd_configs. Each device's target is its device ID, and metadata
+// such as its address, type, tuner count, and model are provided using
+// labels with the __meta_hdhomerun_ prefix. Discovery must be enabled using
+// WithDiscovery.
+func (h *Handler) ServiceDiscovery() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		devices, err := h.discoverDevices(r.Context())
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+
+		groups := make([]sdTargetGroup, 0, len(devices))
+		for _, d := range devices {
+			id := strings.ToUpper(d.ID)
+
+			labels := map[string]string{
+				"__meta_hdhomerun_device_id":   id,
+				"__meta_hdhomerun_address":     deviceAddr(d),
+				"__meta_hdhomerun_device_type": d.Type.String(),
+				"__meta_hdhomerun_tuners":      strconv.Itoa(d.Tuners),
+			}
+
+			// The model is only known once the device has been scraped.
+			if _, ident := h.knownDevice(id); ident.HWModel != "" {
+				labels["__meta_hdhomerun_model"] = ident.Model
+				labels["__meta_hdhomerun_hwmodel"] = ident.HWModel
+			}
+
+			groups = append(groups, sdTargetGroup{
+				Targets: []string{id},
+				Labels:  labels,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(groups)
+	})
+}
+
+// knownDevice returns the address and identity recorded for target, if the
+// target has been scraped.
+func (h *Handler) knownDevice(target string) (string, deviceIdentity) {
+	h.mu.Lock()
+	s, ok := h.devices[target]
+	h.mu.Unlock()
+	if !ok {
+		return "", deviceIdentity{}
+	}
+
+	return s.device()
+}
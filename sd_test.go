@@ -0,0 +1,63 @@
+package hdhomerunexporter_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/hdhomerun_exporter"
+)
+
+func TestHandlerServiceDiscovery(t *testing.T) {
+	h := hdhomerunexporter.NewHandler(nil, hdhomerunexporter.WithDiscovery(testDiscover))
+
+	s := httptest.NewServer(h.ServiceDiscovery())
+	defer s.Close()
+
+	res, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatalf("failed to perform HTTP request: %v", err)
+	}
+	defer res.Body.Close()
+
+	type targetGroup struct {
+		Targets []string          `json:"targets"`
+		Labels  map[string]string `json:"labels"`
+	}
+
+	var got []targetGroup
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode target groups: %v", err)
+	}
+
+	want := []targetGroup{{
+		Targets: []string{"1040A1B2"},
+		Labels: map[string]string{
+			"__meta_hdhomerun_address":     "192.168.1.10:65001",
+			"__meta_hdhomerun_device_id":   "1040A1B2",
+			"__meta_hdhomerun_device_type": "tuner",
+			"__meta_hdhomerun_tuners":      "2",
+		},
+	}}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected target groups (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandlerServiceDiscoveryDisabled(t *testing.T) {
+	s := httptest.NewServer(hdhomerunexporter.NewHandler(nil).ServiceDiscovery())
+	defer s.Close()
+
+	res, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatalf("failed to perform HTTP request: %v", err)
+	}
+	defer res.Body.Close()
+
+	if diff := cmp.Diff(http.StatusNotFound, res.StatusCode); diff != "" {
+		t.Fatalf("unexpected HTTP status code (-want +got):\n%s", diff)
+	}
+}
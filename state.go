@@ -0,0 +1,361 @@
+package hdhomerunexporter
+
+import (
+	"sync"
+	"time"
+)
+
+// A deviceState tracks information about a single device across multiple
+// scrapes, so that metrics which depend on previous observations can be
+// computed.
+type deviceState struct {
+	mu       sync.Mutex
+	counters map[counterKey]*counter
+
+	stopReasons map[string]string
+	stops       map[counterKey]float64
+
+	uptime  time.Duration
+	reboots float64
+
+	tunerErrors  map[string]float64
+	symbolErrors map[string]float64
+
+	caps        *capabilities
+	capsTime    time.Time
+	missingKeys map[string]bool
+
+	discover     *discoverJSON
+	discoverTime time.Time
+
+	scrape   scrapeStatus
+	addr     string
+	identity deviceIdentity
+
+	cache   map[string]cachedScrape
+	flights map[string]*flight
+
+	// sem permits only one scrape of the device at a time.
+	sem chan struct{}
+
+	// used is the time at which the deviceState was last used by a scrape.
+	used time.Time
+
+	// created is the time at which the deviceState was created, and thus
+	// the time at which the counters maintained by the exporter began.
+	created time.Time
+}
+
+// deviceIdleTimeout is the amount of time after which the state of a device
+// which is no longer scraped is discarded.
+const deviceIdleTimeout = 1 * time.Hour
+
+// A scrapeStatus is the outcome of the most recent scrape of a device.
+type scrapeStatus struct {
+	Time       time.Time
+	Backend    string
+	Err        error
+	ErrorClass string
+}
+
+// A deviceIdentity is the identifying metadata most recently reported by a
+// device.
+type deviceIdentity struct {
+	DeviceID string
+	Model    string
+	HWModel  string
+	Firmware string
+}
+
+// newDeviceState creates an empty deviceState.
+func newDeviceState() *deviceState {
+	return &deviceState{
+		counters:     make(map[counterKey]*counter),
+		stopReasons:  make(map[string]string),
+		stops:        make(map[counterKey]float64),
+		tunerErrors:  make(map[string]float64),
+		symbolErrors: make(map[string]float64),
+		missingKeys:  make(map[string]bool),
+		cache:        make(map[string]cachedScrape),
+		flights:      make(map[string]*flight),
+		sem:          make(chan struct{}, 1),
+		created:      time.Now(),
+	}
+}
+
+// touch records that the deviceState was used at time now.
+func (s *deviceState) touch(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.used = now
+}
+
+// idle determines if the deviceState has not been used since before
+// deviceIdleTimeout elapsed as of now, and no scrape of the device is in
+// progress.
+func (s *deviceState) idle(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return now.Sub(s.used) >= deviceIdleTimeout && len(s.flights) == 0 && len(s.sem) == 0
+}
+
+// A counterKey uniquely identifies a device counter.
+type counterKey struct {
+	name  string
+	tuner string
+}
+
+// A counter accumulates a raw device counter value which may be reset by
+// the device at any time.
+type counter struct {
+	last  int
+	total float64
+}
+
+// accumulate observes the raw device counter value v for the counter with the
+// specified name and tuner, and returns a monotonic total for that counter.
+//
+// HDHomeRun devices reset their counters when a tuner is retuned or the
+// device reboots. Any decrease in value is treated as a reset, and the new
+// value is added to the running total so that the total never decreases.
+func (s *deviceState) accumulate(name, tuner string, v int) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := counterKey{name: name, tuner: tuner}
+	c, ok := s.counters[k]
+	if !ok {
+		// First observation: start from the device's current value.
+		c = &counter{last: v, total: float64(v)}
+		s.counters[k] = c
+		return c.total
+	}
+
+	if v >= c.last {
+		c.total += float64(v - c.last)
+	} else {
+		// The counter was reset; everything observed since the reset counts.
+		c.total += float64(v)
+	}
+	c.last = v
+
+	return c.total
+}
+
+// observeStop observes the current stream stop reason for a tuner, where
+// stopped reports whether the reason indicates that the stream has stopped.
+// It returns the number of times the tuner's stream has stopped, keyed by
+// stop reason.
+//
+// A stop is counted whenever the tuner's stop reason is first observed or
+// changes to a reason which indicates that the stream has stopped. Stops which
+// begin and end between observations cannot be detected, so the tuners of
+// scraped devices may also be observed by a background poller; see
+// WithStopPolling.
+func (s *deviceState) observeStop(tuner, reason string, stopped bool) map[string]float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	last, ok := s.stopReasons[tuner]
+	if stopped && (!ok || reason != last) {
+		s.stops[counterKey{name: reason, tuner: tuner}]++
+	}
+	s.stopReasons[tuner] = reason
+
+	stops := make(map[string]float64)
+	for k, v := range s.stops {
+		if k.tuner == tuner {
+			stops[k.name] = v
+		}
+	}
+
+	return stops
+}
+
+// uptimeDecreased determines if uptime is lower than the device's previously
+// observed uptime, which indicates that the device rebooted or that another
+// device is now reachable at its address.
+func (s *deviceState) uptimeDecreased(uptime time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return uptime < s.uptime
+}
+
+// observeUptime observes the device's current uptime and returns the total
+// number of reboots detected for the device. If replaced is true, another
+// device was found at the device's address, and the device is tracked anew.
+//
+// A reboot is detected whenever the device's uptime is lower than the
+// previously observed uptime, unless the device was replaced.
+func (s *deviceState) observeUptime(uptime time.Duration, replaced bool) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if uptime < s.uptime {
+		if !replaced {
+			s.reboots++
+		}
+
+		// The device may have been upgraded or replaced, so its capabilities
+		// must be probed again.
+		s.caps = nil
+		s.missingKeys = make(map[string]bool)
+		s.discover = nil
+	}
+	s.uptime = uptime
+
+	return s.reboots
+}
+
+// observeTunerError observes whether collection of tuner failed, and returns
+// the total number of failures observed for the tuner.
+func (s *deviceState) observeTunerError(tuner string, failed bool) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if failed {
+		s.tunerErrors[tuner]++
+	}
+
+	return s.tunerErrors[tuner]
+}
+
+// observeSymbolErrors observes whether tuner reported symbol errors, and
+// returns the total number of observations in which it did.
+func (s *deviceState) observeSymbolErrors(tuner string, errored bool) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if errored {
+		s.symbolErrors[tuner]++
+	}
+
+	return s.symbolErrors[tuner]
+}
+
+// capabilitiesRetryInterval is the amount of time after which capabilities
+// which could only be partially probed are probed again.
+const capabilitiesRetryInterval = 5 * time.Minute
+
+// capabilities returns the device's cached capabilities, calling probe to
+// determine them if they are not yet known, or if they were only partially
+// probed more than capabilitiesRetryInterval ago. The device is probed
+// without holding the deviceState's lock, so that a slow probe does not
+// block the deviceState's other users.
+func (s *deviceState) capabilities(probe func() (capabilities, error)) (capabilities, error) {
+	s.mu.Lock()
+	if s.caps != nil && (!s.caps.Partial || time.Since(s.capsTime) < capabilitiesRetryInterval) {
+		caps := *s.caps
+		s.mu.Unlock()
+		return caps, nil
+	}
+	s.mu.Unlock()
+
+	caps, err := probe()
+	if err != nil {
+		return capabilities{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.caps = &caps
+	s.capsTime = time.Now()
+
+	return caps, nil
+}
+
+// discoverCacheInterval is the amount of time for which a device's
+// discover.json is reused across scrapes before it is fetched again.
+const discoverCacheInterval = 1 * time.Minute
+
+// cachedDiscover returns the device's discover.json, if it was fetched less
+// than discoverCacheInterval before now.
+func (s *deviceState) cachedDiscover(now time.Time) (discoverJSON, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.discover == nil || now.Sub(s.discoverTime) >= discoverCacheInterval {
+		return discoverJSON{}, false
+	}
+
+	return *s.discover, true
+}
+
+// setDiscover caches the device's discover.json, fetched at time now.
+func (s *deviceState) setDiscover(discover discoverJSON, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.discover = &discover
+	s.discoverTime = now
+}
+
+// isMissing determines if a previous query found that key does not exist.
+func (s *deviceState) isMissing(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.missingKeys[key]
+}
+
+// setMissing records that key does not exist on the device.
+func (s *deviceState) setMissing(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.missingKeys[key] = true
+}
+
+// recordScrape records the outcome of a scrape of the device at time t,
+// using the specified backend.
+func (s *deviceState) recordScrape(t time.Time, backend string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.scrape = scrapeStatus{
+		Time:    t,
+		Backend: backend,
+		Err:     err,
+	}
+
+	if err != nil {
+		s.scrape.ErrorClass = errorClass(err)
+	}
+}
+
+// setAddr records the network address used to reach the device.
+func (s *deviceState) setAddr(addr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addr = addr
+}
+
+// setIdentity records the identifying metadata reported by the device.
+func (s *deviceState) setIdentity(id deviceIdentity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.identity = id
+}
+
+// device returns the network address and identifying metadata most recently
+// recorded for the device.
+func (s *deviceState) device() (string, deviceIdentity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addr, s.identity
+}
+
+// lastScrape returns the outcome of the most recent scrape of the device.
+func (s *deviceState) lastScrape() scrapeStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.scrape
+}
@@ -0,0 +1,630 @@
+package hdhomerunexporter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/hdhomerun"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestDeviceStateAccumulate(t *testing.T) {
+	tests := []struct {
+		name  string
+		vs    []int
+		total float64
+	}{
+		{
+			name:  "first observation",
+			vs:    []int{10},
+			total: 10,
+		},
+		{
+			name:  "increasing",
+			vs:    []int{1, 2, 5},
+			total: 5,
+		},
+		{
+			name:  "reset to zero",
+			vs:    []int{10, 0},
+			total: 10,
+		},
+		{
+			name:  "reset and increase",
+			vs:    []int{10, 12, 3, 4},
+			total: 16,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newDeviceState()
+
+			var total float64
+			for _, v := range tt.vs {
+				total = s.accumulate("test", "0", v)
+			}
+
+			if diff := cmp.Diff(tt.total, total); diff != "" {
+				t.Fatalf("unexpected counter total (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDeviceStateObserveUptime(t *testing.T) {
+	tests := []struct {
+		name    string
+		uptimes []time.Duration
+		// replaced reports whether the device was replaced before the final
+		// observation.
+		replaced bool
+		reboots  float64
+	}{
+		{
+			name:    "first observation",
+			uptimes: []time.Duration{10 * time.Minute},
+		},
+		{
+			name:    "increasing",
+			uptimes: []time.Duration{1 * time.Minute, 2 * time.Minute},
+		},
+		{
+			name:    "rebooted",
+			uptimes: []time.Duration{1 * time.Hour, 1 * time.Minute},
+			reboots: 1,
+		},
+		{
+			name: "rebooted twice",
+			uptimes: []time.Duration{
+				1 * time.Hour,
+				1 * time.Minute,
+				10 * time.Minute,
+				5 * time.Second,
+			},
+			reboots: 2,
+		},
+		{
+			name: "replaced",
+			uptimes: []time.Duration{
+				1 * time.Hour,
+				1 * time.Minute,
+				10 * time.Minute,
+				5 * time.Second,
+			},
+			replaced: true,
+			reboots:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newDeviceState()
+
+			var reboots float64
+			for i, u := range tt.uptimes {
+				replaced := tt.replaced && i == len(tt.uptimes)-1
+				reboots = s.observeUptime(u, replaced)
+			}
+
+			if diff := cmp.Diff(tt.reboots, reboots); diff != "" {
+				t.Fatalf("unexpected number of reboots (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDeviceStateObserveStop(t *testing.T) {
+	tests := []struct {
+		name    string
+		reasons []string
+		stops   map[string]float64
+	}{
+		{
+			name:    "first observation",
+			reasons: []string{"connection_loss", "connection_loss"},
+			stops:   map[string]float64{"connection_loss": 1},
+		},
+		{
+			name:    "not stopped",
+			reasons: []string{"not_stopped", "not_stopped"},
+			stops:   map[string]float64{},
+		},
+		{
+			name:    "stopped",
+			reasons: []string{"not_stopped", "connection_loss", "connection_loss"},
+			stops:   map[string]float64{"connection_loss": 1},
+		},
+		{
+			name: "stopped several times",
+			reasons: []string{
+				"not_stopped",
+				"connection_loss",
+				"not_stopped",
+				"connection_loss",
+				"intentional",
+			},
+			stops: map[string]float64{
+				"connection_loss": 2,
+				"intentional":     1,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newDeviceState()
+
+			var stops map[string]float64
+			for _, r := range tt.reasons {
+				stops = s.observeStop("0", r, r != "not_stopped")
+			}
+
+			if diff := cmp.Diff(tt.stops, stops); diff != "" {
+				t.Fatalf("unexpected stops (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDeviceStateObserveSymbolErrors(t *testing.T) {
+	s := newDeviceState()
+
+	var total float64
+	for _, errored := range []bool{false, true, true, false} {
+		total = s.observeSymbolErrors("0", errored)
+	}
+
+	if diff := cmp.Diff(2.0, total); diff != "" {
+		t.Fatalf("unexpected number of symbol error observations (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(0.0, s.observeSymbolErrors("1", false)); diff != "" {
+		t.Fatalf("unexpected observations for another tuner (-want +got):\n%s", diff)
+	}
+}
+
+func TestDeviceStateCapabilities(t *testing.T) {
+	s := newDeviceState()
+
+	var probes int
+	probe := func() (capabilities, error) {
+		probes++
+		return capabilities{HWModel: "HDHR3-CC"}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.capabilities(probe); err != nil {
+			t.Fatalf("failed to get capabilities: %v", err)
+		}
+	}
+
+	// A reboot invalidates the cached capabilities.
+	s.observeUptime(1*time.Hour, false)
+	s.observeUptime(1*time.Minute, false)
+
+	caps, err := s.capabilities(probe)
+	if err != nil {
+		t.Fatalf("failed to get capabilities: %v", err)
+	}
+
+	if diff := cmp.Diff(capabilities{HWModel: "HDHR3-CC"}, caps); diff != "" {
+		t.Fatalf("unexpected capabilities (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(2, probes); diff != "" {
+		t.Fatalf("unexpected number of probes (-want +got):\n%s", diff)
+	}
+}
+
+func TestDeviceStateCapabilitiesPartial(t *testing.T) {
+	s := newDeviceState()
+
+	var probes int
+	probe := func() (capabilities, error) {
+		probes++
+		return capabilities{Partial: probes == 1}, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.capabilities(probe); err != nil {
+			t.Fatalf("failed to get capabilities: %v", err)
+		}
+	}
+
+	if diff := cmp.Diff(1, probes); diff != "" {
+		t.Fatalf("partial capabilities probed again too soon (-want +got):\n%s", diff)
+	}
+
+	// Partial capabilities are probed again once the retry interval elapses,
+	// and complete capabilities are cached thereafter.
+	s.capsTime = s.capsTime.Add(-capabilitiesRetryInterval)
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.capabilities(probe); err != nil {
+			t.Fatalf("failed to get capabilities: %v", err)
+		}
+	}
+
+	if diff := cmp.Diff(2, probes); diff != "" {
+		t.Fatalf("unexpected number of probes (-want +got):\n%s", diff)
+	}
+}
+
+func TestDeviceStateCachedDiscover(t *testing.T) {
+	s := newDeviceState()
+	now := time.Now()
+
+	if _, ok := s.cachedDiscover(now); ok {
+		t.Fatal("discover.json should not be cached initially")
+	}
+
+	want := discoverJSON{DeviceID: "1040A1B2"}
+	s.setDiscover(want, now)
+
+	got, ok := s.cachedDiscover(now.Add(discoverCacheInterval / 2))
+	if !ok {
+		t.Fatal("discover.json should be cached")
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected discover.json (-want +got):\n%s", diff)
+	}
+
+	if _, ok := s.cachedDiscover(now.Add(discoverCacheInterval)); ok {
+		t.Fatal("discover.json should have expired")
+	}
+}
+
+func TestDeviceStateCached(t *testing.T) {
+	var (
+		s   = newDeviceState()
+		now = time.Unix(0, 0)
+		ttl = 5 * time.Second
+
+		up = prometheus.MustNewConstMetric(
+			prometheus.NewDesc("hdhomerun_up", "", nil, nil),
+			prometheus.GaugeValue,
+			1,
+		)
+	)
+
+	if _, ok := s.cached("target=foo", ttl, now); ok {
+		t.Fatal("metrics were cached before any scrape")
+	}
+
+	s.setCached("target=foo", now, []prometheus.Metric{up}, nil)
+
+	tests := []struct {
+		name string
+		key  string
+		now  time.Time
+		ok   bool
+	}{
+		{
+			name: "within TTL",
+			key:  "target=foo",
+			now:  now.Add(ttl - 1),
+			ok:   true,
+		},
+		{
+			name: "expired",
+			key:  "target=foo",
+			now:  now.Add(ttl),
+		},
+		{
+			name: "other parameters",
+			key:  "target=foo&timeout=2s",
+			now:  now,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs, ok := s.cached(tt.key, ttl, tt.now)
+			if diff := cmp.Diff(tt.ok, ok); diff != "" {
+				t.Fatalf("unexpected cache hit (-want +got):\n%s", diff)
+			}
+
+			if ok && len(cs.metrics) != 1 {
+				t.Fatalf("unexpected number of cached metrics: %d", len(cs.metrics))
+			}
+		})
+	}
+}
+
+func TestDeviceStateCachedPrune(t *testing.T) {
+	var (
+		s   = newDeviceState()
+		now = time.Unix(0, 0)
+	)
+
+	s.setCached("target=foo&timeout=2s", now, nil, nil)
+	s.setCached("target=foo", now.Add(deviceIdleTimeout), nil, nil)
+
+	if _, ok := s.cache["target=foo&timeout=2s"]; ok {
+		t.Fatal("cached scrape which is no longer used was not pruned")
+	}
+	if _, ok := s.cache["target=foo"]; !ok {
+		t.Fatal("cached scrape was pruned")
+	}
+}
+
+func TestStaleMetricsLabels(t *testing.T) {
+	desc := prometheus.NewDesc("hdhomerun_tuner_locked", "", []string{"tuner"}, nil)
+	locked := func(tuner string, v float64) prometheus.Metric {
+		return prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, tuner)
+	}
+
+	// Only tuner 0 could be scraped, so the last known metrics of tuner 1
+	// must be preserved.
+	metrics := staleMetrics(
+		[]prometheus.Metric{locked("0", 0)},
+		[]prometheus.Metric{locked("0", 1), locked("1", 1)},
+	)
+
+	var keys []string
+	for _, m := range metrics {
+		keys = append(keys, metricKey(m))
+	}
+
+	want := []string{
+		metricKey(locked("0", 0)),
+		metricKey(locked("1", 1)),
+	}
+
+	if diff := cmp.Diff(want, keys); diff != "" {
+		t.Fatalf("unexpected stale metrics (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandlerReloadResetsCache(t *testing.T) {
+	h := NewHandler(nil)
+
+	now := time.Now()
+	h.state("foo").setCached("target=foo", now, nil, nil)
+
+	h.Reload(nil, nil, nil)
+
+	if _, ok := h.state("foo").cached("target=foo", time.Hour, now); ok {
+		t.Fatal("cached scrape survived reload")
+	}
+}
+
+func TestHandlerDisallowedTargetNotTracked(t *testing.T) {
+	h := NewHandler(nil,
+		WithAllowedTargets([]string{"bar"}),
+		WithCacheTTL(time.Minute),
+	)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?target=foo", nil))
+
+	if diff := cmp.Diff(http.StatusForbidden, w.Code); diff != "" {
+		t.Fatalf("unexpected HTTP status code (-want +got):\n%s", diff)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.devices["foo"]; ok {
+		t.Fatal("disallowed target was tracked")
+	}
+}
+
+func TestHandlerCacheAuth(t *testing.T) {
+	var dials int
+	dial := testControlDevice(t)
+
+	h := NewHandler(func(addr string) (*hdhomerun.Client, error) {
+		dials++
+		return dial(addr)
+	}, WithCacheTTL(time.Minute))
+
+	for _, tt := range []struct {
+		query string
+		dials int
+	}{
+		{query: "target=foo&auth=valid", dials: 1},
+		{query: "target=foo&auth=valid", dials: 1},
+		// Scrapes without the token, or with another token, must not be
+		// served the results of the scrape which used it.
+		{query: "target=foo", dials: 2},
+		{query: "target=foo&auth=invalid", dials: 3},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil))
+
+		if diff := cmp.Diff(tt.dials, dials); diff != "" {
+			t.Fatalf("unexpected number of dials after %q (-want +got):\n%s", tt.query, diff)
+		}
+	}
+}
+
+func TestScrapeKey(t *testing.T) {
+	tests := []struct {
+		name string
+		q    url.Values
+		auth Secret
+		key  string
+	}{
+		{
+			name: "target",
+			q:    url.Values{"target": {"foo"}},
+			key:  "target=foo",
+		},
+		{
+			name: "ignored parameters",
+			q: url.Values{
+				"target":     {"foo"},
+				"label_room": {"den"},
+				"foo":        {"bar"},
+			},
+			key: "target=foo",
+		},
+		{
+			// Scrapes with different device auth tokens must not share
+			// results, but the token itself is not part of the key.
+			name: "auth hashed",
+			q: url.Values{
+				"target": {"foo"},
+				"auth":   {"ignored"},
+			},
+			auth: "secret",
+			key:  "auth=2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b&target=foo",
+		},
+		{
+			name: "collectors sorted",
+			q: url.Values{
+				"target":    {"foo"},
+				"module":    {"legacy"},
+				"timeout":   {"2s"},
+				"collect[]": {"tuner", "device"},
+			},
+			key: "collect%5B%5D=device&collect%5B%5D=tuner&module=legacy&target=foo&timeout=2s",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.key, scrapeKey(tt.q, tt.auth)); diff != "" {
+				t.Fatalf("unexpected scrape key (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDeviceStateCachedStale(t *testing.T) {
+	gauge := func(name string, v float64) prometheus.Metric {
+		return prometheus.MustNewConstMetric(
+			prometheus.NewDesc(name, "", nil, nil),
+			prometheus.GaugeValue,
+			v,
+		)
+	}
+
+	var (
+		s   = newDeviceState()
+		now = time.Unix(0, 0)
+		key = "target=foo"
+	)
+
+	s.setCached(key, now, []prometheus.Metric{
+		gauge("hdhomerun_up", 1),
+		gauge("hdhomerun_device_tuners", 2),
+	}, nil)
+
+	cs := s.setCached(key, now.Add(time.Minute), []prometheus.Metric{
+		gauge("hdhomerun_up", 0),
+		gauge("hdhomerun_scrape_error", 1),
+	}, errors.New("failed to dial"))
+
+	if !cs.stale {
+		t.Fatal("failed scrape was not marked stale")
+	}
+
+	if diff := cmp.Diff(now, cs.fresh); diff != "" {
+		t.Fatalf("unexpected last successful scrape time (-want +got):\n%s", diff)
+	}
+
+	var names []string
+	for _, m := range cs.metrics {
+		names = append(names, m.Desc().String())
+	}
+
+	want := []string{
+		gauge("hdhomerun_up", 0).Desc().String(),
+		gauge("hdhomerun_scrape_error", 1).Desc().String(),
+		gauge("hdhomerun_device_tuners", 2).Desc().String(),
+	}
+
+	if diff := cmp.Diff(want, names); diff != "" {
+		t.Fatalf("unexpected stale metrics (-want +got):\n%s", diff)
+	}
+
+	cs = s.setCached(key, now.Add(2*time.Minute), []prometheus.Metric{
+		gauge("hdhomerun_up", 1),
+	}, nil)
+
+	if cs.stale || len(cs.metrics) != 1 {
+		t.Fatal("successful scrape did not replace stale metrics")
+	}
+}
+
+func TestDeviceStateFlight(t *testing.T) {
+	s := newDeviceState()
+
+	f, leader := s.join("target=foo")
+	if !leader {
+		t.Fatal("first scrape did not lead its flight")
+	}
+
+	f2, leader := s.join("target=foo")
+	if leader || f2 != f {
+		t.Fatal("identical scrape did not join the flight in progress")
+	}
+
+	if _, leader := s.join("target=bar"); !leader {
+		t.Fatal("scrape with other parameters joined the flight in progress")
+	}
+
+	up := prometheus.MustNewConstMetric(
+		prometheus.NewDesc("hdhomerun_up", "", nil, nil),
+		prometheus.GaugeValue,
+		1,
+	)
+
+	s.land("target=foo", f, []prometheus.Metric{up}, nil)
+	// Later results must not affect the completed flight.
+	s.land("target=foo", f, nil, errAbandoned)
+
+	metrics, err := f2.wait(context.Background())
+	if err != nil {
+		t.Fatalf("failed to wait for flight: %v", err)
+	}
+
+	if len(metrics) != 1 {
+		t.Fatalf("unexpected number of shared metrics: %d", len(metrics))
+	}
+
+	if _, leader := s.join("target=foo"); !leader {
+		t.Fatal("scrape after completed flight did not lead a new flight")
+	}
+}
+
+func TestHandlerEvictIdle(t *testing.T) {
+	h := NewHandler(nil)
+
+	var (
+		idle = h.state("idle")
+		busy = h.state("busy")
+		used = h.state("used")
+	)
+
+	now := time.Now().Add(deviceIdleTimeout)
+	used.touch(now)
+
+	// A scrape of busy is in progress.
+	busy.sem <- struct{}{}
+
+	h.mu.Lock()
+	h.evictIdle(now)
+	h.mu.Unlock()
+
+	if _, ok := h.devices["idle"]; ok {
+		t.Fatal("idle device state was not evicted")
+	}
+	if h.devices["busy"] != busy || h.devices["used"] != used {
+		t.Fatal("device state in use was evicted")
+	}
+
+	if h.state("idle") == idle {
+		t.Fatal("evicted device state was reused")
+	}
+}
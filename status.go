@@ -0,0 +1,192 @@
+package hdhomerunexporter
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+
+	"github.com/mdlayher/hdhomerun"
+)
+
+// A deviceStatus is a snapshot of the status of a device and its tuners.
+type deviceStatus struct {
+	Target string        `json:"target"`
+	Model  string        `json:"model"`
+	Tuners []tunerStatus `json:"tuners"`
+}
+
+// A tunerStatus is a snapshot of the status of a single tuner.
+type tunerStatus struct {
+	Index int                   `json:"index"`
+	Debug *hdhomerun.TunerDebug `json:"debug"`
+}
+
+// status retrieves a snapshot of the status of the device and its tuners,
+// using the same device queries used to collect metrics.
+func (c *collector) status() (*deviceStatus, error) {
+	model, err := c.d.Model()
+	if err != nil {
+		return nil, err
+	}
+
+	ds := &deviceStatus{Model: model}
+	_, err = c.forEachTuner(func(t tuner) error {
+		debug, err := t.Debug()
+		if err != nil {
+			return err
+		}
+
+		ds.Tuners = append(ds.Tuners, tunerStatus{
+			Index: t.Index(),
+			Debug: debug,
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ds, nil
+}
+
+// deviceStatus retrieves a snapshot of the status of the device specified by
+// the "target" query parameter in r.
+func (h *Handler) deviceStatus(r *http.Request) (*deviceStatus, error) {
+	name, _, _ := splitScheme(r.URL.Query().Get("target"))
+	release, err := h.acquire(r.Context(), name)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	c, done, err := h.statusCollector(r)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	ds, err := c.status()
+	if err != nil {
+		return nil, err
+	}
+	ds.Target = r.URL.Query().Get("target")
+
+	return ds, nil
+}
+
+// statusCollector is like collector, but reports an error if the device
+// specified by r is not scraped using the control protocol, which is required
+// to retrieve the status of its tuners.
+func (h *Handler) statusCollector(r *http.Request) (*collector, func(), error) {
+	c, done, err := h.collector(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if c.d == nil {
+		done()
+		return nil, nil, &statusError{
+			code: http.StatusBadRequest,
+			err:  errors.New("status requires the control protocol"),
+		}
+	}
+
+	return c, done, nil
+}
+
+// StatusPage returns an http.Handler which serves a lightweight HTML page
+// displaying the live status of the device specified by the "target" query
+// parameter, which is useful for tasks such as antenna alignment.
+func (h *Handler) StatusPage() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("target") == "" {
+			// Prompt for a target.
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_ = statusTemplate.Execute(w, nil)
+			return
+		}
+
+		ds, err := h.deviceStatus(r)
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = statusTemplate.Execute(w, ds)
+	})
+}
+
+// StatusAPI returns an http.Handler which serves the live status of the
+// device specified by the "target" query parameter as JSON, including the
+// parsed debug status of each of its tuners, so that other tools need not
+// implement the HDHomeRun control protocol.
+func (h *Handler) StatusAPI() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ds, err := h.deviceStatus(r)
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(ds)
+	})
+}
+
+// statusTemplate renders a deviceStatus as HTML.
+var statusTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+{{- if . }}
+<meta http-equiv="refresh" content="2">
+<title>HDHomeRun status: {{ .Target }}</title>
+{{- else }}
+<title>HDHomeRun status</title>
+{{- end }}
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { padding: 4px 8px; text-align: left; }
+.bar { width: 150px; height: 12px; background: #ddd; }
+.bar div { height: 100%; background: #4a4; }
+</style>
+</head>
+<body>
+{{- if not . }}
+<h1>HDHomeRun status</h1>
+<form>
+<label>Target: <input name="target" placeholder="192.168.1.10"></label>
+<input type="submit" value="Show status">
+</form>
+{{- else }}
+<h1>{{ .Target }} ({{ .Model }})</h1>
+<table>
+<tr><th>Tuner</th><th>Channel</th><th>Lock</th><th>Signal strength</th><th>Signal-to-noise quality</th><th>Symbol error quality</th><th>Streaming</th></tr>
+{{- range .Tuners }}
+<tr>
+<td>{{ .Index }}</td>
+{{- with .Debug.Tuner }}
+<td>{{ .Channel }}</td>
+<td>{{ .Lock }}</td>
+<td><div class="bar"><div style="width: {{ .SignalStrength }}%"></div></div>{{ .SignalStrength }}%</td>
+<td><div class="bar"><div style="width: {{ .SignalToNoiseQuality }}%"></div></div>{{ .SignalToNoiseQuality }}%</td>
+<td><div class="bar"><div style="width: {{ .SymbolErrorQuality }}%"></div></div>{{ .SymbolErrorQuality }}%</td>
+{{- else }}
+<td colspan="5">unknown</td>
+{{- end }}
+{{- with .Debug.Network }}
+<td>{{ if gt .PacketsPerSecond 0 }}{{ .PacketsPerSecond }} packets/s{{ else }}idle{{ end }}</td>
+{{- else }}
+<td>unknown</td>
+{{- end }}
+</tr>
+{{- end }}
+</table>
+{{- end }}
+</body>
+</html>
+`))
@@ -0,0 +1,97 @@
+package hdhomerunexporter
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/hdhomerun"
+)
+
+func TestCollectorStatus(t *testing.T) {
+	d := &testDevice{
+		model: "hdhomerun_test",
+		tuners: []testTuner{
+			{index: 0, debug: idleDebug()},
+			{index: 1, debug: idleDebug()},
+		},
+	}
+
+	c := newCollector(d, nil, newDeviceState(), collectorConfig{
+		Target: TargetConfig{SkipTuners: []int{0}},
+	}).(*collector)
+
+	ds, err := c.status()
+	if err != nil {
+		t.Fatalf("failed to get status: %v", err)
+	}
+
+	want := &deviceStatus{
+		Model: "hdhomerun_test",
+		Tuners: []tunerStatus{{
+			Index: 1,
+			Debug: idleDebug(),
+		}},
+	}
+
+	if diff := cmp.Diff(want, ds); diff != "" {
+		t.Fatalf("unexpected device status (-want +got):\n%s", diff)
+	}
+}
+
+func TestStatusTemplate(t *testing.T) {
+	ds := &deviceStatus{
+		Target: "192.168.1.10",
+		Model:  "hdhomerun_test",
+		Tuners: []tunerStatus{{
+			Index: 0,
+			Debug: &hdhomerun.TunerDebug{
+				Tuner: &hdhomerun.TunerStatus{
+					Channel:        "8vsb:473000000",
+					Lock:           "8vsb",
+					SignalStrength: 87,
+				},
+				Network: &hdhomerun.NetworkStatus{PacketsPerSecond: 241},
+			},
+		}},
+	}
+
+	var buf bytes.Buffer
+	if err := statusTemplate.Execute(&buf, ds); err != nil {
+		t.Fatalf("failed to execute template: %v", err)
+	}
+
+	for _, s := range []string{
+		"192.168.1.10 (hdhomerun_test)",
+		"8vsb:473000000",
+		`<div style="width: 87%">`,
+		"241 packets/s",
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Fatalf("status page does not contain %q:\n%s", s, buf.String())
+		}
+	}
+}
+
+func TestHandlerStatusHTTPProtocol(t *testing.T) {
+	h := NewHandler(func(_ string) (*hdhomerun.Client, error) {
+		return nil, errors.New("should not dial")
+	})
+
+	for _, handler := range []http.Handler{h.StatusPage(), h.StatusAPI(), h.Stream()} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?target=http://192.168.1.10", nil))
+
+		if diff := cmp.Diff(http.StatusBadRequest, w.Code); diff != "" {
+			t.Fatalf("unexpected HTTP status (-want +got):\n%s", diff)
+		}
+
+		if !strings.Contains(w.Body.String(), "requires the control protocol") {
+			t.Fatalf("unexpected response body: %s", w.Body.String())
+		}
+	}
+}
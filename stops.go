@@ -0,0 +1,119 @@
+package hdhomerunexporter
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// WithStopPolling configures the handler to observe the stream stop reasons
+// of the tuners of each device it has scraped every interval, once PollStops
+// is called. This allows hdhomerun_tuner_stream_stops_total to count stops
+// which begin and end between scrapes. Devices scraped using only their HTTP
+// API are not polled, and tuners excluded by a target's Tuners or SkipTuners
+// are not polled.
+func WithStopPolling(interval time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.stopPollInterval = interval
+	}
+}
+
+// PollStops observes the stream stop reasons of the tuners of each scraped
+// device until ctx is canceled. If stop polling is not configured, PollStops
+// returns immediately.
+func (h *Handler) PollStops(ctx context.Context) {
+	if h.stopPollInterval <= 0 {
+		return
+	}
+
+	t := time.NewTicker(h.stopPollInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		h.pollStopsRound(ctx)
+	}
+}
+
+// pollStopsRound observes the stop reasons of every scraped device
+// concurrently.
+func (h *Handler) pollStopsRound(ctx context.Context) {
+	// The devices are not touched, so that polling does not prevent the
+	// eviction of devices which are no longer scraped.
+	h.mu.Lock()
+	devices := make(map[string]*deviceState, len(h.devices))
+	for target, s := range h.devices {
+		devices[target] = s
+	}
+	h.mu.Unlock()
+
+	// Each round must complete before the next begins.
+	ctx, cancel := context.WithTimeout(ctx, h.stopPollInterval)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for target, s := range devices {
+		wg.Add(1)
+		go func(target string, s *deviceState) {
+			defer wg.Done()
+			if err := h.pollStops(ctx, target, s); err != nil {
+				h.logger.Debug("failed to poll stop reasons", "target", target, "err", err)
+			}
+		}(target, s)
+	}
+	wg.Wait()
+}
+
+// pollStops dials the device with state s and observes the stop reasons of
+// its tuners.
+func (h *Handler) pollStops(ctx context.Context, target string, s *deviceState) error {
+	addr, _ := s.device()
+	if addr == "" || s.lastScrape().Backend == backendHTTP {
+		return nil
+	}
+
+	release, err := h.acquireState(ctx, target, s)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	hc, err := h.dialContext(ctx, addr)
+	if err != nil {
+		return err
+	}
+	defer hc.Close()
+
+	// Only the tuners selected for collection are polled.
+	h.mu.Lock()
+	tc := h.targets[target]
+	h.mu.Unlock()
+
+	deadline, _ := ctx.Deadline()
+	return observeStops(newDevice(hc, deadline), tc, s)
+}
+
+// observeStops observes the stop reasons of each of d's tuners selected by
+// tc in s.
+func observeStops(d device, tc TargetConfig, s *deviceState) error {
+	_, err := forEachTuner(d, tc, func(t tuner) error {
+		debug, err := t.Debug()
+		if err != nil {
+			return err
+		}
+		if debug.Network == nil {
+			return nil
+		}
+
+		reason := stopReason(debug.Network.Stop)
+		s.observeStop(strconv.Itoa(t.Index()), reason, reason != stopReasonNotStopped)
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,108 @@
+package hdhomerunexporter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/hdhomerun"
+)
+
+func TestHandlerPollStops(t *testing.T) {
+	var addrs []string
+	dial := func(addr string) (*hdhomerun.Client, error) {
+		addrs = append(addrs, addr)
+		return nil, errors.New("always fails")
+	}
+
+	h := NewHandler(dial, WithStopPolling(time.Minute))
+
+	// Only devices with a known address which are scraped using the control
+	// protocol are polled.
+	h.state("control").setAddr("192.168.1.10:65001")
+	h.state("unknown")
+
+	hs := h.state("http")
+	hs.setAddr("192.168.1.11:65001")
+	hs.recordScrape(time.Now(), backendHTTP, nil)
+
+	h.pollStopsRound(context.Background())
+
+	if diff := cmp.Diff([]string{"192.168.1.10:65001"}, addrs); diff != "" {
+		t.Fatalf("unexpected dialed addresses (-want +got):\n%s", diff)
+	}
+}
+
+func TestObserveStops(t *testing.T) {
+	debug := func(stop hdhomerun.StopReason) *hdhomerun.TunerDebug {
+		d := idleDebug()
+		d.Network.Stop = stop
+		return d
+	}
+
+	d := &testDevice{
+		tuners: []testTuner{
+			{index: 0, debug: debug(hdhomerun.StopReasonConnectionLoss)},
+			{index: 1, debug: debug(hdhomerun.StopReasonNotStopped)},
+		},
+	}
+
+	s := newDeviceState()
+	if err := observeStops(d, TargetConfig{}, s); err != nil {
+		t.Fatalf("failed to observe stops: %v", err)
+	}
+
+	// The stream of tuner 0 resumes and stops again between scrapes.
+	d.tuners[0].debug = debug(hdhomerun.StopReasonNotStopped)
+	if err := observeStops(d, TargetConfig{}, s); err != nil {
+		t.Fatalf("failed to observe stops: %v", err)
+	}
+
+	want := map[string]float64{"connection_loss": 2}
+	if diff := cmp.Diff(want, s.observeStop("0", "connection_loss", true)); diff != "" {
+		t.Fatalf("unexpected stops for tuner 0 (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(map[string]float64{}, s.observeStop("1", "not_stopped", false)); diff != "" {
+		t.Fatalf("unexpected stops for tuner 1 (-want +got):\n%s", diff)
+	}
+}
+
+func TestObserveStopsSelectedTuners(t *testing.T) {
+	debug := idleDebug()
+	debug.Network.Stop = hdhomerun.StopReasonConnectionLoss
+
+	d := &testDevice{
+		tuners: []testTuner{
+			{index: 0, debug: debug},
+			{index: 1, debug: debug},
+			{index: 2, debug: debug},
+		},
+	}
+
+	// Tuner 0 is skipped, and tuner 2 is beyond the pinned tuner count.
+	tc := TargetConfig{
+		Tuners:     2,
+		SkipTuners: []int{0},
+	}
+
+	s := newDeviceState()
+	if err := observeStops(d, tc, s); err != nil {
+		t.Fatalf("failed to observe stops: %v", err)
+	}
+
+	for _, tt := range []struct {
+		index string
+		want  map[string]float64
+	}{
+		{index: "0", want: map[string]float64{}},
+		{index: "1", want: map[string]float64{"connection_loss": 1}},
+		{index: "2", want: map[string]float64{}},
+	} {
+		if diff := cmp.Diff(tt.want, s.observeStop(tt.index, "not_stopped", false)); diff != "" {
+			t.Fatalf("unexpected stops for tuner %s (-want +got):\n%s", tt.index, diff)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package hdhomerunexporter
+
+import (
+	"encoding/json"
+	"net/url"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collectStorage collects DVR storage metrics from the device's HTTP API, for
+// devices which provide storage such as the HDHomeRun SCRIBE and SERVIO, and
+// for the HDHomeRun DVR RECORD engine.
+func (c *collector) collectStorage(ch chan<- prometheus.Metric, discover discoverJSON) error {
+	ch <- prometheus.MustNewConstMetric(
+		c.StorageInfo,
+		prometheus.GaugeValue,
+		1,
+		discover.StorageID,
+	)
+
+	ds := []descValue{
+		{
+			desc:  c.StorageTotalBytes,
+			value: float64(discover.TotalSpace),
+		},
+		{
+			desc:  c.StorageFreeBytes,
+			value: float64(discover.FreeSpace),
+		},
+	}
+
+	// Not all storage devices report the size of their live buffers.
+	if discover.LiveBufferSpace != nil {
+		ds = append(ds, descValue{
+			desc:  c.StorageLiveBufferBytes,
+			value: float64(*discover.LiveBufferSpace),
+		})
+	}
+
+	if discover.StorageURL != "" {
+		u, err := url.Parse(discover.StorageURL)
+		if err != nil {
+			return err
+		}
+
+		// Only the contents of the list are needed to count the recordings.
+		var recordings []json.RawMessage
+		if err := c.a.Get(u.Path, &recordings); err != nil {
+			return err
+		}
+
+		ds = append(ds, descValue{
+			desc:  c.StorageRecordings,
+			value: float64(len(recordings)),
+		})
+	}
+
+	for _, d := range ds {
+		ch <- prometheus.MustNewConstMetric(
+			d.desc,
+			prometheus.GaugeValue,
+			d.value,
+		)
+	}
+
+	return nil
+}
+
+// A storageStatusJSON is an active resource served by a storage device's
+// status.json endpoint, such as a recording in progress.
+type storageStatusJSON struct {
+	Resource string
+}
+
+// Possible storageStatusJSON resources.
+const (
+	resourceLive   = "live"
+	resourceRecord = "record"
+)
+
+// collectDVR collects DVR recording and live TV metrics from the device's HTTP
+// API, for devices which provide storage.
+func (c *collector) collectDVR(ch chan<- prometheus.Metric) error {
+	var status []storageStatusJSON
+	switch err := c.a.Get("/status.json", &status); err {
+	case nil:
+	case errNotFound:
+		return nil
+	default:
+		return err
+	}
+
+	var record, live int
+	for _, s := range status {
+		switch s.Resource {
+		case resourceRecord:
+			record++
+		case resourceLive:
+			live++
+		}
+	}
+
+	ds := []descValue{
+		{
+			desc:  c.DVRActiveRecordings,
+			value: float64(record),
+		},
+		{
+			desc:  c.DVRLiveSessions,
+			value: float64(live),
+		},
+	}
+
+	// Only devices which schedule recordings themselves, such as the RECORD
+	// engine, list their upcoming recordings.
+	var upcoming []json.RawMessage
+	switch err := c.a.Get("/upcoming.json", &upcoming); err {
+	case nil:
+		ds = append(ds, descValue{
+			desc:  c.DVRUpcomingRecordings,
+			value: float64(len(upcoming)),
+		})
+	case errNotFound:
+	default:
+		return err
+	}
+
+	for _, d := range ds {
+		ch <- prometheus.MustNewConstMetric(
+			d.desc,
+			prometheus.GaugeValue,
+			d.value,
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package hdhomerunexporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// defaultStreamInterval is the default interval at which device status
+	// updates are sent to streaming clients.
+	defaultStreamInterval = 1 * time.Second
+
+	// minStreamInterval bounds how frequently a client may request device
+	// status updates, to avoid overwhelming a device.
+	minStreamInterval = 250 * time.Millisecond
+)
+
+// WithStreamInterval sets the default interval at which device status
+// updates are sent by the http.Handler returned by Handler.Stream.
+func WithStreamInterval(d time.Duration) HandlerOption {
+	return func(h *Handler) {
+		if d < minStreamInterval {
+			d = minStreamInterval
+		}
+
+		h.streamInterval = d
+	}
+}
+
+// Stream returns an http.Handler which pushes the status of the device
+// specified by the "target" query parameter to clients as Server-Sent Events,
+// for real-time monitoring such as antenna alignment.
+//
+// A single device connection is reused for the lifetime of the stream. Each
+// status update is given its own timeout and is subject to the same
+// concurrency limits as a scrape. An optional "interval" query parameter
+// overrides the interval at which status updates are sent.
+func (h *Handler) Stream() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		interval := h.streamInterval
+		if v := r.URL.Query().Get("interval"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid interval parameter: %v", err), http.StatusBadRequest)
+				return
+			}
+			if d < minStreamInterval {
+				d = minStreamInterval
+			}
+
+			interval = d
+		}
+
+		c, done, err := h.statusCollector(r)
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		defer done()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+
+		target := r.URL.Query().Get("target")
+		name, _, _ := splitScheme(target)
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			// Each update is a scrape of its own, with its own deadline, and
+			// waits its turn with other scrapes of the device.
+			release, err := h.acquire(r.Context(), name)
+			if err != nil {
+				return
+			}
+
+			c.renewDeadline()
+			ds, err := c.status()
+			release()
+			if err != nil {
+				// The connection may no longer be usable, so end the stream
+				// and allow the client to reconnect.
+				_ = writeEvent(w, "error", err.Error())
+				flusher.Flush()
+				return
+			}
+			ds.Target = target
+
+			if err := writeEvent(w, "status", ds); err != nil {
+				return
+			}
+			flusher.Flush()
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-t.C:
+			}
+		}
+	})
+}
+
+// writeEvent writes a single Server-Sent Event to w, encoding v as JSON.
+func writeEvent(w io.Writer, event string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	// JSON output never contains newlines, so the data fits on a single line.
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b); err != nil {
+		return err
+	}
+
+	return nil
+}
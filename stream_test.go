@@ -0,0 +1,206 @@
+package hdhomerunexporter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/hdhomerun"
+)
+
+func TestWriteEvent(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeEvent(&buf, "status", &deviceStatus{
+		Target: "192.168.1.10",
+		Model:  "hdhomerun_test",
+	})
+	if err != nil {
+		t.Fatalf("failed to write event: %v", err)
+	}
+
+	want := "event: status\n" +
+		`data: {"target":"192.168.1.10","model":"hdhomerun_test","tuners":null}` + "\n\n"
+
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Fatalf("unexpected event (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandlerStreamOutlivesTimeout(t *testing.T) {
+	dial := testControlDevice(t)
+
+	s := httptest.NewServer(NewHandler(dial,
+		WithTimeout(100*time.Millisecond),
+	).Stream())
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL+"?target=foo&interval=250ms", nil)
+	if err != nil {
+		t.Fatalf("failed to create HTTP request: %v", err)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to perform HTTP request: %v", err)
+	}
+	defer res.Body.Close()
+
+	// The stream must keep sending status updates long after the timeout
+	// for a single update has passed.
+	var statuses int
+	sc := bufio.NewScanner(res.Body)
+	for statuses < 4 && sc.Scan() {
+		switch sc.Text() {
+		case "event: status":
+			statuses++
+		case "event: error":
+			sc.Scan()
+			t.Fatalf("unexpected error event after %d status events: %s", statuses, sc.Text())
+		}
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatalf("failed to read stream: %v", err)
+	}
+
+	if diff := cmp.Diff(4, statuses); diff != "" {
+		t.Fatalf("unexpected number of status events (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandlerStreamWaitsForScrape(t *testing.T) {
+	h := NewHandler(testControlDevice(t))
+
+	// Hold the device as if it were being scraped.
+	release, err := h.acquire(context.Background(), "foo")
+	if err != nil {
+		t.Fatalf("failed to acquire device: %v", err)
+	}
+
+	s := httptest.NewServer(h.Stream())
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL+"?target=foo", nil)
+	if err != nil {
+		t.Fatalf("failed to create HTTP request: %v", err)
+	}
+
+	// The response headers are not sent until the first event, so the
+	// request is performed in the background.
+	eventC := make(chan string)
+	go func() {
+		defer close(eventC)
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return
+		}
+		defer res.Body.Close()
+
+		sc := bufio.NewScanner(res.Body)
+		for sc.Scan() {
+			if strings.HasPrefix(sc.Text(), "event: ") {
+				eventC <- sc.Text()
+			}
+		}
+	}()
+
+	select {
+	case e := <-eventC:
+		t.Fatalf("stream sent %q while the device was busy", e)
+	case <-time.After(250 * time.Millisecond):
+	}
+
+	release()
+
+	select {
+	case e := <-eventC:
+		if diff := cmp.Diff("event: status", e); diff != "" {
+			t.Fatalf("unexpected event (-want +got):\n%s", diff)
+		}
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for a status event")
+	}
+}
+
+// testControlDevice returns a dial function which connects to a fake device
+// speaking the HDHomeRun control protocol. The device has a single tuner.
+func testControlDevice(t *testing.T) func(addr string) (*hdhomerun.Client, error) {
+	t.Helper()
+
+	// Protocol constants as defined in libhdhomerun/hdhomerun_pkt.h.
+	const (
+		typeGetsetReq   = 0x0004
+		typeGetsetRpy   = 0x0005
+		tagGetsetName   = 0x03
+		tagGetsetValue  = 0x04
+		tagErrorMessage = 0x05
+	)
+
+	values := map[string]string{
+		"/sys/model":    "hdhomerun_test",
+		"/tuner0/debug": "tun: ch=none lock=none ss=0 snq=0 seq=0 dbg=0",
+	}
+
+	serve := func(c net.Conn) {
+		defer c.Close()
+
+		b := make([]byte, 1460)
+		for {
+			n, err := c.Read(b)
+			if err != nil {
+				return
+			}
+
+			var req hdhomerun.Packet
+			if err := req.UnmarshalBinary(b[:n]); err != nil || req.Type != typeGetsetReq {
+				return
+			}
+
+			var name []byte
+			for _, tag := range req.Tags {
+				if tag.Type == tagGetsetName {
+					name = tag.Data
+				}
+			}
+
+			rep := &hdhomerun.Packet{
+				Type: typeGetsetRpy,
+				Tags: []hdhomerun.Tag{{Type: tagGetsetName, Data: name}},
+			}
+
+			if v, ok := values[string(bytes.TrimSuffix(name, []byte{0x00}))]; ok {
+				rep.Tags = append(rep.Tags, hdhomerun.Tag{Type: tagGetsetValue, Data: append([]byte(v), 0x00)})
+			} else {
+				rep.Tags = append(rep.Tags, hdhomerun.Tag{Type: tagErrorMessage, Data: []byte("ERROR: unknown getset variable\x00")})
+			}
+
+			pb, err := rep.MarshalBinary()
+			if err != nil {
+				return
+			}
+			if _, err := c.Write(pb); err != nil {
+				return
+			}
+		}
+	}
+
+	return func(_ string) (*hdhomerun.Client, error) {
+		c1, c2 := net.Pipe()
+		go serve(c2)
+
+		return hdhomerun.NewClient(c1)
+	}
+}
@@ -0,0 +1,105 @@
+package hdhomerunexporter
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// A targetStatus is the JSON representation of the status of a target.
+type targetStatus struct {
+	Target         string     `json:"target"`
+	Configured     bool       `json:"configured"`
+	Discovered     bool       `json:"discovered"`
+	Address        string     `json:"address,omitempty"`
+	DeviceID       string     `json:"device_id,omitempty"`
+	Model          string     `json:"model,omitempty"`
+	HWModel        string     `json:"hwmodel,omitempty"`
+	Firmware       string     `json:"firmware,omitempty"`
+	LastScrape     *time.Time `json:"last_scrape,omitempty"`
+	Up             bool       `json:"up"`
+	LastError      string     `json:"last_error,omitempty"`
+	LastErrorClass string     `json:"last_error_class,omitempty"`
+	Backend        string     `json:"backend,omitempty"`
+}
+
+// Targets returns an http.Handler which serves a JSON summary of every
+// target known to the Handler, either through configuration, discovery, or
+// because it has been scraped, along with the device's address and identity
+// and the outcome of its most recent scrape.
+func (h *Handler) Targets() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(h.targetStatuses())
+	})
+}
+
+// targetStatuses returns the status of every known target, sorted by target.
+func (h *Handler) targetStatuses() []targetStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	known := make(map[string]*deviceState, len(h.devices))
+	for target := range h.targets {
+		known[target] = nil
+	}
+	for target := range h.resolved {
+		known[target] = nil
+	}
+	for target, s := range h.devices {
+		known[target] = s
+	}
+
+	ts := make([]targetStatus, 0, len(known))
+	for target, s := range known {
+		tc, configured := h.targets[target]
+		resolved, discovered := h.resolved[target]
+		status := targetStatus{
+			Target:     target,
+			Configured: configured,
+			Discovered: discovered,
+		}
+
+		// Prefer the address which was most recently dialed.
+		switch {
+		case tc.Address != "":
+			status.Address = tc.Address
+		case discovered:
+			status.Address = resolved
+		}
+
+		if s != nil {
+			addr, id := s.device()
+			if addr != "" {
+				status.Address = addr
+			}
+
+			status.DeviceID = id.DeviceID
+			status.Model = id.Model
+			status.HWModel = id.HWModel
+			status.Firmware = id.Firmware
+
+			scrape := s.lastScrape()
+			if !scrape.Time.IsZero() {
+				t := scrape.Time
+				status.LastScrape = &t
+				status.Up = scrape.Err == nil
+				status.Backend = scrape.Backend
+			}
+
+			if scrape.Err != nil {
+				status.LastError = scrape.Err.Error()
+				status.LastErrorClass = scrape.ErrorClass
+			}
+		}
+
+		ts = append(ts, status)
+	}
+
+	sort.Slice(ts, func(i, j int) bool {
+		return ts[i].Target < ts[j].Target
+	})
+
+	return ts
+}
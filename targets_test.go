@@ -0,0 +1,85 @@
+package hdhomerunexporter_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/hdhomerun"
+	"github.com/mdlayher/hdhomerun_exporter"
+)
+
+func TestHandlerTargets(t *testing.T) {
+	dial := func(_ string) (*hdhomerun.Client, error) {
+		return nil, errors.New("always fails")
+	}
+
+	h := hdhomerunexporter.NewHandler(
+		dial,
+		hdhomerunexporter.WithTargets(map[string]hdhomerunexporter.TargetConfig{
+			"configured": {},
+		}),
+		hdhomerunexporter.WithDiscovery(testDiscover),
+	)
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	for _, target := range []string{"scraped", "1040A1B2"} {
+		res, err := http.Get(s.URL + "?target=" + target)
+		if err != nil {
+			t.Fatalf("failed to perform HTTP request: %v", err)
+		}
+		_ = res.Body.Close()
+	}
+
+	ts := httptest.NewServer(h.Targets())
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("failed to perform HTTP request: %v", err)
+	}
+	defer res.Body.Close()
+
+	type target struct {
+		Target         string `json:"target"`
+		Configured     bool   `json:"configured"`
+		Discovered     bool   `json:"discovered"`
+		Address        string `json:"address"`
+		Up             bool   `json:"up"`
+		LastErrorClass string `json:"last_error_class"`
+		Backend        string `json:"backend"`
+	}
+
+	var got []target
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode targets: %v", err)
+	}
+
+	want := []target{
+		{
+			Target:         "1040A1B2",
+			Address:        "192.168.1.10:65001",
+			LastErrorClass: "dial",
+			Backend:        "control",
+		},
+		{
+			Target:     "configured",
+			Configured: true,
+		},
+		{
+			Target:         "scraped",
+			Address:        "scraped:65001",
+			LastErrorClass: "dial",
+			Backend:        "control",
+		},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected targets (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,63 @@
+package hdhomerunexporter
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// A transcode is the hardware transcoder state reported by a tuner on
+// HDHomeRun EXTEND devices.
+type transcode struct {
+	Profile string
+	Bitrate int
+}
+
+// parseTranscode parses the value of /tunerN/transcode, which is either a
+// bare profile name such as "none", or key=value pairs of the form
+// "profile=mobile bitrate=2000000". The bitrate is in bits per second.
+func parseTranscode(s string) transcode {
+	kvs := parseKV(s)
+	if len(kvs) == 0 {
+		return transcode{Profile: strings.TrimSpace(s)}
+	}
+
+	// An unparseable bitrate is reported as zero.
+	bitrate, _ := strconv.Atoi(kvs["bitrate"])
+
+	return transcode{
+		Profile: kvs["profile"],
+		Bitrate: bitrate,
+	}
+}
+
+// collectTranscode collects the hardware transcoder state of a tuner, if the
+// device reports it.
+func (c *collector) collectTranscode(ch chan<- prometheus.Metric, tuner string, i int) error {
+	v, err := c.query(tunerKey(i, "transcode"))
+	switch {
+	case notExist(err):
+		return nil
+	case err != nil:
+		return err
+	}
+
+	t := parseTranscode(v)
+
+	ch <- prometheus.MustNewConstMetric(
+		c.TunerTranscodeInfo,
+		prometheus.GaugeValue,
+		1,
+		tuner, t.Profile,
+	)
+
+	ch <- prometheus.MustNewConstMetric(
+		c.TunerTranscodeBytesPerSecond,
+		prometheus.GaugeValue,
+		bytesPerSecond(t.Bitrate),
+		tuner,
+	)
+
+	return nil
+}
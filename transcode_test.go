@@ -0,0 +1,45 @@
+package hdhomerunexporter
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseTranscode(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		t    transcode
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "profile only",
+			s:    "none\n",
+			t:    transcode{Profile: "none"},
+		},
+		{
+			name: "profile and bitrate",
+			s:    "profile=mobile bitrate=2000000",
+			t: transcode{
+				Profile: "mobile",
+				Bitrate: 2000000,
+			},
+		},
+		{
+			name: "bad bitrate",
+			s:    "profile=heavy bitrate=foo",
+			t:    transcode{Profile: "heavy"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.t, parseTranscode(tt.s)); diff != "" {
+				t.Fatalf("unexpected transcode (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
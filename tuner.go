@@ -0,0 +1,314 @@
+package hdhomerunexporter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mdlayher/hdhomerun"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// tunerKey returns the device query key for key on the tuner with index i,
+// such as "/tuner0/target".
+func tunerKey(i int, key string) string {
+	return fmt.Sprintf("/tuner%d/%s", i, key)
+}
+
+// collectTunerKeys collects info metrics for tuner query keys, if the device
+// reports them.
+func (c *collector) collectTunerKeys(ch chan<- prometheus.Metric, tuner string, i int) error {
+	keys := []struct {
+		key  string
+		desc *prometheus.Desc
+	}{
+		// The destination to which a tuner is streaming.
+		{key: "target", desc: c.TunerTargetInfo},
+		// The virtual channel number a tuner is tuned to.
+		{key: "vchannel", desc: c.TunerVChannelInfo},
+		// The address of the client holding a tuner's lock, if any.
+		{key: "lockkey", desc: c.TunerLockedByInfo},
+	}
+
+	for _, k := range keys {
+		if !c.plan.has(k.key) {
+			continue
+		}
+
+		v, err := c.query(tunerKey(i, k.key))
+		switch {
+		case notExist(err):
+			continue
+		case err != nil:
+			return err
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			k.desc,
+			prometheus.GaugeValue,
+			1,
+			tuner, v,
+		)
+	}
+
+	return nil
+}
+
+// collectTunerProgram collects the program a tuner is demuxing along with its
+// PID filter, if the device reports them.
+func (c *collector) collectTunerProgram(ch chan<- prometheus.Metric, tuner string, i int) error {
+	var (
+		vs    [2]string
+		found bool
+	)
+
+	for j, key := range []string{"program", "filter"} {
+		if !c.plan.has(key) {
+			continue
+		}
+
+		v, err := c.query(tunerKey(i, key))
+		switch {
+		case notExist(err):
+			continue
+		case err != nil:
+			return err
+		}
+
+		vs[j] = v
+		found = true
+	}
+
+	if !found {
+		return nil
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		c.TunerProgramInfo,
+		prometheus.GaugeValue,
+		1,
+		tuner, vs[0], vs[1],
+	)
+
+	if n, ok := filterPIDs(vs[1]); ok {
+		ch <- prometheus.MustNewConstMetric(
+			c.TunerFilterPIDs,
+			prometheus.GaugeValue,
+			float64(n),
+			tuner,
+		)
+	}
+
+	return nil
+}
+
+// filterPIDs parses a tuner's PID filter, such as "0x0000 0x0030-0x0033", and
+// returns the number of PIDs passed by the filter. It reports false if the
+// filter cannot be parsed.
+func filterPIDs(filter string) (int, bool) {
+	fields := strings.Fields(filter)
+	if len(fields) == 0 {
+		return 0, false
+	}
+
+	var n int
+	for _, f := range fields {
+		bounds := strings.SplitN(f, "-", 2)
+
+		lo, err := strconv.ParseUint(bounds[0], 0, 16)
+		if err != nil {
+			return 0, false
+		}
+
+		hi := lo
+		if len(bounds) == 2 {
+			hi, err = strconv.ParseUint(bounds[1], 0, 16)
+			if err != nil || hi < lo {
+				return 0, false
+			}
+		}
+
+		n += int(hi-lo) + 1
+	}
+
+	return n, true
+}
+
+// tunerChannelMap returns the channel map used by a tuner, such as
+// "us-bcast", or the empty string if the device does not report it.
+func (c *collector) tunerChannelMap(i int) (string, error) {
+	v, err := c.query(tunerKey(i, "channelmap"))
+	if notExist(err) {
+		return "", nil
+	}
+
+	return v, err
+}
+
+// collectTunerCopyProtection collects the copy protection flags of the
+// virtual channel a tuner is tuned to, if the device reports them.
+func (c *collector) collectTunerCopyProtection(ch chan<- prometheus.Metric, tuner string, i int) error {
+	v, err := c.query(tunerKey(i, "vstatus"))
+	switch {
+	case notExist(err):
+		return nil
+	case err != nil:
+		return err
+	}
+
+	// Idle tuners do not report copy protection flags.
+	kvs := parseKV(v)
+	cci, cgms := kvs["cci"], kvs["cgms"]
+	if cci == "" && cgms == "" {
+		return nil
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		c.TunerCopyProtectionInfo,
+		prometheus.GaugeValue,
+		1,
+		tuner, cci, cgms,
+	)
+
+	return nil
+}
+
+// A tunerDebug contains the named diagnostic values reported in a tuner's
+// debug field, such as "-383/-6666/-25", where the values following the
+// signal strength are the tuner's AGC level and, on some models, its carrier
+// offset. Values which the tuner does not report are nil.
+type tunerDebug struct {
+	AGC    *int
+	Offset *int
+}
+
+// parseTunerDebug parses the named diagnostic values from a tuner's debug
+// field. Values which are missing or malformed are skipped.
+func parseTunerDebug(dbg string) tunerDebug {
+	ss := strings.Split(dbg, "/")
+
+	value := func(i int) *int {
+		if len(ss) <= i {
+			return nil
+		}
+
+		v, err := strconv.Atoi(ss[i])
+		if err != nil {
+			return nil
+		}
+
+		return &v
+	}
+
+	return tunerDebug{
+		AGC:    value(1),
+		Offset: value(2),
+	}
+}
+
+// signalStrengthDBM parses the absolute signal strength from a tuner's debug
+// field, reported by some models in the form "-383/-6666" where the first
+// value is the signal strength in tenths of a dBm. It reports false if the
+// signal strength is not available, such as when the tuner is idle.
+func signalStrengthDBM(dbg string) (float64, bool) {
+	ss := strings.SplitN(dbg, "/", 2)
+	if len(ss) != 2 {
+		return 0, false
+	}
+
+	v, err := strconv.Atoi(ss[0])
+	if err != nil {
+		return 0, false
+	}
+
+	return float64(v) / 10, true
+}
+
+// channelFrequency parses the frequency in Hz from a tuner's channel, such as
+// "qam:381000000". It reports false if the tuner is not tuned to a channel.
+func channelFrequency(channel string) (float64, bool) {
+	ss := strings.SplitN(channel, ":", 2)
+	if len(ss) != 2 {
+		return 0, false
+	}
+
+	hz, err := strconv.Atoi(ss[1])
+	if err != nil {
+		return 0, false
+	}
+
+	return float64(hz), true
+}
+
+// A signalAggregate aggregates the signal quality of each of a device's
+// tuners which are locked on to a channel.
+type signalAggregate struct {
+	n                        int
+	strengthMin, strengthSum float64
+	snrMin, snrSum           float64
+}
+
+// add adds a tuner's status to the aggregate, if the tuner is locked.
+func (a *signalAggregate) add(ts *hdhomerun.TunerStatus) {
+	if ts == nil || !locked(ts) {
+		return
+	}
+
+	strength, snr := ratio(ts.SignalStrength), ratio(ts.SignalToNoiseQuality)
+	if a.n == 0 || strength < a.strengthMin {
+		a.strengthMin = strength
+	}
+	if a.n == 0 || snr < a.snrMin {
+		a.snrMin = snr
+	}
+
+	a.strengthSum += strength
+	a.snrSum += snr
+	a.n++
+}
+
+// locked determines if a tuner is locked on to a channel.
+func locked(ts *hdhomerun.TunerStatus) bool {
+	return ts.Lock != "" && ts.Lock != "none"
+}
+
+// tuned determines if a tuner is tuned to a channel, regardless of whether
+// it has locked on to that channel.
+func tuned(ts *hdhomerun.TunerStatus) bool {
+	return ts != nil && ts.Channel != "" && ts.Channel != "none"
+}
+
+// collectSignalAggregate collects device-level signal quality metrics from a,
+// if any of the device's tuners are locked.
+func (c *collector) collectSignalAggregate(ch chan<- prometheus.Metric, a signalAggregate) {
+	if a.n == 0 {
+		return
+	}
+
+	ds := []descValue{
+		{
+			desc:  c.DeviceSignalStrengthRatioMin,
+			value: a.strengthMin,
+		},
+		{
+			desc:  c.DeviceSignalStrengthRatioAvg,
+			value: a.strengthSum / float64(a.n),
+		},
+		{
+			desc:  c.DeviceSignalToNoiseRatioMin,
+			value: a.snrMin,
+		},
+		{
+			desc:  c.DeviceSignalToNoiseRatioAvg,
+			value: a.snrSum / float64(a.n),
+		},
+	}
+
+	for _, d := range ds {
+		ch <- prometheus.MustNewConstMetric(
+			d.desc,
+			prometheus.GaugeValue,
+			d.value,
+		)
+	}
+}
@@ -0,0 +1,211 @@
+package hdhomerunexporter
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/hdhomerun"
+)
+
+func TestSignalStrengthDBM(t *testing.T) {
+	tests := []struct {
+		name string
+		dbg  string
+		v    float64
+		ok   bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "idle",
+			dbg:  "0",
+		},
+		{
+			name: "malformed",
+			dbg:  "foo/bar",
+		},
+		{
+			name: "OK",
+			dbg:  "-383/-6666",
+			v:    -38.3,
+			ok:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, ok := signalStrengthDBM(tt.dbg)
+
+			if diff := cmp.Diff(tt.ok, ok); diff != "" {
+				t.Fatalf("unexpected ok (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.v, v); diff != "" {
+				t.Fatalf("unexpected signal strength (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestChannelFrequency(t *testing.T) {
+	tests := []struct {
+		name    string
+		channel string
+		hz      float64
+		ok      bool
+	}{
+		{
+			name:    "none",
+			channel: "none",
+		},
+		{
+			name:    "malformed",
+			channel: "qam:foo",
+		},
+		{
+			name:    "OK",
+			channel: "qam:381000000",
+			hz:      381000000,
+			ok:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hz, ok := channelFrequency(tt.channel)
+
+			if diff := cmp.Diff(tt.ok, ok); diff != "" {
+				t.Fatalf("unexpected ok (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.hz, hz); diff != "" {
+				t.Fatalf("unexpected frequency (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFilterPIDs(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		n      int
+		ok     bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:   "malformed",
+			filter: "0x0000-foo",
+		},
+		{
+			name:   "reversed range",
+			filter: "0x0033-0x0030",
+		},
+		{
+			name:   "full mux",
+			filter: "0x0000-0x1FFF",
+			n:      8192,
+			ok:     true,
+		},
+		{
+			name:   "single program",
+			filter: "0x0000 0x0030-0x0033 0x1FFB",
+			n:      6,
+			ok:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, ok := filterPIDs(tt.filter)
+
+			if diff := cmp.Diff(tt.ok, ok); diff != "" {
+				t.Fatalf("unexpected ok (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.n, n); diff != "" {
+				t.Fatalf("unexpected PID count (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseTunerDebug(t *testing.T) {
+	intp := func(v int) *int { return &v }
+
+	tests := []struct {
+		name string
+		dbg  string
+		d    tunerDebug
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "idle",
+			dbg:  "0",
+		},
+		{
+			name: "malformed",
+			dbg:  "-383/foo/-25",
+			d:    tunerDebug{Offset: intp(-25)},
+		},
+		{
+			name: "AGC",
+			dbg:  "-383/-6666",
+			d:    tunerDebug{AGC: intp(-6666)},
+		},
+		{
+			name: "AGC and offset",
+			dbg:  "-383/-6666/-25",
+			d: tunerDebug{
+				AGC:    intp(-6666),
+				Offset: intp(-25),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.d, parseTunerDebug(tt.dbg)); diff != "" {
+				t.Fatalf("unexpected debug values (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSignalAggregate(t *testing.T) {
+	var a signalAggregate
+	for _, ts := range []*hdhomerun.TunerStatus{
+		nil,
+		// Idle tuners are not aggregated.
+		{Lock: "none"},
+		{Lock: "8vsb", SignalStrength: 80, SignalToNoiseQuality: 60},
+		{Lock: "qam256", SignalStrength: 100, SignalToNoiseQuality: 90},
+	} {
+		a.add(ts)
+	}
+
+	if diff := cmp.Diff(2, a.n); diff != "" {
+		t.Fatalf("unexpected number of locked tuners (-want +got):\n%s", diff)
+	}
+
+	fields := []struct {
+		name      string
+		want, got float64
+	}{
+		{name: "strength min", want: 0.8, got: a.strengthMin},
+		{name: "strength sum", want: 1.8, got: a.strengthSum},
+		{name: "SNR min", want: 0.6, got: a.snrMin},
+		{name: "SNR sum", want: 1.5, got: a.snrSum},
+	}
+
+	for _, f := range fields {
+		if diff := cmp.Diff(f.want, f.got); diff != "" {
+			t.Fatalf("unexpected %s (-want +got):\n%s", f.name, diff)
+		}
+	}
+}